@@ -1,5 +1,11 @@
 package ast
 
+import (
+	"strings"
+
+	"github.com/kestred/philomath/code/token"
+)
+
 /* Constant Nodes */
 
 var (
@@ -17,11 +23,13 @@ var (
 	UninferredType  = BaseTyp("<uninferred>")  // used before it was inferred
 	UnresolvedType  = BaseTyp("<unresolved>")  // could not infer type
 	UncastableType  = BaseTyp("<uncastable>")  // could not cast type
+	AmbiguousType   = BaseTyp("<ambiguous>")   // could not choose between overloads
 	PlaceholderType = BaseTyp("<placeholder>") // a placeholder until I implement more complex types
 
 	// Builtin types
 	BuiltinTypes   = make(map[string]*BaseType)
 	BuiltinEmpty   = BaseTyp("empty") // the 0-byte type
+	BuiltinBool    = BaseTyp("bool")
 	BuiltinChar    = BaseTyp("char")
 	BuiltinText    = BaseTyp("text")
 	BuiltinFloat   = BaseTyp("float")
@@ -65,6 +73,14 @@ var (
 	BuiltinPositive  = Operator("Positive", "+", "pos_", UnaryPrefix, RightAssociative, PrefixPrec)
 	BuiltinNegative  = Operator("Negative", "-", "neg_", UnaryPrefix, RightAssociative, PrefixPrec)
 
+	// Bitwise operators
+	BuiltinBitAnd     = Operator("Bitwise And", "&", "_bitand_", BinaryInfix, LeftAssociative, DistributivePrec)
+	BuiltinBitOr      = Operator("Bitwise Or", "|", "_bitor_", BinaryInfix, LeftAssociative, CommutativePrec)
+	BuiltinBitXor     = Operator("Bitwise Xor", "xor", "_xor_", BinaryInfix, LeftAssociative, CommutativePrec)
+	BuiltinShiftLeft  = Operator("Shift Left", "<<", "_shl_", BinaryInfix, LeftAssociative, DistributivePrec)
+	BuiltinShiftRight = Operator("Shift Right", ">>", "_shr_", BinaryInfix, LeftAssociative, DistributivePrec)
+	BuiltinBitNot     = Operator("Bitwise Not", "!", "bitnot_", UnaryPrefix, RightAssociative, PrefixPrec)
+
 	// Pointer operators
 	BuiltinReference   = Operator("Reference", "^", "ref_", UnaryPrefix, RightAssociative, PostfixPrec)
 	BuiltinDereference = Operator("Dereference", "~", "deref_", UnaryPrefix, RightAssociative, PostfixPrec)
@@ -76,15 +92,20 @@ type Node interface {
 	ImplementsNode()
 	GetParent() Node
 	SetParent(p Node)
+	base() *NodeBase
 }
 
 type NodeBase struct {
 	Parent Node
+
+	pos      token.Position // see SetPosition
+	constant Value          // see SetConstant
 }
 
 func (n *NodeBase) ImplementsNode()  {}
 func (n *NodeBase) GetParent() Node  { return n.Parent }
 func (n *NodeBase) SetParent(p Node) { n.Parent = p }
+func (n *NodeBase) base() *NodeBase  { return n }
 
 type Scope interface {
 	Node
@@ -100,17 +121,21 @@ type Evaluable interface {
 	ImplementsEvaluable()
 }
 
-func (b *Block) ImplementsEvaluable()         {}
-func (s *AsmBlock) ImplementsEvaluable()      {}
-func (d *ImmutableDecl) ImplementsEvaluable() {}
-func (d *MutableDecl) ImplementsEvaluable()   {}
-func (s *IfStmt) ImplementsEvaluable()        {}
-func (s *WhileStmt) ImplementsEvaluable()     {}
-func (s *ForStmt) ImplementsEvaluable()       {}
-func (s *EvalStmt) ImplementsEvaluable()      {}
-func (s *AssignStmt) ImplementsEvaluable()    {}
-func (s *ReturnStmt) ImplementsEvaluable()    {}
-func (s *DoneStmt) ImplementsEvaluable()      {}
+func (b *Block) ImplementsEvaluable()           {}
+func (s *AsmBlock) ImplementsEvaluable()        {}
+func (d *ImmutableDecl) ImplementsEvaluable()   {}
+func (d *MutableDecl) ImplementsEvaluable()     {}
+func (s *IfStmt) ImplementsEvaluable()          {}
+func (s *IfDirective) ImplementsEvaluable()     {}
+func (s *AssertDirective) ImplementsEvaluable() {}
+func (s *WhileStmt) ImplementsEvaluable()       {}
+func (s *ForStmt) ImplementsEvaluable()         {}
+func (s *EvalStmt) ImplementsEvaluable()        {}
+func (s *AssignStmt) ImplementsEvaluable()      {}
+func (s *ReturnStmt) ImplementsEvaluable()      {}
+func (s *DestructureStmt) ImplementsEvaluable() {}
+func (s *DoneStmt) ImplementsEvaluable()        {}
+func (s *DeferStmt) ImplementsEvaluable()       {}
 
 type Decl interface {
 	Evaluable
@@ -118,11 +143,15 @@ type Decl interface {
 	GetName() *Identifier
 }
 
-func (d *ImmutableDecl) ImplementsDecl() {}
-func (d *MutableDecl) ImplementsDecl()   {}
+func (d *ImmutableDecl) ImplementsDecl()   {}
+func (d *MutableDecl) ImplementsDecl()     {}
+func (s *IfDirective) ImplementsDecl()     {}
+func (s *AssertDirective) ImplementsDecl() {}
 
-func (d *ImmutableDecl) GetName() *Identifier { return d.Name }
-func (d *MutableDecl) GetName() *Identifier   { return d.Name }
+func (d *ImmutableDecl) GetName() *Identifier   { return d.Name }
+func (d *MutableDecl) GetName() *Identifier     { return d.Name }
+func (s *IfDirective) GetName() *Identifier     { return nil } // an "#if" may declare many names
+func (s *AssertDirective) GetName() *Identifier { return nil }
 
 type Defn interface {
 	Node
@@ -140,13 +169,17 @@ type Stmt interface {
 	ImplementsStmt()
 }
 
-func (s *IfStmt) ImplementsStmt()     {}
-func (s *WhileStmt) ImplementsStmt()  {}
-func (s *ForStmt) ImplementsStmt()    {}
-func (s *EvalStmt) ImplementsStmt()   {}
-func (s *AssignStmt) ImplementsStmt() {}
-func (s *ReturnStmt) ImplementsStmt() {}
-func (s *DoneStmt) ImplementsStmt()   {}
+func (s *IfStmt) ImplementsStmt()          {}
+func (s *IfDirective) ImplementsStmt()     {}
+func (s *AssertDirective) ImplementsStmt() {}
+func (s *WhileStmt) ImplementsStmt()       {}
+func (s *ForStmt) ImplementsStmt()         {}
+func (s *EvalStmt) ImplementsStmt()        {}
+func (s *AssignStmt) ImplementsStmt()      {}
+func (s *ReturnStmt) ImplementsStmt()      {}
+func (s *DestructureStmt) ImplementsStmt() {}
+func (s *DoneStmt) ImplementsStmt()        {}
+func (s *DeferStmt) ImplementsStmt()       {}
 
 type Expr interface {
 	Node
@@ -154,27 +187,43 @@ type Expr interface {
 	GetType() Type
 }
 
-func (e *PostfixExpr) ImplementsExpr()   {}
-func (e *InfixExpr) ImplementsExpr()     {}
-func (e *PrefixExpr) ImplementsExpr()    {}
-func (e *CallExpr) ImplementsExpr()      {}
-func (e *GroupExpr) ImplementsExpr()     {}
-func (e *ProcedureExpr) ImplementsExpr() {}
-func (e *MemberExpr) ImplementsExpr()    {}
-func (l *NumberLiteral) ImplementsExpr() {}
-func (l *TextLiteral) ImplementsExpr()   {}
-func (i *Identifier) ImplementsExpr()    {}
-
-func (e *PostfixExpr) GetType() Type   { return e.Type }
-func (e *InfixExpr) GetType() Type     { return e.Type }
-func (e *PrefixExpr) GetType() Type    { return e.Type }
-func (e *CallExpr) GetType() Type      { return e.Type }
-func (e *GroupExpr) GetType() Type     { return e.Type }
-func (e *ProcedureExpr) GetType() Type { return e.Type }
-func (e *MemberExpr) GetType() Type    { return e.Type }
-func (l *NumberLiteral) GetType() Type { return l.Type }
-func (l *TextLiteral) GetType() Type   { return l.Type }
-func (i *Identifier) GetType() Type    { return i.Type }
+func (e *PostfixExpr) ImplementsExpr()    {}
+func (e *InfixExpr) ImplementsExpr()      {}
+func (e *ComparisonExpr) ImplementsExpr() {}
+func (r *ExprRange) ImplementsExpr()      {}
+func (e *PrefixExpr) ImplementsExpr()     {}
+func (e *CastExpr) ImplementsExpr()       {}
+func (e *RunExpr) ImplementsExpr()        {}
+func (e *CallExpr) ImplementsExpr()       {}
+func (e *GroupExpr) ImplementsExpr()      {}
+func (e *ProcedureExpr) ImplementsExpr()  {}
+func (e *MemberExpr) ImplementsExpr()     {}
+func (e *IndexExpr) ImplementsExpr()      {}
+func (e *VariadicExpr) ImplementsExpr()   {}
+func (e *TupleExpr) ImplementsExpr()      {}
+func (l *NumberLiteral) ImplementsExpr()  {}
+func (l *TextLiteral) ImplementsExpr()    {}
+func (l *CharLiteral) ImplementsExpr()    {}
+func (i *Identifier) ImplementsExpr()     {}
+
+func (e *PostfixExpr) GetType() Type    { return e.Type }
+func (e *InfixExpr) GetType() Type      { return e.Type }
+func (e *ComparisonExpr) GetType() Type { return e.Type }
+func (r *ExprRange) GetType() Type      { return r.Type }
+func (e *PrefixExpr) GetType() Type     { return e.Type }
+func (e *CastExpr) GetType() Type       { return e.Type }
+func (e *RunExpr) GetType() Type        { return e.Type }
+func (e *CallExpr) GetType() Type       { return e.Type }
+func (e *GroupExpr) GetType() Type      { return e.Type }
+func (e *ProcedureExpr) GetType() Type  { return e.Type }
+func (e *MemberExpr) GetType() Type     { return e.Type }
+func (e *IndexExpr) GetType() Type      { return e.Type }
+func (e *VariadicExpr) GetType() Type   { return e.Type }
+func (e *TupleExpr) GetType() Type      { return e.Type }
+func (l *NumberLiteral) GetType() Type  { return l.Type }
+func (l *TextLiteral) GetType() Type    { return l.Type }
+func (l *CharLiteral) GetType() Type    { return l.Type }
+func (i *Identifier) GetType() Type     { return i.Type }
 
 type Literal interface {
 	Expr
@@ -184,9 +233,11 @@ type Literal interface {
 
 func (l *NumberLiteral) ImplementsLiteral() {}
 func (l *TextLiteral) ImplementsLiteral()   {}
+func (l *CharLiteral) ImplementsLiteral()   {}
 
 func (l *NumberLiteral) GetValue() Value { return l.Value }
 func (l *TextLiteral) GetValue() Value   { return l.Value }
+func (l *CharLiteral) GetValue() Value   { return l.Value }
 
 type Type interface {
 	Node
@@ -194,17 +245,43 @@ type Type interface {
 	Print() string
 }
 
-func (t *ArrayType) ImplementsType()     {}
-func (t *ProcedureType) ImplementsType() {}
-func (t *NamedType) ImplementsType()     {}
-func (t *PointerType) ImplementsType()   {}
-func (t *BaseType) ImplementsType()      {}
+func (t *ArrayType) ImplementsType()       {}
+func (t *ProcedureType) ImplementsType()   {}
+func (t *NamedType) ImplementsType()       {}
+func (t *PointerType) ImplementsType()     {}
+func (t *RangeType) ImplementsType()       {}
+func (t *TupleType) ImplementsType()       {}
+func (t *PolymorphicType) ImplementsType() {}
+func (t *BaseType) ImplementsType()        {}
+
+func (t *ArrayType) Print() string       { return "[]" + t.Element.Print() }
+func (t *NamedType) Print() string       { return t.Name.Literal }
+func (t *PointerType) Print() string     { return "^" + t.PointerTo.Print() }
+func (t *RangeType) Print() string       { return t.Element.Print() + ".." + t.Element.Print() }
+func (t *BaseType) Print() string        { return t.Name }
+func (t *PolymorphicType) Print() string { return "$" + t.Name.Literal }
+
+func (t *ProcedureType) Print() string {
+	params := make([]string, len(t.Params))
+	for i, param := range t.Params {
+		params[i] = param.Print()
+	}
+	if t.Variadic && len(params) > 0 {
+		params[len(params)-1] = ".." + t.Params[len(params)-1].(*ArrayType).Element.Print()
+	}
+	if t.Return == nil {
+		return "(" + strings.Join(params, ", ") + ")"
+	}
+	return "(" + strings.Join(params, ", ") + ") -> " + t.Return.Print()
+}
 
-func (t *ArrayType) Print() string     { return "[]" + t.Element.Print() }
-func (t *ProcedureType) Print() string { return "()" /* TODO */ }
-func (t *NamedType) Print() string     { return t.Name.Literal }
-func (t *PointerType) Print() string   { return "^" + t.PointerTo.Print() }
-func (t *BaseType) Print() string      { return t.Name }
+func (t *TupleType) Print() string {
+	names := make([]string, len(t.Elements))
+	for i, el := range t.Elements {
+		names[i] = el.Print()
+	}
+	return "(" + strings.Join(names, ", ") + ")"
+}
 
 type EnumItem interface {
 	Node
@@ -279,9 +356,13 @@ type (
 		NodeBase
 
 		// syntax
-		Name *Identifier
-		Type Type // <-- also semantic right now
-		Expr Expr
+		Name     *Identifier
+		Type     Type // <-- also semantic right now
+		Expr     Expr
+		Variadic bool // the parameter is an array of the remaining arguments (eg. "args: ..int")
+
+		// semantics
+		Captured bool // used by a nested procedure
 	}
 )
 
@@ -355,7 +436,7 @@ type (
 		NodeBase
 
 		// syntax
-		Fields []StructField
+		Fields []*StructField
 	}
 
 	StructField struct {
@@ -371,6 +452,14 @@ func Constant(expr Expr) *ConstantDefn {
 	return &ConstantDefn{Expr: expr}
 }
 
+func Struct(fields []*StructField) *StructDefn {
+	return &StructDefn{Fields: fields}
+}
+
+func Field(name string, typ Type) *StructField {
+	return &StructField{Name: Ident(name), Type: typ}
+}
+
 func Operator(name string, lit string, ident string, typ OpType, asc OpAssociation, prec OpPrecedence) *OperatorDefn {
 	return &OperatorDefn{
 		Name:        name,
@@ -393,6 +482,33 @@ type (
 		Else *Block
 	}
 
+	// An IfDirective (eg. "#if OS == OS_LINUX { ... } #else { ... }") chooses
+	// one of its blocks during compilation; the other block is parsed, but its
+	// names aren't resolved and it isn't compiled.  The declarations of the
+	// chosen block belong to the enclosing scope.
+	IfDirective struct {
+		NodeBase
+
+		// syntax
+		Cond Expr
+		Then *Block
+		Else *Block // may be nil
+
+		// semantics
+		Chosen *Block // the block being compiled (nil until the condition is evaluated)
+	}
+
+	// An AssertDirective (eg. "#assert PAGE % 8 == 0, "misaligned page";") fails
+	// compilation if its condition is false.  The condition is evaluated after
+	// type inference, in the same way as a "#run" directive.
+	AssertDirective struct {
+		NodeBase
+
+		// syntax
+		Cond    *RunExpr
+		Message *TextLiteral // may be nil
+	}
+
 	WhileStmt struct {
 		NodeBase
 
@@ -427,12 +543,17 @@ type (
 		Range ExprRange
 	}
 
+	// An ExprRange is an inclusive range of values (eg. "0..10" includes 10)
 	ExprRange struct {
 		NodeBase
 
 		// syntax
 		Min Expr
 		Max Expr
+
+		// semantics
+		Type     Type
+		Compared Type // the type a value is cast to when checking if it is "in" the range
 	}
 
 	AssignStmt struct {
@@ -440,8 +561,11 @@ type (
 
 		// syntax
 		Left     []Expr
-		Operator *OperatorDefn
+		Operator *OperatorDefn // the operator of a compound assignment (eg. "+" in "a += 2")
 		Right    []Expr
+
+		// semantics
+		Operations []*InfixExpr // the value assigned to each name by a compound assignment
 	}
 
 	EvalStmt struct {
@@ -458,9 +582,28 @@ type (
 		Value Expr
 	}
 
+	// A DestructureStmt declares a name for each of the values returned by a
+	// procedure with multiple return values (eg. "x, ok := f();")
+	DestructureStmt struct {
+		NodeBase
+
+		// syntax
+		Decls []*MutableDecl
+		Expr  Expr
+	}
+
 	DoneStmt struct {
 		NodeBase
 	}
+
+	// A DeferStmt is a statement (or block) which is evaluated when its block
+	// exits, after any statements deferred later in the block (eg. "defer close(fd);")
+	DeferStmt struct {
+		NodeBase
+
+		// syntax
+		Stmt Evaluable
+	}
 )
 
 func If(cond Expr, then *Block, otherwise *Block) *IfStmt {
@@ -471,11 +614,34 @@ func If(cond Expr, then *Block, otherwise *Block) *IfStmt {
 	}
 }
 
+func IfDir(cond Expr, then *Block, otherwise *Block) *IfDirective {
+	return &IfDirective{
+		Cond: cond,
+		Then: then,
+		Else: otherwise,
+	}
+}
+
+func AssertDir(cond Expr, message *TextLiteral) *AssertDirective {
+	return &AssertDirective{
+		Cond:    RunExp(cond, nil),
+		Message: message,
+	}
+}
+
 func Assign(left []Expr, op *OperatorDefn, right []Expr) *AssignStmt {
+	var operations []*InfixExpr
+	if op != nil {
+		for i := 0; i < len(left) && i < len(right); i++ {
+			operations = append(operations, InExp(left[i], op, right[i]))
+		}
+	}
+
 	return &AssignStmt{
-		Left:     left,
-		Operator: op,
-		Right:    right,
+		Left:       left,
+		Operator:   op,
+		Right:      right,
+		Operations: operations,
 	}
 }
 
@@ -487,6 +653,26 @@ func Return(expr Expr) *ReturnStmt {
 	return &ReturnStmt{Value: expr}
 }
 
+func Defer(stmt Evaluable) *DeferStmt {
+	return &DeferStmt{Stmt: stmt}
+}
+
+func While(cond Expr, do *Block) *WhileStmt {
+	return &WhileStmt{Cond: cond, Do: do}
+}
+
+func Done() *DoneStmt {
+	return &DoneStmt{}
+}
+
+func Destructure(names []string, expr Expr) *DestructureStmt {
+	decls := make([]*MutableDecl, len(names))
+	for i, name := range names {
+		decls[i] = Mutable(name, nil, nil)
+	}
+	return &DestructureStmt{Decls: decls, Expr: expr}
+}
+
 // An expression is represented by a tree of one or more of the following
 type (
 	PostfixExpr struct {
@@ -497,7 +683,9 @@ type (
 		Operator *OperatorDefn
 
 		// semantics
-		Type Type
+		Type      Type
+		Overloads []Decl    // user-defined overloads visible from the expression
+		Call      *CallExpr // the call to an overload, if one was chosen
 	}
 
 	InfixExpr struct {
@@ -509,7 +697,25 @@ type (
 		Right    Expr
 
 		// semantics
-		Type Type
+		Type      Type
+		Overloads []Decl    // user-defined overloads visible from the expression
+		Call      *CallExpr // the call to an overload, if one was chosen
+		Compared  Type      // the type a value is compared as when checking if it is "in" an array or text
+	}
+
+	// A ComparisonExpr is a chain of one or more comparisons which share their
+	// operands (eg. "a < b <= c" compares "a < b" and then "b <= c").
+	ComparisonExpr struct {
+		NodeBase
+
+		// syntax
+		Operands  []Expr
+		Operators []*OperatorDefn
+
+		// semantics
+		Type        Type
+		Comparisons []*InfixExpr // the comparison of each pair of adjacent operands
+		Compared    []Type       // the type each pair of operands is compared as
 	}
 
 	PrefixExpr struct {
@@ -519,19 +725,54 @@ type (
 		Operator *OperatorDefn
 		Subexpr  Expr
 
+		// semantics
+		Type      Type
+		Overloads []Decl    // user-defined overloads visible from the expression
+		Call      *CallExpr // the call to an overload, if one was chosen
+	}
+
+	// A CastExpr explicitly converts a value to another type (eg. "cast(u8) x");
+	// a checked cast (eg. "cast?(u8) x") traps if the value is out of range.
+	CastExpr struct {
+		NodeBase
+
+		// syntax
+		Target  Type
+		Subexpr Expr
+		Checked bool
+
 		// semantics
 		Type Type
 	}
 
+	// A RunExpr is evaluated during compilation (eg. "#run fib(10)" or
+	// "#run { ... }"), and its result is spliced back into the tree as a literal.
+	RunExpr struct {
+		NodeBase
+
+		// syntax
+		Subexpr Expr   // either an expression
+		Block   *Block // or a block, which has the value of its last statement
+
+		// semantics
+		Type   Type
+		Ran    bool // whether the directive has been evaluated
+		Result Expr // the literal value of the directive (nil if it has no value)
+	}
+
 	CallExpr struct {
 		NodeBase
 
 		// syntax
 		Procedure Expr
 		Arguments []Expr
+		Names     []*Identifier // the name of each named argument (eg. "msg = "x""), or nil if positional
+		Spread    bool          // the last argument is an array spread into a variadic parameter (eg. "f(..args)")
 
 		// semantics
-		Type Type
+		Type     Type
+		Bound    []Expr         // the argument for each parameter, which is the parameter's default if omitted
+		Instance *ProcedureExpr // the instance called, if the procedure is polymorphic
 	}
 
 	ProcedureExpr struct {
@@ -543,7 +784,10 @@ type (
 		Block  *Block
 
 		// semantics
-		Type Type
+		Type      Type
+		Captures  []*MutableDecl   // the variables of enclosing procedures used by the procedure
+		Instances []*ProcedureExpr // the copies of a polymorphic procedure for each set of type arguments
+		TypeArgs  []Type           // the types of the type parameters, for an instance of a polymorphic procedure
 	}
 
 	GroupExpr struct {
@@ -567,6 +811,40 @@ type (
 		Type Type
 	}
 
+	// An IndexExpr is an element of an array (eg. "args[0]")
+	IndexExpr struct {
+		NodeBase
+
+		// syntax
+		Left  Expr
+		Index Expr
+
+		// semantics
+		Type Type
+	}
+
+	// A VariadicExpr is the array of the arguments given to a variadic parameter
+	// (eg. "2, 3" in "sum(1, 2, 3)"); it is created when binding the arguments
+	// of a call, so it doesn't appear in the syntax tree.
+	VariadicExpr struct {
+		NodeBase
+
+		// semantics
+		Elements []Expr
+		Type     Type
+	}
+
+	// A TupleExpr is a list of values (eg. "x, ok" in "return x, ok;")
+	TupleExpr struct {
+		NodeBase
+
+		// syntax
+		Elements []Expr
+
+		// semantics
+		Type Type
+	}
+
 	NumberLiteral struct {
 		NodeBase
 
@@ -589,6 +867,17 @@ type (
 		Value Value
 	}
 
+	CharLiteral struct {
+		NodeBase
+
+		// syntax
+		Literal string
+
+		// semantics
+		Type  Type
+		Value Value
+	}
+
 	Identifier struct {
 		NodeBase
 
@@ -620,6 +909,28 @@ func InExp(left Expr, op *OperatorDefn, right Expr) *InfixExpr {
 	}
 }
 
+func CmpExp(operands []Expr, ops []*OperatorDefn) *ComparisonExpr {
+	comparisons := make([]*InfixExpr, len(ops))
+	for i, op := range ops {
+		comparisons[i] = InExp(operands[i], op, operands[i+1])
+	}
+
+	return &ComparisonExpr{
+		Operands:    operands,
+		Operators:   ops,
+		Type:        UninferredType,
+		Comparisons: comparisons,
+	}
+}
+
+func RangeExp(min Expr, max Expr) *ExprRange {
+	return &ExprRange{
+		Min:  min,
+		Max:  max,
+		Type: UninferredType,
+	}
+}
+
 func PreExp(op *OperatorDefn, subexpr Expr) *PrefixExpr {
 	return &PrefixExpr{
 		Operator: op,
@@ -628,6 +939,23 @@ func PreExp(op *OperatorDefn, subexpr Expr) *PrefixExpr {
 	}
 }
 
+func CastExp(target Type, subexpr Expr, checked bool) *CastExpr {
+	return &CastExpr{
+		Target:  target,
+		Subexpr: subexpr,
+		Checked: checked,
+		Type:    UninferredType,
+	}
+}
+
+func RunExp(subexpr Expr, block *Block) *RunExpr {
+	return &RunExpr{
+		Subexpr: subexpr,
+		Block:   block,
+		Type:    UninferredType,
+	}
+}
+
 func CallExp(proc Expr, args []Expr) *CallExpr {
 	return &CallExpr{
 		Procedure: proc,
@@ -656,6 +984,14 @@ func Param(name string, typ Type) *MutableDecl {
 	}
 }
 
+func VarParam(name string, element Type) *MutableDecl {
+	return &MutableDecl{
+		Name:     Ident(name),
+		Type:     ArrTyp(element, nil),
+		Variadic: true,
+	}
+}
+
 func GrpExp(subexpr Expr) *GroupExpr {
 	return &GroupExpr{
 		Subexpr: subexpr,
@@ -671,6 +1007,21 @@ func GetExp(left Expr, member string) *MemberExpr {
 	}
 }
 
+func IdxExp(left Expr, index Expr) *IndexExpr {
+	return &IndexExpr{
+		Left:  left,
+		Index: index,
+		Type:  UninferredType,
+	}
+}
+
+func TupleExp(elements []Expr) *TupleExpr {
+	return &TupleExpr{
+		Elements: elements,
+		Type:     UninferredType,
+	}
+}
+
 func NumLit(literal string) *NumberLiteral {
 	return &NumberLiteral{
 		Literal: literal,
@@ -687,6 +1038,14 @@ func TxtLit(literal string) *TextLiteral {
 	}
 }
 
+func CharLit(literal string) *CharLiteral {
+	return &CharLiteral{
+		Literal: literal,
+		Value:   UnparsedValue,
+		Type:    UninferredType,
+	}
+}
+
 func Ident(literal string) *Identifier {
 	return &Identifier{
 		Literal: literal,
@@ -704,12 +1063,15 @@ type (
 		Element Type
 	}
 
+	// A ProcedureType is the type of a procedure used as a value (eg. "(int) -> int");
+	// the return type is nil for a procedure which doesn't return a value
 	ProcedureType struct {
 		NodeBase
 
 		// syntax
-		Params []Type
-		Return Type
+		Params   []Type
+		Return   Type
+		Variadic bool // the last parameter is an array of the remaining arguments (eg. "(..int)")
 	}
 
 	NamedType struct {
@@ -726,6 +1088,30 @@ type (
 		PointerTo Type
 	}
 
+	RangeType struct {
+		NodeBase
+
+		// semantics
+		Element Type
+	}
+
+	// A TupleType is the type of multiple return values (eg. "(int, bool)")
+	TupleType struct {
+		NodeBase
+
+		// syntax
+		Elements []Type
+	}
+
+	// A PolymorphicType declares a type parameter of a procedure (eg. "$T"),
+	// which is bound to a type by the arguments of each call
+	PolymorphicType struct {
+		NodeBase
+
+		// syntax
+		Name *Identifier
+	}
+
 	BaseType struct {
 		NodeBase
 		Name string
@@ -744,6 +1130,22 @@ func PtrTyp(pointerTo Type) *PointerType {
 	return &PointerType{PointerTo: pointerTo}
 }
 
+func RangeTyp(el Type) *RangeType {
+	return &RangeType{Element: el}
+}
+
+func ProcTyp(params []Type, ret Type) *ProcedureType {
+	return &ProcedureType{Params: params, Return: ret}
+}
+
+func PolyTyp(name string) *PolymorphicType {
+	return &PolymorphicType{Name: Ident(name)}
+}
+
+func TupleTyp(elements []Type) *TupleType {
+	return &TupleType{Elements: elements}
+}
+
 func BaseTyp(name string) *BaseType {
 	typ := &BaseType{Name: name}
 	BuiltinTypes[name] = typ
@@ -0,0 +1,13 @@
+package ast
+
+// SetConstant records the compile-time value of an expression; an expression
+// has a value once it has been folded at compile-time.
+func SetConstant(expr Expr, value Value) {
+	expr.base().constant = value
+}
+
+// ConstantOf returns the compile-time value of an expression, if it has one.
+func ConstantOf(expr Expr) (Value, bool) {
+	value := expr.base().constant
+	return value, value != nil
+}
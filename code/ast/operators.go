@@ -68,3 +68,9 @@ const (
 	PostfixPrec      OpPrecedence = 120
 	MaxPrecedence    OpPrecedence = 127
 )
+
+// IsOverloadName reports whether a name is the name of an operator overload
+// (eg. "_add_", "neg_", or "_seconds") rather than an ordinary identifier.
+func IsOverloadName(name string) bool {
+	return len(name) > 1 && (name[0] == '_' || name[len(name)-1] == '_')
+}
@@ -0,0 +1,137 @@
+package ast
+
+import "reflect"
+
+// IsPolymorphic reports whether a procedure has type parameters (eg. "$T");
+// a polymorphic procedure is copied for each set of types it is called with.
+func IsPolymorphic(proc *ProcedureExpr) bool {
+	return len(TypeParameters(proc)) > 0
+}
+
+// TypeParameters returns the names of the type parameters of a procedure, in
+// the order that they are declared.
+func TypeParameters(proc *ProcedureExpr) []string {
+	var names []string
+	for _, param := range proc.Params {
+		names = appendTypeParameters(names, param.Type)
+	}
+	return appendTypeParameters(names, proc.Return)
+}
+
+func appendTypeParameters(names []string, typ Type) []string {
+	switch t := typ.(type) {
+	case *PolymorphicType:
+		for _, name := range names {
+			if name == t.Name.Literal {
+				return names
+			}
+		}
+		return append(names, t.Name.Literal)
+	case *ArrayType:
+		return appendTypeParameters(names, t.Element)
+	case *PointerType:
+		return appendTypeParameters(names, t.PointerTo)
+	case *TupleType:
+		for _, element := range t.Elements {
+			names = appendTypeParameters(names, element)
+		}
+	case *ProcedureType:
+		for _, param := range t.Params {
+			names = appendTypeParameters(names, param)
+		}
+		if t.Return != nil {
+			names = appendTypeParameters(names, t.Return)
+		}
+	}
+	return names
+}
+
+// Substitute copies a tree, replacing each use of a type parameter (eg. "$T"
+// or "T") with its type; the copy has the same positions as the original.
+//
+// Only the syntax of the tree is copied, so the tree shouldn't have been
+// resolved or inferred yet (eg. the body of a polymorphic procedure).
+func Substitute(node Node, types map[string]Type) Node {
+	s := substitution{types: types, copies: make(map[Node]Node)}
+	return s.copy(reflect.ValueOf(node)).Interface().(Node)
+}
+
+type substitution struct {
+	types  map[string]Type
+	copies map[Node]Node // nodes shared in the tree are shared in the copy (eg. compound assignments)
+}
+
+var (
+	nodeBaseType = reflect.TypeOf(NodeBase{})
+	nodeType     = reflect.TypeOf((*Node)(nil)).Elem()
+)
+
+func (s *substitution) copy(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		copied := reflect.New(v.Type()).Elem()
+		copied.Set(s.copy(v.Elem()))
+		return copied
+
+	case reflect.Ptr:
+		if v.IsNil() || !v.Type().Implements(nodeType) {
+			return v
+		}
+		node := v.Interface().(Node)
+		switch n := node.(type) {
+		case *BaseType, *OperatorDefn:
+			return v // builtins are shared
+		case *PolymorphicType:
+			if typ, ok := s.types[n.Name.Literal]; ok {
+				return reflect.ValueOf(typ)
+			}
+		case *NamedType:
+			if typ, ok := s.types[n.Name.Literal]; ok {
+				return reflect.ValueOf(typ)
+			}
+		}
+		if copied, ok := s.copies[node]; ok {
+			return reflect.ValueOf(copied)
+		}
+
+		copied := reflect.New(v.Type().Elem())
+		s.copies[node] = copied.Interface().(Node)
+		copied.Interface().(Node).base().pos = node.base().pos
+		for i := 0; i < v.Elem().NumField(); i++ {
+			field := v.Elem().Field(i)
+			if field.Type() != nodeBaseType { // the parent is set when the copy is flattened
+				copied.Elem().Field(i).Set(s.copy(field))
+			}
+		}
+		if _, ok := node.(*ProcedureExpr); ok {
+			instance := copied.Interface().(*ProcedureExpr)
+			instance.Type = UninferredType
+			instance.Instances = nil
+			instance.TypeArgs = nil
+		}
+		return copied
+
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		copied := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			copied.Index(i).Set(s.copy(v.Index(i)))
+		}
+		return copied
+
+	case reflect.Struct:
+		copied := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.NumField(); i++ {
+			copied.Field(i).Set(s.copy(v.Field(i)))
+		}
+		return copied
+
+	default:
+		return v
+	}
+}
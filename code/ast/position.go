@@ -0,0 +1,20 @@
+package ast
+
+import "github.com/kestred/philomath/code/token"
+
+// SetPosition records where a node was found in its source text.
+func SetPosition(node Node, pos token.Position) {
+	node.base().pos = pos
+}
+
+// PositionOf returns the source position of a node, or of its nearest parent
+// with a known position if the node was synthesized after parsing.
+func PositionOf(node Node) token.Position {
+	for node != nil {
+		if pos := node.base().pos; pos.IsValid() {
+			return pos
+		}
+		node = node.GetParent()
+	}
+	return token.Position{}
+}
@@ -0,0 +1,27 @@
+package ast
+
+// StructOf returns the definition of a named struct type (eg. "S" declared by
+// "S :: struct { ... }"), or nil if the type isn't a struct.
+func StructOf(typ Type) *StructDefn {
+	named, ok := typ.(*NamedType)
+	if !ok {
+		return nil
+	}
+	decl, ok := named.Name.Decl.(*ImmutableDecl)
+	if !ok {
+		return nil
+	}
+	defn, _ := decl.Defn.(*StructDefn)
+	return defn
+}
+
+// FieldIndex returns the position of the field with a name in a struct, or -1
+// if the struct has no such field.
+func FieldIndex(defn *StructDefn, name string) int {
+	for i, field := range defn.Fields {
+		if field.Name.Literal == name {
+			return i
+		}
+	}
+	return -1
+}
@@ -10,6 +10,7 @@ import (
 	"unsafe"
 
 	"github.com/kestred/philomath/code/ast"
+	"github.com/kestred/philomath/code/token"
 	"github.com/kestred/philomath/code/utils"
 )
 
@@ -44,6 +45,12 @@ const (
 	// Float128
 	// Float256
 	Pointer
+	Bool
+	Tuple    // multiple values (eg. the result of a procedure with multiple return values)
+	Array    // a view of the elements of an array (eg. the arguments of a variadic parameter)
+	Text     // a pointer to the data of some text, and its length in bytes
+	Callable // a procedure and the cells of any variables that it captures
+	Cell     // a reference to a variable shared by nested procedures
 )
 
 func (t Type) String() string {
@@ -72,6 +79,18 @@ func (t Type) String() string {
 		return "Float64"
 	case Pointer:
 		return "Pointer"
+	case Bool:
+		return "Bool"
+	case Tuple:
+		return "Tuple"
+	case Array:
+		return "Array"
+	case Text:
+		return "Text"
+	case Callable:
+		return "Callable"
+	case Cell:
+		return "Cell"
 	default:
 		return fmt.Sprintf("Type(%d)", t)
 	}
@@ -86,18 +105,61 @@ const (
 	LOAD  // move from pointer to register
 	STORE // move from register to pointer
 
+	PACK   // combine multiple registers into a tuple (or an array)
+	UNPACK // split a tuple into multiple registers
+	INDEX  // move an element of an array (or a byte of text) to a register
+	COUNT  // the number of elements in an array (or bytes in text)
+
+	TEXT   // combine a pointer and a length into text
+	DATA   // the pointer to the data of text
+	CONCAT // copy two texts into a new buffer
+	DECODE // the character which starts at a byte of text (or -1, if none does)
+
+	CELL       // allocate a cell containing the value of a register
+	LOAD_CELL  // move from cell to register
+	STORE_CELL // move from register to cell
+
 	CALL
+	CALL_INDIRECT // call the procedure in a register
 	CALL_ASM
 	RETURN
 
+	JUMP       // continue from another instruction
+	JUMP_TRUE  // continue from another instruction if a register is true
+	JUMP_FALSE // continue from another instruction if a register is false
+
 	ADD
 	SUBTRACT
 	MULTIPLY
 	DIVIDE
-
+	REMAINDER
+	NEGATE
+
+	BIT_AND
+	BIT_OR
+	BIT_XOR
+	BIT_NOT
+	SHIFT_LEFT
+	SHIFT_RIGHT // arithmetic for signed registers, logical for unsigned registers
+
+	EQUAL
+	LESS
+	LESS_EQUAL
+	GREATER
+	GREATER_EQUAL
+	NOT
+
+	CAST_I8
+	CAST_I16
+	CAST_I32
 	CAST_I64
+	CAST_U8
+	CAST_U16
+	CAST_U32
 	CAST_U64
+	CAST_F32
 	CAST_F64
+	CAST_CHECKED // cast to the type of the output register, trapping if the value is out of range
 )
 
 var opcodes = [...]string{
@@ -108,18 +170,62 @@ var opcodes = [...]string{
 	LOAD:  "Load",
 	STORE: "Store",
 
-	CALL:     "Call procedure",
-	CALL_ASM: "Call assembly",
-	RETURN:   "Return",
-
-	ADD:      "Addition",
-	SUBTRACT: "Subtraction",
-	MULTIPLY: "Multiplication",
-	DIVIDE:   "Division",
-
-	CAST_I64: "Cast to signed",
-	CAST_U64: "Cast to unsigned",
-	CAST_F64: "Cast to float",
+	PACK:   "Pack tuple",
+	UNPACK: "Unpack tuple",
+	INDEX:  "Index array",
+	COUNT:  "Count array",
+
+	TEXT:   "Make text",
+	DATA:   "Text data",
+	CONCAT: "Concatenate text",
+	DECODE: "Decode character",
+
+	CELL:       "Allocate cell",
+	LOAD_CELL:  "Load cell",
+	STORE_CELL: "Store cell",
+
+	CALL:          "Call procedure",
+	CALL_INDIRECT: "Call procedure value",
+	CALL_ASM:      "Call assembly",
+	RETURN:        "Return",
+
+	JUMP:       "Jump",
+	JUMP_TRUE:  "Jump if true",
+	JUMP_FALSE: "Jump if false",
+
+	ADD:       "Addition",
+	SUBTRACT:  "Subtraction",
+	MULTIPLY:  "Multiplication",
+	DIVIDE:    "Division",
+	REMAINDER: "Remainder",
+	NEGATE:    "Negation",
+
+	BIT_AND:     "Bitwise and",
+	BIT_OR:      "Bitwise or",
+	BIT_XOR:     "Bitwise xor",
+	BIT_NOT:     "Bitwise not",
+	SHIFT_LEFT:  "Shift left",
+	SHIFT_RIGHT: "Shift right",
+
+	EQUAL:         "Equal",
+	LESS:          "Less",
+	LESS_EQUAL:    "Less or equal",
+	GREATER:       "Greater",
+	GREATER_EQUAL: "Greater or equal",
+	NOT:           "Logical not",
+
+	CAST_I8:  "Cast to signed 8-bit",
+	CAST_I16: "Cast to signed 16-bit",
+	CAST_I32: "Cast to signed 32-bit",
+	CAST_I64: "Cast to signed 64-bit",
+	CAST_U8:  "Cast to unsigned 8-bit",
+	CAST_U16: "Cast to unsigned 16-bit",
+	CAST_U32: "Cast to unsigned 32-bit",
+	CAST_U64: "Cast to unsigned 64-bit",
+	CAST_F32: "Cast to float 32-bit",
+	CAST_F64: "Cast to float 64-bit",
+
+	CAST_CHECKED: "Checked cast",
 }
 
 func (op Opcode) String() string {
@@ -139,6 +245,39 @@ func Pack(v interface{}) []byte {
 	return buf.Bytes()
 }
 
+// packNumber packs the value of a number literal at the width of its type
+// (eg. "255u8" is one byte).
+func packNumber(value interface{}, typ Type) []byte {
+	if f, ok := value.(float64); ok {
+		if typ == Float32 {
+			return Pack(float32(f))
+		}
+		return Pack(f)
+	}
+
+	var i uint64
+	switch v := value.(type) {
+	case int64:
+		i = uint64(v)
+	case uint64:
+		i = v
+	}
+	switch typ {
+	case Int8, Uint8:
+		return Pack(uint8(i))
+	case Int16, Uint16:
+		return Pack(uint16(i))
+	case Int32, Uint32:
+		return Pack(uint32(i))
+	case Float32:
+		return Pack(float32(i))
+	case Float64:
+		return Pack(float64(i))
+	default:
+		return Pack(i)
+	}
+}
+
 func Unpack(b []byte, v interface{}) error {
 	if reflect.TypeOf(v).Kind() != reflect.Ptr {
 		return errors.New("can't unpack register into non-pointer type")
@@ -191,6 +330,23 @@ func Binary(left, right, out Register) BinaryArgs {
 	return BinaryArgs{Left: left, Right: right, Out: out}
 }
 
+type JumpArgs struct {
+	Cond   Register // unused by an unconditional jump
+	Target int      // the index of the next instruction
+}
+
+func Jump(target int) JumpArgs {
+	return JumpArgs{Cond: Rg(-1, None), Target: target}
+}
+
+func JumpTrue(cond Register, target int) JumpArgs {
+	return JumpArgs{Cond: cond, Target: target}
+}
+
+func JumpFalse(cond Register, target int) JumpArgs {
+	return JumpArgs{Cond: cond, Target: target}
+}
+
 type ConstantArgs struct {
 	Name string
 	Out  Register
@@ -217,23 +373,48 @@ type AssemblyArgs struct {
 	InputRegisters []Register
 }
 
+type TupleArgs struct {
+	Tuple    Register
+	Elements []Register
+}
+
+func Tup(tuple Register, elements []Register) TupleArgs {
+	return TupleArgs{Tuple: tuple, Elements: elements}
+}
+
 type ProcedureArgs struct {
-	Proc Procedure
+	Proc *Procedure
 	Out  Register
 	In   []Register
 }
 
-func Proc(proc Procedure, out Register, in []Register) ProcedureArgs {
+func Proc(proc *Procedure, out Register, in []Register) ProcedureArgs {
 	return ProcedureArgs{Proc: proc, Out: out, In: in}
 }
 
+type IndirectArgs struct {
+	Proc Register
+	Out  Register
+	In   []Register
+}
+
+func Indirect(proc Register, out Register, in []Register) IndirectArgs {
+	return IndirectArgs{Proc: proc, Out: out, In: in}
+}
+
 type Program struct {
 	Bss        map[string]int // map string to reserved size
 	Data       map[string][]byte
 	Text       map[string]int // map to Procedure index
-	Procedures []Procedure
+	Procedures []*Procedure
+
+	// Checked programs trap on integer overflow, out of range shift counts, and lossy implicit conversions
+	Checked bool
 
 	nextConstantId int
+	constantIds    map[ast.Decl]string        // map to the data of a folded constant
+	procedureIds   map[*ast.ProcedureExpr]int // map to Procedure index
+	directiveIds   map[*ast.RunExpr]int       // map to Procedure index
 }
 
 func NewProgram() *Program {
@@ -241,7 +422,10 @@ func NewProgram() *Program {
 	prog.Bss = map[string]int{}
 	prog.Data = map[string][]byte{}
 	prog.Text = map[string]int{"start_": 0}
-	prog.NewProcedure() // start_
+	prog.constantIds = map[ast.Decl]string{}
+	prog.procedureIds = map[*ast.ProcedureExpr]int{}
+	prog.directiveIds = map[*ast.RunExpr]int{}
+	prog.NewProcedure().Name = "start_"
 	return prog
 }
 
@@ -249,6 +433,34 @@ func (p *Program) Extend(node ast.Node) {
 	p.Procedures[0].Extend(node)
 }
 
+// Directive returns the procedure which evaluates a "#run" directive, if
+// bytecode has been generated for the directive.
+func (p *Program) Directive(run *ast.RunExpr) (*Procedure, bool) {
+	index, ok := p.directiveIds[run]
+	if !ok {
+		return nil, false
+	}
+	return p.Procedures[index], true
+}
+
+// directive returns the procedure which evaluates a "#run" directive,
+// generating its bytecode the first time that it is used.
+func (p *Program) directive(run *ast.RunExpr) *Procedure {
+	if proc, exists := p.Directive(run); exists {
+		return proc
+	}
+
+	proc := p.NewProcedure()
+	proc.Name = "#run"
+	p.directiveIds[run] = proc.Index
+	if run.Block != nil {
+		proc.Extend(run.Block)
+	} else {
+		proc.Extend(run.Subexpr)
+	}
+	return proc
+}
+
 func (p *Program) DefineBss(name string, size int) {
 	p.Bss[name] = size
 }
@@ -257,6 +469,24 @@ func (p *Program) DefineData(name string, data []byte) {
 	p.Data[name] = data
 }
 
+// constantData returns the name of the data for a folded constant; the data
+// for a named constant is only defined once, no matter how often it is used.
+func (p *Program) constantData(expr ast.Expr, value ast.Value) string {
+	ident, named := expr.(*ast.Identifier)
+	if named {
+		if name, exists := p.constantIds[ident.Decl]; exists {
+			return name
+		}
+	}
+
+	name := p.NextConstantName()
+	p.DefineData(name, Pack(value))
+	if named {
+		p.constantIds[ident.Decl] = name
+	}
+	return name
+}
+
 func (p *Program) NextConstantName() string {
 	p.nextConstantId += 1
 	return ".LC" + strconv.Itoa(p.nextConstantId)
@@ -264,7 +494,7 @@ func (p *Program) NextConstantName() string {
 
 func (p *Program) NewProcedure() *Procedure {
 	next := len(p.Procedures)
-	p.Procedures = append(p.Procedures, Procedure{
+	p.Procedures = append(p.Procedures, &Procedure{
 		Index:        next,
 		Program:      p,
 		Instructions: []Instruction{},
@@ -272,23 +502,67 @@ func (p *Program) NewProcedure() *Procedure {
 		PrevResult:   Rg(-1, None),
 		NextFree:     +0,
 	})
-	return &p.Procedures[next]
+	return p.Procedures[next]
+}
+
+// loopExits are the jumps which leave a loop (eg. for "done"), which are
+// patched once the end of the loop is known.
+type loopExits struct {
+	frame int   // the deferred statements of the loop's block
+	jumps []int // the instructions which jump to the end of the loop
 }
 
 type Procedure struct {
+	Name         string
 	Index        int
 	Program      *Program
 	Instructions []Instruction
+	Positions    []token.Position // the source of each instruction
 
 	// state for bytecode generation
 	Registers  map[ast.Decl]Register
-	PrevResult Register // last result
-	NextFree   Location // next assignable location
-
-	Arguments []Register
+	PrevResult Register           // last result
+	NextFree   Location           // next assignable location
+	current    ast.Node           // the node which instructions are being generated for
+	returns    ast.Type           // the declared return type
+	deferred   [][]*ast.DeferStmt // the deferred statements of each enclosing block, innermost last
+	loops      []loopExits        // the exits of each enclosing loop, innermost last
+
+	Arguments []Register // the parameters, followed by the cells of captured variables
 }
 
 func (p *Procedure) Extend(node ast.Node) {
+	// each instruction is attributed to the innermost node that generated it
+	p.attributeInstructions(p.current)
+	outer := p.current
+	p.current = node
+	p.extend(node)
+	p.attributeInstructions(node)
+	p.current = outer
+}
+
+func (p *Procedure) attributeInstructions(node ast.Node) {
+	var pos token.Position
+	if node != nil {
+		pos = ast.PositionOf(node)
+	}
+	for len(p.Positions) < len(p.Instructions) {
+		p.Positions = append(p.Positions, pos)
+	}
+}
+
+func (p *Procedure) extend(node ast.Node) {
+	// constant expressions are loaded directly, instead of being evaluated
+	if expr, ok := node.(ast.Expr); ok {
+		if value, ok := ast.ConstantOf(expr); ok {
+			register := Rg(p.AssignLocation(), TypeFromAst(expr.GetType()))
+			name := p.Program.constantData(expr, value)
+			p.Instructions = append(p.Instructions, Inst(LOAD, Constant(name, register)))
+			p.PrevResult = register
+			return
+		}
+	}
+
 	endRegister := Rg(0, None)
 	switch n := node.(type) {
 	case *ast.TopScope:
@@ -297,10 +571,39 @@ func (p *Procedure) Extend(node ast.Node) {
 		}
 
 	case *ast.Block:
+		p.deferred = append(p.deferred, nil)
 		for _, subnode := range n.Nodes {
 			p.Extend(subnode)
 		}
 
+		// a block which ends with "return" (or "done") has already evaluated its
+		// deferred statements; otherwise they are evaluated after the value of the block
+		frame := len(p.deferred) - 1
+		if len(p.deferred[frame]) > 0 && !exitsBlock(n.Nodes[len(n.Nodes)-1]) {
+			value := p.PrevResult
+			p.extendDeferred(frame)
+			if _, ok := n.Nodes[len(n.Nodes)-1].(*ast.EvalStmt); ok && value.Loc >= 0 {
+				out := Rg(p.AssignLocation(), value.Typ)
+				p.Instructions = append(p.Instructions, Inst(COPY, Unary(value, out)))
+				endRegister = out
+			}
+		}
+		p.deferred = p.deferred[:frame]
+
+	case *ast.IfDirective:
+		utils.Assert(n.Chosen != nil, `An unevaluated "#if" survived until bytecode generation`)
+		// the chosen block belongs to the enclosing block (including its deferred statements)
+		for _, subnode := range n.Chosen.Nodes {
+			p.Extend(subnode)
+		}
+
+	case *ast.AssertDirective:
+		// an assertion is only evaluated during compilation, so its condition
+		// is never called at runtime
+		if !n.Cond.Ran {
+			p.Program.directive(n.Cond)
+		}
+
 	case *ast.AsmBlock:
 		asm := new(AssemblyArgs)
 		asm.Source = n.Source
@@ -310,8 +613,22 @@ func (p *Procedure) Extend(node ast.Node) {
 			decl := binding.Name.Decl
 			utils.Assert(decl != nil, "An unresolved identifier survived until bytecode generation")
 
+			// constants don't have a register, so load them before the assembly
+			if imm, ok := decl.(*ast.ImmutableDecl); ok {
+				if defn, ok := imm.Defn.(*ast.ConstantDefn); ok {
+					if _, ok := ast.ConstantOf(defn.Expr); ok {
+						p.Extend(defn.Expr)
+						asm.InputRegisters[i] = p.PrevResult
+						continue
+					}
+				}
+			}
+
 			reg, exists := p.Registers[decl]
 			utils.Assert(exists, "A register was not allocated for a declaration before use in inline assembly")
+			if reg.Typ == Cell {
+				reg = p.loadCell(reg, decl.(*ast.MutableDecl).Type)
+			}
 
 			asm.InputRegisters[i] = reg
 		}
@@ -324,6 +641,9 @@ func (p *Procedure) Extend(node ast.Node) {
 
 			reg, exists := p.Registers[decl]
 			utils.Assert(exists, "A register was not allocated for a declaration before use in inline assembly")
+			if reg.Typ == Cell {
+				utils.NotImplemented("bytecode generation for a captured variable as the output of inline assembly")
+			}
 
 			asm.OutputRegister = reg
 			asm.OutputBinding = binding
@@ -335,53 +655,134 @@ func (p *Procedure) Extend(node ast.Node) {
 
 	case *ast.ImmutableDecl:
 		if defn, ok := n.Defn.(*ast.ConstantDefn); ok {
+			if _, ok := ast.ConstantOf(defn.Expr); ok {
+				break // the value is loaded wherever the constant is used
+			}
 			p.Extend(defn.Expr)
-			p.Registers[n] = p.PrevResult
+			if _, ok := defn.Expr.(*ast.ProcedureExpr); !ok {
+				p.Registers[n] = p.PrevResult
+			}
 		}
 
 	case *ast.MutableDecl:
 		if n.Expr != nil {
 			p.Extend(n.Expr)
-			p.Registers[n] = p.PrevResult
+			p.insertCast(p.PrevResult, n.Expr.GetType(), n.Type)
+			p.declare(n, p.PrevResult)
 		} else {
-			p.Registers[n] = Rg(p.AssignLocation(), typeFromAst(n.Expr.GetType()))
+			p.Registers[n] = Rg(p.AssignLocation(), TypeFromAst(n.Type))
 			utils.NotImplemented("bytecode generation for declaration without initialization")
 		}
 
 	case *ast.EvalStmt:
 		p.Extend(n.Expr)
+		endRegister = p.PrevResult // the value of a block (see Block)
 
 	case *ast.ReturnStmt:
-		// FIXME: because of the current hack used for return values "return" only works if it is the last item in the function!
-		p.Extend(n.Value)
+		value := Rg(-1, None)
+		if tuple, ok := n.Value.(*ast.TupleExpr); ok {
+			p.extendTuple(tuple.Elements, p.returns)
+			value = p.PrevResult
+		} else if n.Value != nil {
+			p.Extend(n.Value)
+			value = p.PrevResult
+		}
+
+		// the deferred statements of every enclosing block are evaluated after
+		// the value, so the value is copied in case they change it
+		if p.hasDeferred() {
+			if value.Loc >= 0 {
+				out := Rg(p.AssignLocation(), value.Typ)
+				p.Instructions = append(p.Instructions, Inst(COPY, Unary(value, out)))
+				value = out
+			}
+			p.extendDeferred(0)
+		}
+		p.Instructions = append(p.Instructions, Inst(RETURN, Nullary(value)))
+
+	case *ast.DeferStmt:
+		frame := len(p.deferred) - 1
+		utils.Assert(frame >= 0, "A deferred statement outside of a block survived until bytecode generation")
+		p.deferred[frame] = append(p.deferred[frame], n)
+
+	case *ast.WhileStmt:
+		start := len(p.Instructions)
+		p.Extend(n.Cond)
+		exits := []int{len(p.Instructions)}
+		p.Instructions = append(p.Instructions, Inst(JUMP_FALSE, JumpFalse(p.PrevResult, -1)))
+
+		p.loops = append(p.loops, loopExits{frame: len(p.deferred)})
+		p.Extend(n.Do)
+		p.Instructions = append(p.Instructions, Inst(JUMP, Jump(start)))
+		exits = append(exits, p.loops[len(p.loops)-1].jumps...)
+		p.loops = p.loops[:len(p.loops)-1]
+
+		for _, exit := range exits {
+			args := p.Instructions[exit].Args.(JumpArgs)
+			args.Target = len(p.Instructions)
+			p.Instructions[exit].Args = args
+		}
+
+	case *ast.DoneStmt:
+		// the deferred statements of the loop's blocks are evaluated before leaving it
+		utils.Assert(len(p.loops) > 0, `A "done" outside of a loop survived until bytecode generation`)
+		p.extendDeferred(p.loops[len(p.loops)-1].frame)
+		loop := &p.loops[len(p.loops)-1]
+		loop.jumps = append(loop.jumps, len(p.Instructions))
+		p.Instructions = append(p.Instructions, Inst(JUMP, Jump(-1)))
+
+	case *ast.DestructureStmt:
+		p.Extend(n.Expr)
+		tuple := p.PrevResult
+		elements := make([]Register, len(n.Decls))
+		for i, decl := range n.Decls {
+			elements[i] = Rg(p.AssignLocation(), TypeFromAst(decl.Type))
+		}
+		p.Instructions = append(p.Instructions, Inst(UNPACK, Tup(tuple, elements)))
+		for i, decl := range n.Decls {
+			p.declare(decl, elements[i])
+		}
 
 	case *ast.AssignStmt:
-		utils.Assert(len(n.Left) == len(n.Right), "An unbalanced assignment survived until bytecode generation")
+		// a multiple assignment from a tuple (eg. "a, b = f()")
+		if len(n.Left) > 1 && len(n.Right) == 1 {
+			tupleType, ok := n.Right[0].GetType().(*ast.TupleType)
+			utils.Assert(ok, "An unbalanced assignment survived until bytecode generation")
 
-		// simple assignment
-		if len(n.Right) == 1 {
 			p.Extend(n.Right[0])
-			rhs := p.PrevResult
+			tuple := p.PrevResult
+			tmps := make([]Register, len(n.Left))
+			for i, typ := range tupleType.Elements {
+				tmps[i] = Rg(p.AssignLocation(), TypeFromAst(typ))
+			}
+			p.Instructions = append(p.Instructions, Inst(UNPACK, Tup(tuple, tmps)))
+			for i, expr := range n.Left {
+				p.assignRegister(expr, tmps[i], tupleType.Elements[i])
+			}
+			return
+		}
 
-			if expr, ok := n.Left[0].(*ast.Identifier); ok {
-				utils.Assert(expr.Decl != nil, "An unresolved identifier survived until bytecode generation")
-				lhs, exists := p.Registers[expr.Decl]
-				utils.Assert(exists, "A register was not allocated for a name before use in an expression")
+		utils.Assert(len(n.Left) == len(n.Right), "An unbalanced assignment survived until bytecode generation")
 
-				// copy from rhs to lhs (cast as needed)
-				rightType := n.Right[0].GetType()
-				p.insertCast(rhs, rightType, expr.Type)
-				p.Instructions = append(p.Instructions, Inst(COPY, Unary(p.PrevResult, lhs)))
-			} else {
-				utils.NotImplemented("bytecode generation for assignment to a non-identifier expression")
+		// a compound assignment (eg. "a += 2") assigns the result of its operations
+		values := n.Right
+		if n.Operator != nil {
+			values = make([]ast.Expr, len(n.Operations))
+			for i, operation := range n.Operations {
+				values[i] = operation
 			}
+		}
 
+		// simple assignment
+		if len(values) == 1 {
+			p.Extend(values[0])
+			p.assignRegister(n.Left[0], p.PrevResult, values[0].GetType())
 			return
 		}
 
 		// parallel assignment
-		tmps := make([]Register, len(n.Right))
-		for i, expr := range n.Right {
+		tmps := make([]Register, len(values))
+		for i, expr := range values {
 			p.Extend(expr)
 			rhs := p.PrevResult
 
@@ -390,36 +791,30 @@ func (p *Procedure) Extend(node ast.Node) {
 			p.Instructions = append(p.Instructions, Inst(COPY, Unary(rhs, tmps[i])))
 		}
 		for i, expr := range n.Left {
-			if e, ok := expr.(*ast.Identifier); ok {
-				utils.Assert(e.Decl != nil, "An unresolved identifier survived until bytecode generation")
-				lhs, exists := p.Registers[e.Decl]
-				utils.Assert(exists, "A register was not allocated for a name before use in an expression")
-
-				// copy from temporary to lhs (cast as needed)
-				p.insertCast(tmps[i], n.Right[i].GetType(), e.Type)
-				p.Instructions = append(p.Instructions, Inst(COPY, Unary(p.PrevResult, lhs)))
-			} else {
-				utils.NotImplemented("bytecode generation for assignment to a non-identifier expression")
-			}
+			p.assignRegister(expr, tmps[i], values[i].GetType())
 		}
 
 	case *ast.TextLiteral:
 		utils.Assert(n.Value != ast.UnparsedValue, "An unparsed value survived until bytecode generation")
-		register := Rg(p.AssignLocation(), Pointer)
-
 		text, ok := n.Value.([]byte)
 		utils.Assert(ok, "A text literal is not a byte slice during bytecode generation")
 
+		data := Rg(p.AssignLocation(), Pointer)
 		name := p.Program.NextConstantName()
-		instruction := Inst(LOAD, ConstPtr(name, register))
-
 		p.Program.DefineData(name, text)
-		p.Instructions = append(p.Instructions, instruction)
-		endRegister = register
+		p.Instructions = append(p.Instructions, Inst(LOAD, ConstPtr(name, data)))
+
+		count := Rg(p.AssignLocation(), Int64)
+		name = p.Program.NextConstantName()
+		p.Program.DefineData(name, Pack(int64(len(text))))
+		p.Instructions = append(p.Instructions, Inst(LOAD, Constant(name, count)))
+
+		endRegister = Rg(p.AssignLocation(), Text)
+		p.Instructions = append(p.Instructions, Inst(TEXT, Binary(data, count, endRegister)))
 
 	case *ast.NumberLiteral:
 		utils.Assert(n.Value != ast.UnparsedValue, "An unparsed value survived until bytecode generation")
-		register := Rg(p.AssignLocation(), typeFromAst(n.Type))
+		register := Rg(p.AssignLocation(), TypeFromAst(n.Type))
 
 		switch n.Value.(type) {
 		case int64, uint64, float64:
@@ -430,21 +825,173 @@ func (p *Procedure) Extend(node ast.Node) {
 		name := p.Program.NextConstantName()
 		instruction := Inst(LOAD, Constant(name, register))
 
-		p.Program.DefineData(name, Pack(n.Value))
+		p.Program.DefineData(name, packNumber(n.Value, register.Typ))
 		p.Instructions = append(p.Instructions, instruction)
 		endRegister = register
 
+	case *ast.CharLiteral:
+		utils.Assert(n.Value != ast.UnparsedValue, "An unparsed value survived until bytecode generation")
+		char, ok := n.Value.(uint32)
+		utils.Assert(ok, "A char literal is not a uint32 value during bytecode generation")
+
+		register := Rg(p.AssignLocation(), Uint32)
+		name := p.Program.NextConstantName()
+		p.Program.DefineData(name, Pack(char))
+		p.Instructions = append(p.Instructions, Inst(LOAD, Constant(name, register)))
+		endRegister = register
+
 	case *ast.Identifier:
 		utils.Assert(n.Decl != nil, "An unresolved identifier survived until bytecode generation")
+		if proc := procedureConstant(n.Decl); proc != nil {
+			endRegister = p.loadProcedure(p.Program.procedureIndex(n), proc.Captures)
+			break
+		}
+
 		register, exists := p.Registers[n.Decl]
+		if !exists {
+			// a constant declared outside of this procedure is evaluated where it is used
+			if decl, ok := n.Decl.(*ast.ImmutableDecl); ok {
+				if defn, ok := decl.Defn.(*ast.ConstantDefn); ok {
+					p.Extend(defn.Expr)
+					register, exists = p.PrevResult, true
+				}
+			}
+		}
 		utils.Assert(exists, "A register was not allocated for a declaration before use in an expression")
+		if register.Typ == Cell {
+			register = p.loadCell(register, n.Type)
+		}
 		endRegister = register
 
 	case *ast.GroupExpr:
 		p.Extend(n.Subexpr)
 		endRegister = p.PrevResult
 
+	case *ast.TupleExpr:
+		p.extendTuple(n.Elements, n.Type)
+		endRegister = p.PrevResult
+
+	case *ast.VariadicExpr:
+		// an array has the same representation as a tuple of its elements
+		element := n.Type.(*ast.ArrayType).Element
+		elements := make([]Register, len(n.Elements))
+		for i, value := range n.Elements {
+			p.Extend(value)
+			p.insertCast(p.PrevResult, value.GetType(), element)
+			elements[i] = p.PrevResult
+		}
+		endRegister = Rg(p.AssignLocation(), Array)
+		p.Instructions = append(p.Instructions, Inst(PACK, Tup(endRegister, elements)))
+
+	case *ast.IndexExpr:
+		p.Extend(n.Left)
+		array := p.PrevResult
+		p.Extend(n.Index)
+		p.insertConversion(p.PrevResult, Int64, false)
+		index := p.PrevResult
+		endRegister = Rg(p.AssignLocation(), TypeFromAst(n.Type))
+		p.Instructions = append(p.Instructions, Inst(INDEX, Binary(array, index, endRegister)))
+
+	case *ast.MemberExpr:
+		p.Extend(n.Left)
+
+		// a struct is packed like a tuple, so a field is indexed by its position
+		if defn := ast.StructOf(n.Left.GetType()); defn != nil {
+			value := p.PrevResult
+			index := Rg(p.AssignLocation(), Int64)
+			name := p.Program.NextConstantName()
+			p.Program.DefineData(name, Pack(int64(ast.FieldIndex(defn, n.Member.Literal))))
+			p.Instructions = append(p.Instructions, Inst(LOAD, Constant(name, index)))
+			endRegister = Rg(p.AssignLocation(), TypeFromAst(n.Type))
+			p.Instructions = append(p.Instructions, Inst(INDEX, Binary(value, index, endRegister)))
+			break
+		}
+
+		switch n.Member.Literal {
+		case "count":
+			endRegister = Rg(p.AssignLocation(), Int64)
+			p.Instructions = append(p.Instructions, Inst(COUNT, Unary(p.PrevResult, endRegister)))
+		case "data":
+			endRegister = Rg(p.AssignLocation(), Pointer)
+			p.Instructions = append(p.Instructions, Inst(DATA, Unary(p.PrevResult, endRegister)))
+		default:
+			utils.AssertionFailed("An unknown member survived until bytecode generation")
+		}
+
+	case *ast.RunExpr:
+		if n.Ran {
+			// the result was spliced back into the tree during compilation
+			if n.Result != nil {
+				p.Extend(n.Result)
+				endRegister = p.PrevResult
+			}
+			break
+		}
+
+		// a directive which hasn't been evaluated is a call to its own procedure
+		proc := p.Program.directive(n)
+		out := Rg(-1, None)
+		if n.Type != ast.BuiltinEmpty {
+			out = Rg(p.AssignLocation(), TypeFromAst(n.Type))
+		}
+		p.Instructions = append(p.Instructions, Inst(CALL, Proc(proc, out, nil)))
+		endRegister = out
+
+	case *ast.CastExpr:
+		p.Extend(n.Subexpr)
+		p.insertConversion(p.PrevResult, TypeFromAst(n.Type), n.Checked)
+		endRegister = p.PrevResult
+
+	case *ast.PostfixExpr:
+		if n.Call != nil {
+			p.Extend(n.Call)
+			endRegister = p.PrevResult
+		} else {
+			utils.NotImplemented(fmt.Sprintf(`Bytecode generation for postfix "%s"`, n.Operator.Literal))
+		}
+
+	case *ast.PrefixExpr:
+		// an overloaded operator is just a procedure call
+		if n.Call != nil {
+			p.Extend(n.Call)
+			endRegister = p.PrevResult
+			break
+		}
+
+		switch n.Operator {
+		case ast.BuiltinPositive:
+			p.Extend(n.Subexpr)
+			p.insertCast(p.PrevResult, n.Subexpr.GetType(), n.Type)
+			endRegister = p.PrevResult
+		case ast.BuiltinNegative, ast.BuiltinBitNot:
+			p.Extend(n.Subexpr)
+			p.insertCast(p.PrevResult, n.Subexpr.GetType(), n.Type)
+			in := p.PrevResult
+			out := Rg(p.AssignLocation(), TypeFromAst(n.Type))
+			op := BIT_NOT
+			if n.Operator == ast.BuiltinNegative {
+				op = NEGATE
+			}
+			p.Instructions = append(p.Instructions, Inst(op, Unary(in, out)))
+			endRegister = out
+		default:
+			utils.NotImplemented(fmt.Sprintf(`Bytecode generation for prefix "%s"`, n.Operator.Literal))
+		}
+
 	case *ast.InfixExpr:
+		// an overloaded operator is just a procedure call
+		if n.Call != nil {
+			p.Extend(n.Call)
+			endRegister = p.PrevResult
+			break
+		}
+
+		if n.Operator == ast.BuiltinElementOf || n.Operator == ast.BuiltinNotElementOf {
+			p.extendMembership(n)
+			endRegister = p.PrevResult
+			break
+		}
+
 		// TODO: casts should probably be added to the AST elsewhere and only processed here
 
 		// instructions to evaluate arguments
@@ -452,23 +999,37 @@ func (p *Procedure) Extend(node ast.Node) {
 		p.insertCast(p.PrevResult, n.Left.GetType(), n.Type)
 		left := p.PrevResult
 		p.Extend(n.Right)
-		p.insertCast(p.PrevResult, n.Right.GetType(), n.Type)
+		if n.Operator != ast.BuiltinShiftLeft && n.Operator != ast.BuiltinShiftRight {
+			// the shift count keeps its own type
+			p.insertCast(p.PrevResult, n.Right.GetType(), n.Type)
+		}
 		right := p.PrevResult
 
 		var op Opcode
-		switch n.Type {
-		// TODO: probably shouldn't have any "inferred" types by the time we get here
-		case ast.InferredNumber, ast.InferredSigned, ast.InferredUnsigned, ast.InferredFloat:
-			switch n.Operator {
-			case ast.BuiltinAdd:
-				op = ADD
-			case ast.BuiltinSubtract:
-				op = SUBTRACT
-			case ast.BuiltinMultiply:
-				op = MULTIPLY
-			case ast.BuiltinDivide:
-				op = DIVIDE
+		switch n.Operator {
+		case ast.BuiltinAdd:
+			op = ADD
+			if TypeFromAst(n.Type) == Text {
+				op = CONCAT
 			}
+		case ast.BuiltinSubtract:
+			op = SUBTRACT
+		case ast.BuiltinMultiply:
+			op = MULTIPLY
+		case ast.BuiltinDivide:
+			op = DIVIDE
+		case ast.BuiltinRemainder:
+			op = REMAINDER
+		case ast.BuiltinBitAnd:
+			op = BIT_AND
+		case ast.BuiltinBitOr:
+			op = BIT_OR
+		case ast.BuiltinBitXor:
+			op = BIT_XOR
+		case ast.BuiltinShiftLeft:
+			op = SHIFT_LEFT
+		case ast.BuiltinShiftRight:
+			op = SHIFT_RIGHT
 		default:
 			utils.NotImplemented(
 				fmt.Sprintf(`Bytecode generation for infix "%s %s %s"`,
@@ -477,53 +1038,159 @@ func (p *Procedure) Extend(node ast.Node) {
 					n.Right.GetType().Print()))
 		}
 
-		out := Rg(p.AssignLocation(), typeFromAst(n.Type))
+		out := Rg(p.AssignLocation(), TypeFromAst(n.Type))
 		infix := Inst(op, Binary(left, right, out))
 
 		// bytecode to evaluate operator
 		p.Instructions = append(p.Instructions, infix)
 		endRegister = out
 
+	case *ast.ComparisonExpr:
+		// each operand is evaluated once, and the comparisons are evaluated
+		// left-to-right until one of them is false
+		out := Rg(p.AssignLocation(), Bool)
+		var exits []int
+
+		p.Extend(n.Operands[0])
+		left := p.PrevResult
+		for i, cmp := range n.Comparisons {
+			p.Extend(n.Operands[i+1])
+			right := p.PrevResult
+
+			if cmp.Call != nil {
+				name := cmp.Call.Procedure.(*ast.Identifier)
+				child := p.Program.Procedures[p.Program.procedureIndex(name)]
+				p.Instructions = append(p.Instructions, Inst(CALL, Proc(child, out, []Register{left, right})))
+			} else {
+				p.insertCast(left, cmp.Left.GetType(), n.Compared[i])
+				lhs := p.PrevResult
+				p.insertCast(right, cmp.Right.GetType(), n.Compared[i])
+				rhs := p.PrevResult
+
+				var op Opcode
+				switch cmp.Operator {
+				case ast.BuiltinEqual:
+					op = EQUAL
+				case ast.BuiltinLess:
+					op = LESS
+				case ast.BuiltinLessOrEqual:
+					op = LESS_EQUAL
+				case ast.BuiltinGreater:
+					op = GREATER
+				case ast.BuiltinGreaterOrEqual:
+					op = GREATER_EQUAL
+				default:
+					utils.NotImplemented(fmt.Sprintf(`Bytecode generation for comparison "%s"`, cmp.Operator.Literal))
+				}
+				p.Instructions = append(p.Instructions, Inst(op, Binary(lhs, rhs, out)))
+			}
+
+			if i+1 < len(n.Comparisons) {
+				exits = append(exits, len(p.Instructions))
+				p.Instructions = append(p.Instructions, Inst(JUMP_FALSE, JumpFalse(out, -1)))
+			}
+			left = right
+		}
+
+		for _, exit := range exits {
+			p.Instructions[exit].Args = JumpFalse(out, len(p.Instructions))
+		}
+		endRegister = out
+
 	case *ast.ProcedureExpr:
+		if ast.IsPolymorphic(n) {
+			break // bytecode is generated for each instance when it is first called
+		}
+
 		proc := p.Program.NewProcedure()
+		p.Program.procedureIds[n] = proc.Index
+		named := false
 		if defn, ok := n.Parent.(*ast.ConstantDefn); ok {
 			if decl, ok := defn.Parent.(*ast.ImmutableDecl); ok {
-				p.Program.Text[decl.Name.Literal] = proc.Index
+				// overloads share a name, so later overloads get a unique label
+				label := decl.Name.Literal
+				if _, exists := p.Program.Text[label]; exists {
+					label += "." + strconv.Itoa(proc.Index)
+				}
+				p.Program.Text[label] = proc.Index
+				proc.Name = label
+				named = true
 			}
 		}
 
 		proc.Arguments = make([]Register, len(n.Params))
 		for i, param := range n.Params {
-			if param.Expr != nil {
-				utils.NotImplemented("Bytecode generation for parameter default values")
-			}
-			register := Rg(proc.AssignLocation(), typeFromAst(param.Type))
-			proc.Arguments[i] = register
-			proc.Registers[param] = register
+			// default values are evaluated by the caller (see CallExpr)
+			proc.Arguments[i] = Rg(proc.AssignLocation(), TypeFromAst(param.Type))
+		}
+		for _, decl := range n.Captures {
+			cell := Rg(proc.AssignLocation(), Cell)
+			proc.Arguments = append(proc.Arguments, cell)
+			proc.Registers[decl] = cell
+		}
+		for i, param := range n.Params {
+			proc.declare(param, proc.Arguments[i])
 		}
+		proc.returns = n.Return
 		proc.Extend(n.Block)
 
+		// a named procedure is loaded wherever its name is used as a value
+		if !named {
+			endRegister = p.loadProcedure(proc.Index, n.Captures)
+		}
+
 	case *ast.CallExpr:
-		name, ok := n.Procedure.(*ast.Identifier)
-		if !ok {
-			utils.NotImplemented("Bytecode generation for procedure calls to procedure pointers; procedure must be known at compile time")
+		// a procedure which isn't a constant is called through the procedure table
+		var child *Procedure
+		var value Register
+		var captures []*ast.MutableDecl
+		var procType ast.Type
+		if n.Instance != nil {
+			if _, exists := p.Program.procedureIds[n.Instance]; !exists {
+				p.Extend(n.Instance)
+			}
+			child = p.Program.Procedures[p.Program.procedureIds[n.Instance]]
+			captures = n.Instance.Captures
+			procType = n.Instance.Type
+		} else if name, ok := n.Procedure.(*ast.Identifier); ok && procedureConstant(name.Decl) != nil {
+			child = p.Program.Procedures[p.Program.procedureIndex(name)]
+			captures = procedureConstant(name.Decl).Captures
+			procType = procedureConstant(name.Decl).Type
+		} else {
+			p.Extend(n.Procedure)
+			value = p.PrevResult
+			procType = n.Procedure.GetType()
 		}
 
-		child := p.Program.Procedures[p.Program.Text[name.Literal]]
-		utils.Assert(len(n.Arguments) == len(child.Arguments), "A procedure call with an incorrect number of arguments survived until bytecode generation")
+		// the bound arguments include default values, and are in the same order
+		// as the parameters
+		args := n.Arguments
+		if n.Bound != nil {
+			args = n.Bound
+		}
 
-		ins := make([]Register, len(n.Arguments))
-		for i, arg := range n.Arguments {
+		// each argument is cast to the type of its parameter (eg. "i8" to "i16")
+		params := procType.(*ast.ProcedureType).Params
+		ins := make([]Register, len(args))
+		for i, arg := range args {
 			p.Extend(arg)
+			p.insertCast(p.PrevResult, arg.GetType(), params[i])
 			ins[i] = p.PrevResult
 		}
+		ins = append(ins, p.capturedCells(captures)...)
+		utils.Assert(child == nil || len(ins) == len(child.Arguments),
+			"A procedure call with an incorrect number of arguments survived until bytecode generation")
 
 		// TODO: figure out whether we actually have a return value or not
-		out := Rg(-1, None)
-		// if HAS_RETURN {
-		out = Rg(p.AssignLocation(), None) // TODO: get the return type of the procedure
-		// }
-		p.Instructions = append(p.Instructions, Inst(CALL, Proc(child, out, ins)))
+		out := Rg(p.AssignLocation(), None)
+		if n.Type != ast.PlaceholderType && n.Type != ast.BuiltinEmpty {
+			out.Typ = TypeFromAst(n.Type) // the declared return type
+		}
+		if child != nil {
+			p.Instructions = append(p.Instructions, Inst(CALL, Proc(child, out, ins)))
+		} else {
+			p.Instructions = append(p.Instructions, Inst(CALL_INDIRECT, Indirect(value, out, ins)))
+		}
 		endRegister = out
 
 	default:
@@ -535,6 +1202,259 @@ func (p *Procedure) Extend(node ast.Node) {
 	p.PrevResult = endRegister
 }
 
+// extendMembership generates a check of whether a value is "in" a collection;
+// ranges are checked against their bounds, constant text is unrolled into a
+// comparison with each of its characters, and otherwise each element of an
+// array (or character of text) is compared in a loop.
+func (p *Procedure) extendMembership(n *ast.InfixExpr) {
+	out := Rg(p.AssignLocation(), Bool)
+	var exits []int
+
+	switch coll := n.Right.(type) {
+	case *ast.ExprRange:
+		p.Extend(n.Left)
+		p.insertCast(p.PrevResult, n.Left.GetType(), coll.Compared)
+		value := p.PrevResult
+		p.Extend(coll.Min)
+		p.insertCast(p.PrevResult, coll.Min.GetType(), coll.Compared)
+		min := p.PrevResult
+		p.Extend(coll.Max)
+		p.insertCast(p.PrevResult, coll.Max.GetType(), coll.Compared)
+		max := p.PrevResult
+
+		p.Instructions = append(p.Instructions, Inst(LESS_EQUAL, Binary(min, value, out)))
+		exits = append(exits, len(p.Instructions))
+		p.Instructions = append(p.Instructions, Inst(JUMP_FALSE, JumpFalse(out, -1)))
+		p.Instructions = append(p.Instructions, Inst(LESS_EQUAL, Binary(value, max, out)))
+
+	case *ast.TextLiteral:
+		p.Extend(n.Left)
+		value := p.PrevResult
+
+		text, ok := coll.Value.([]byte)
+		utils.Assert(ok, "A text literal is not a byte slice during bytecode generation")
+
+		chars := []rune(string(text))
+		if len(chars) == 0 {
+			p.Instructions = append(p.Instructions, Inst(COPY, Unary(p.loadConstant(false, Bool), out)))
+		}
+		for i, char := range chars {
+			name := p.Program.NextConstantName()
+			p.Program.DefineData(name, Pack(uint32(char)))
+			register := Rg(p.AssignLocation(), Uint32)
+			p.Instructions = append(p.Instructions, Inst(LOAD, Constant(name, register)))
+			p.Instructions = append(p.Instructions, Inst(EQUAL, Binary(value, register, out)))
+			if i+1 < len(chars) {
+				exits = append(exits, len(p.Instructions))
+				p.Instructions = append(p.Instructions, Inst(JUMP_TRUE, JumpTrue(out, -1)))
+			}
+		}
+
+	default:
+		p.Extend(n.Left)
+		p.insertCast(p.PrevResult, n.Left.GetType(), n.Compared)
+		value := p.PrevResult
+		p.Extend(n.Right)
+		collection := p.PrevResult
+
+		element, step := ast.Type(ast.BuiltinChar), DECODE
+		if array, ok := n.Right.GetType().(*ast.ArrayType); ok {
+			element, step = array.Element, INDEX
+		}
+
+		index := p.loadConstant(int64(0), Int64)
+		one := p.loadConstant(int64(1), Int64)
+		count := Rg(p.AssignLocation(), Int64)
+		found := p.loadConstant(false, Bool)
+		p.Instructions = append(p.Instructions, Inst(COUNT, Unary(collection, count)))
+
+		loop := len(p.Instructions)
+		more := Rg(p.AssignLocation(), Bool)
+		p.Instructions = append(p.Instructions, Inst(LESS, Binary(index, count, more)))
+		exits = append(exits, len(p.Instructions))
+		p.Instructions = append(p.Instructions, Inst(JUMP_FALSE, JumpFalse(more, -1)))
+
+		next := Rg(p.AssignLocation(), TypeFromAst(element))
+		p.Instructions = append(p.Instructions, Inst(step, Binary(collection, index, next)))
+		p.insertCast(next, element, n.Compared)
+		p.Instructions = append(p.Instructions, Inst(EQUAL, Binary(value, p.PrevResult, found)))
+		exits = append(exits, len(p.Instructions))
+		p.Instructions = append(p.Instructions, Inst(JUMP_TRUE, JumpTrue(found, -1)))
+		p.Instructions = append(p.Instructions, Inst(ADD, Binary(index, one, index)))
+		p.Instructions = append(p.Instructions, Inst(JUMP, Jump(loop)))
+
+		// the loop can't be the last instruction, which holds the result
+		for _, exit := range exits {
+			args := p.Instructions[exit].Args.(JumpArgs)
+			args.Target = len(p.Instructions)
+			p.Instructions[exit].Args = args
+		}
+		exits = nil
+		p.Instructions = append(p.Instructions, Inst(COPY, Unary(found, out)))
+	}
+
+	for _, exit := range exits {
+		args := p.Instructions[exit].Args.(JumpArgs)
+		args.Target = len(p.Instructions)
+		p.Instructions[exit].Args = args
+	}
+	if n.Operator == ast.BuiltinNotElementOf {
+		p.Instructions = append(p.Instructions, Inst(NOT, Unary(out, out)))
+	}
+	p.PrevResult = out
+}
+
+// loadConstant loads a constant value into a new register.
+func (p *Procedure) loadConstant(value interface{}, typ Type) Register {
+	register := Rg(p.AssignLocation(), typ)
+	name := p.Program.NextConstantName()
+	p.Program.DefineData(name, Pack(value))
+	p.Instructions = append(p.Instructions, Inst(LOAD, Constant(name, register)))
+	return register
+}
+
+// assignRegister copies a value to the left side of an assignment, casting
+// the value to the type of the left side as needed.
+func (p *Procedure) assignRegister(left ast.Expr, value Register, typ ast.Type) {
+	name, ok := left.(*ast.Identifier)
+	if !ok {
+		utils.NotImplemented("bytecode generation for assignment to a non-identifier expression")
+	}
+
+	utils.Assert(name.Decl != nil, "An unresolved identifier survived until bytecode generation")
+	lhs, exists := p.Registers[name.Decl]
+	utils.Assert(exists, "A register was not allocated for a name before use in an expression")
+
+	p.insertCast(value, typ, name.Type)
+	if lhs.Typ == Cell {
+		p.Instructions = append(p.Instructions, Inst(STORE_CELL, Unary(p.PrevResult, lhs)))
+	} else {
+		p.Instructions = append(p.Instructions, Inst(COPY, Unary(p.PrevResult, lhs)))
+	}
+}
+
+// declare allocates a variable; a variable which is captured by a nested
+// procedure is stored in a cell, so that changes made by either procedure
+// are seen by both of them.
+func (p *Procedure) declare(decl *ast.MutableDecl, value Register) {
+	if !decl.Captured {
+		p.Registers[decl] = value
+		return
+	}
+
+	cell := Rg(p.AssignLocation(), Cell)
+	p.Instructions = append(p.Instructions, Inst(CELL, Unary(value, cell)))
+	p.Registers[decl] = cell
+}
+
+func (p *Procedure) loadCell(cell Register, typ ast.Type) Register {
+	out := Rg(p.AssignLocation(), TypeFromAst(typ))
+	p.Instructions = append(p.Instructions, Inst(LOAD_CELL, Unary(cell, out)))
+	return out
+}
+
+// capturedCells returns the cells of the variables captured by a procedure,
+// which are passed to the procedure after its parameters.
+func (p *Procedure) capturedCells(captures []*ast.MutableDecl) []Register {
+	cells := make([]Register, len(captures))
+	for i, decl := range captures {
+		cell, exists := p.Registers[decl]
+		utils.Assert(exists && cell.Typ == Cell, "A captured variable was not allocated a cell before use in a nested procedure")
+		cells[i] = cell
+	}
+	return cells
+}
+
+// loadProcedure loads a procedure as a value, which is a tuple of its index
+// in the program's procedure table and the cells of its captured variables.
+func (p *Procedure) loadProcedure(index int, captures []*ast.MutableDecl) Register {
+	register := Rg(p.AssignLocation(), Int64)
+	name := p.Program.NextConstantName()
+	p.Program.DefineData(name, Pack(int64(index)))
+	p.Instructions = append(p.Instructions, Inst(LOAD, Constant(name, register)))
+
+	closure := Rg(p.AssignLocation(), Callable)
+	elements := append([]Register{register}, p.capturedCells(captures)...)
+	p.Instructions = append(p.Instructions, Inst(PACK, Tup(closure, elements)))
+	return closure
+}
+
+// extendTuple packs multiple values into a tuple, casting each value to the
+// type of its element (eg. the declared return types of a procedure).
+func (p *Procedure) extendTuple(values []ast.Expr, typ ast.Type) {
+	tupleType, _ := typ.(*ast.TupleType)
+	elements := make([]Register, len(values))
+	for i, value := range values {
+		p.Extend(value)
+		if tupleType != nil {
+			p.insertCast(p.PrevResult, value.GetType(), tupleType.Elements[i])
+		}
+		elements[i] = p.PrevResult
+	}
+
+	tuple := Rg(p.AssignLocation(), Tuple)
+	p.Instructions = append(p.Instructions, Inst(PACK, Tup(tuple, elements)))
+	p.PrevResult = tuple
+}
+
+// hasDeferred reports whether any enclosing block has deferred statements.
+func (p *Procedure) hasDeferred() bool {
+	for _, frame := range p.deferred {
+		if len(frame) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// extendDeferred generates the deferred statements of the enclosing blocks
+// from the innermost block to the given block, each in reverse order.
+func (p *Procedure) extendDeferred(outermost int) {
+	for i := len(p.deferred) - 1; i >= outermost; i-- {
+		frame := p.deferred[i]
+		for j := len(frame) - 1; j >= 0; j-- {
+			p.Extend(frame[j].Stmt)
+		}
+	}
+}
+
+// exitsBlock reports whether a statement leaves its block, after evaluating
+// the deferred statements of the block itself (eg. "return").
+func exitsBlock(node ast.Node) bool {
+	switch node.(type) {
+	case *ast.ReturnStmt, *ast.DoneStmt:
+		return true
+	default:
+		return false
+	}
+}
+
+// procedureConstant returns the procedure declared by a constant declaration
+// (eg. "double :: (n: int) -> int { ... }"), or nil if it isn't a procedure.
+func procedureConstant(decl ast.Decl) *ast.ProcedureExpr {
+	if imm, ok := decl.(*ast.ImmutableDecl); ok {
+		if defn, ok := imm.Defn.(*ast.ConstantDefn); ok {
+			proc, _ := defn.Expr.(*ast.ProcedureExpr)
+			return proc
+		}
+	}
+	return nil
+}
+
+// procedureIndex finds the procedure called by name, preferring the name's
+// declaration over its label so that overloads sharing a name are distinct
+func (p *Program) procedureIndex(name *ast.Identifier) int {
+	if proc := procedureConstant(name.Decl); proc != nil {
+		if index, ok := p.procedureIds[proc]; ok {
+			return index
+		}
+	}
+
+	index, exists := p.Text[name.Literal]
+	utils.Assert(exists, "A procedure was called before bytecode was generated for it")
+	return index
+}
+
 func (p *Procedure) AssignLocation() Location {
 	utils.Assert(p.NextFree < OutOfRegisters, "Ran out of assignable registers.")
 	location := p.NextFree
@@ -542,51 +1462,140 @@ func (p *Procedure) AssignLocation() Location {
 	return location
 }
 
-func typeFromAst(t ast.Type) Type {
+func TypeFromAst(t ast.Type) Type {
 	switch t {
-	case ast.InferredFloat:
+	case ast.InferredFloat, ast.BuiltinFloat, ast.BuiltinFloat64:
 		return Float64
-	case ast.InferredUnsigned:
+	case ast.BuiltinFloat32:
+		return Float32
+	case ast.InferredUnsigned, ast.BuiltinUint, ast.BuiltinUint64:
 		return Uint64
+	case ast.BuiltinUint32:
+		return Uint32
+	case ast.BuiltinUint16:
+		return Uint16
+	case ast.BuiltinUint8:
+		return Uint8
 	case ast.InferredSigned, ast.InferredNumber, ast.BuiltinInt, ast.BuiltinInt64:
 		return Int64
-	case ast.BuiltinText:
-		return Pointer // TODO: eventually text should be a pointer/length struct
+	case ast.BuiltinInt32:
+		return Int32
+	case ast.BuiltinInt16:
+		return Int16
+	case ast.BuiltinInt8:
+		return Int8
+	case ast.BuiltinBool:
+		return Bool
+	case ast.BuiltinChar:
+		return Uint32 // a unicode codepoint
+	case ast.InferredText, ast.BuiltinText:
+		return Text
 	default:
+		switch t.(type) {
+		case *ast.TupleType:
+			return Tuple
+		case *ast.ArrayType:
+			return Array
+		case *ast.PointerType:
+			return Pointer
+		case *ast.ProcedureType:
+			return Callable
+		case *ast.NamedType:
+			if ast.StructOf(t) != nil {
+				return Tuple
+			}
+		}
 		utils.NotImplemented("Bytecode generation for for non-numeric/non-builtin types")
 		return None
 	}
 }
 
-// TODO: Handle nonnumeric types
+// castOpcode returns the instruction which converts a number to the given type.
+func castOpcode(t Type) Opcode {
+	switch t {
+	case Int8:
+		return CAST_I8
+	case Int16:
+		return CAST_I16
+	case Int32:
+		return CAST_I32
+	case Int64:
+		return CAST_I64
+	case Uint8:
+		return CAST_U8
+	case Uint16:
+		return CAST_U16
+	case Uint32:
+		return CAST_U32
+	case Uint64:
+		return CAST_U64
+	case Float32:
+		return CAST_F32
+	case Float64:
+		return CAST_F64
+	default:
+		return NOOP
+	}
+}
+
 func (p *Procedure) insertCast(in Register, from ast.Type, to ast.Type) {
 	p.PrevResult = in
 	if from == to {
 		return
 	}
 
-	// TODO: maybe insert overflow check for integer conversions?
+	// no cast is needed when the representation is the same (eg. "<number>" to "int")
 	// FIXME: right now "inferred numbers" are accept upto uint64 max,
 	//        but here I want to (and do) treat them as signed
-	switch to {
-	case ast.InferredNumber, ast.InferredSigned:
-		out := Rg(p.AssignLocation(), Int64)
-		cast := Inst(CAST_I64, Unary(in, out))
-		p.Instructions = append(p.Instructions, cast)
-		p.PrevResult = out
-	case ast.InferredUnsigned:
-		out := Rg(p.AssignLocation(), Uint64)
-		cast := Inst(CAST_U64, Unary(in, out))
-		p.Instructions = append(p.Instructions, cast)
-		p.PrevResult = out
-	case ast.InferredFloat:
-		out := Rg(p.AssignLocation(), Float64)
-		cast := Inst(CAST_F64, Unary(in, out))
-		p.Instructions = append(p.Instructions, cast)
-		p.PrevResult = out
-	default:
+	typ := TypeFromAst(to)
+	if typ == in.Typ {
+		return
+	}
+
+	if castOpcode(typ) == NOOP || castOpcode(in.Typ) == NOOP {
 		utils.NotImplemented(
 			fmt.Sprintf(`Inserting implicit cast of %s to %s during bytecode generation`,
 				from.Print(), to.Print()))
 	}
+	p.insertConversion(in, typ, p.Program.Checked && !isLossless(in.Typ, typ))
+}
+
+// precisions are the bits of magnitude that each number representation holds
+// exactly, and whether the representation has a sign.
+var precisions = map[Type]struct {
+	bits   int
+	signed bool
+	float  bool
+}{
+	Int8: {7, true, false}, Int16: {15, true, false}, Int32: {31, true, false}, Int64: {63, true, false},
+	Uint8: {8, false, false}, Uint16: {16, false, false}, Uint32: {32, false, false}, Uint64: {64, false, false},
+	Float32: {24, true, true}, Float64: {53, true, true},
+}
+
+// isLossless reports whether every value of one number representation is
+// exactly representable by another (eg. "u8" to "i16", but not "i8" to "u16").
+func isLossless(from Type, to Type) bool {
+	in, out := precisions[from], precisions[to]
+	if in.float && !out.float {
+		return false
+	}
+	return in.bits <= out.bits && (!in.signed || out.signed)
+}
+
+// insertConversion converts a number register to another representation; a
+// checked conversion traps if the value is out of range for the new type.
+func (p *Procedure) insertConversion(in Register, typ Type, checked bool) {
+	p.PrevResult = in
+	if typ == in.Typ {
+		return
+	}
+
+	op := castOpcode(typ)
+	if checked {
+		op = CAST_CHECKED
+	}
+
+	out := Rg(p.AssignLocation(), typ)
+	p.Instructions = append(p.Instructions, Inst(op, Unary(in, out)))
+	p.PrevResult = out
 }
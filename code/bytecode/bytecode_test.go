@@ -167,6 +167,203 @@ func TestEncodeArithmetic(t *testing.T) {
 	}
 	program = generateBytecode(t, `(02 + 3.0) + 04;`)
 	assert.Equal(t, expected, program.Procedures[0].Instructions)
+
+	// negation
+	expected = []Instruction{
+		{LOAD, Constant(".LC1", Rg(0, Int64))},
+		{CAST_I8, Unary(Rg(0, Int64), Rg(1, Int8))},
+		{NEGATE, Unary(Rg(1, Int8), Rg(2, Int8))},
+	}
+	program = generateBytecode(t, `{ a: i8 = 100; -a; }`)
+	assert.Equal(t, expected, program.Procedures[0].Instructions)
+}
+
+func TestEncodeSizedTypes(t *testing.T) {
+	expected := []Instruction{
+		{LOAD, Constant(".LC1", Rg(0, Int64))},
+		{CAST_I8, Unary(Rg(0, Int64), Rg(1, Int8))},
+		{LOAD, Constant(".LC2", Rg(2, Int64))},
+		{CAST_I8, Unary(Rg(2, Int64), Rg(3, Int8))},
+		{ADD, Binary(Rg(1, Int8), Rg(3, Int8), Rg(4, Int8))},
+		{CAST_F32, Unary(Rg(4, Int8), Rg(5, Float32))},
+	}
+	program := generateBytecode(t, `{ a: i8 = 100; b: f32 = a + 100; }`)
+	assert.Equal(t, expected, program.Procedures[0].Instructions)
+
+	expected = []Instruction{
+		{LOAD, Constant(".LC1", Rg(0, Uint64))},
+		{CAST_U16, Unary(Rg(0, Uint64), Rg(1, Uint16))},
+		{CAST_U32, Unary(Rg(1, Uint16), Rg(2, Uint32))},
+	}
+	program = generateBytecode(t, `{ a: u16 = 0177777; b: u32 = a; }`)
+	assert.Equal(t, expected, program.Procedures[0].Instructions)
+}
+
+func TestEncodeCasts(t *testing.T) {
+	expected := []Instruction{
+		{LOAD, Constant(".LC1", Rg(0, Int64))},
+		{CAST_U8, Unary(Rg(0, Int64), Rg(1, Uint8))},
+	}
+	program := generateBytecode(t, `cast(u8) 300;`)
+	assert.Equal(t, expected, program.Procedures[0].Instructions)
+
+	expected = []Instruction{
+		{LOAD, Constant(".LC1", Rg(0, Int64))},
+		{CAST_CHECKED, Unary(Rg(0, Int64), Rg(1, Uint8))},
+	}
+	program = generateBytecode(t, `cast?(u8) 300;`)
+	assert.Equal(t, expected, program.Procedures[0].Instructions)
+
+	// casting to the same representation is free
+	expected = []Instruction{{LOAD, Constant(".LC1", Rg(0, Int64))}}
+	program = generateBytecode(t, `cast?(int) 300;`)
+	assert.Equal(t, expected, program.Procedures[0].Instructions)
+}
+
+func TestEncodeCheckedCasts(t *testing.T) {
+	p := parser.Make("example", false, []byte(`{ a: i8 = 100; b: i16 = a; c: u16 = a; }`))
+	node := p.ParseEvaluable()
+	section := semantics.FlattenTree(node, nil)
+	semantics.ResolveNames(&section)
+	semantics.InferTypes(&section)
+	program := NewProgram()
+	program.Checked = true
+	program.Extend(node)
+
+	// only a conversion which can lose information is checked
+	expected := []Instruction{
+		{LOAD, Constant(".LC1", Rg(0, Int64))},
+		{CAST_CHECKED, Unary(Rg(0, Int64), Rg(1, Int8))},
+		{CAST_I16, Unary(Rg(1, Int8), Rg(2, Int16))},
+		{CAST_CHECKED, Unary(Rg(1, Int8), Rg(3, Uint16))},
+	}
+	assert.Equal(t, expected, program.Procedures[0].Instructions)
+
+	expected = []Instruction{{LOAD, Constant(".LC1", Rg(0, Uint64))}}
+	program = generateBytecode(t, `{ a: u64 = 18446744073709551615; }`)
+	assert.Equal(t, expected, program.Procedures[0].Instructions)
+}
+
+func TestEncodeFoldedConstants(t *testing.T) {
+	p := parser.Make("example", false, []byte(`{ unix_write :: 1; page :: 4 * 1024; a := 2; unix_write + page * a; }`))
+	node := p.ParseEvaluable()
+	assert.Empty(t, p.Errors, "Unexpected parser errors")
+	section := semantics.FlattenTree(node, nil)
+	semantics.ResolveNames(&section)
+	semantics.InferTypes(&section)
+	assert.Empty(t, semantics.FoldConstants(&section), "Unexpected constant errors")
+	program := NewProgram()
+	program.Extend(node)
+
+	constants := map[string][]byte{
+		".LC1": Pack(int64(2)),
+		".LC2": Pack(int64(1)),
+		".LC3": Pack(int64(4096)),
+	}
+	expected := []Instruction{
+		{LOAD, Constant(".LC1", Rg(0, Int64))},
+		{LOAD, Constant(".LC2", Rg(1, Int64))},
+		{LOAD, Constant(".LC3", Rg(2, Int64))},
+		{MULTIPLY, Binary(Rg(2, Int64), Rg(0, Int64), Rg(3, Int64))},
+		{ADD, Binary(Rg(1, Int64), Rg(3, Int64), Rg(4, Int64))},
+	}
+	assert.Equal(t, constants, program.Data)
+	assert.Equal(t, expected, program.Procedures[0].Instructions)
+
+	// the data of a named constant is only defined once
+	p = parser.Make("example", false, []byte(`{ page :: 4 * 1024; a := page; b := page; a + page; }`))
+	node = p.ParseEvaluable()
+	assert.Empty(t, p.Errors, "Unexpected parser errors")
+	section = semantics.FlattenTree(node, nil)
+	semantics.ResolveNames(&section)
+	semantics.InferTypes(&section)
+	assert.Empty(t, semantics.FoldConstants(&section), "Unexpected constant errors")
+	program = NewProgram()
+	program.Extend(node)
+
+	constants = map[string][]byte{".LC1": Pack(int64(4096))}
+	expected = []Instruction{
+		{LOAD, Constant(".LC1", Rg(0, Int64))},
+		{LOAD, Constant(".LC1", Rg(1, Int64))},
+		{LOAD, Constant(".LC1", Rg(2, Int64))},
+		{ADD, Binary(Rg(0, Int64), Rg(2, Int64), Rg(3, Int64))},
+	}
+	assert.Equal(t, constants, program.Data)
+	assert.Equal(t, expected, program.Procedures[0].Instructions)
+}
+
+func TestEncodePositions(t *testing.T) {
+	program := generateBytecode(t, `2 + 3 * 4;`)
+	positions := []string{}
+	for _, pos := range program.Procedures[0].Positions {
+		positions = append(positions, pos.String())
+	}
+	assert.Equal(t, []string{"example:1:1", "example:1:5", "example:1:9", "example:1:7", "example:1:3"}, positions)
+}
+
+func TestEncodeComparisons(t *testing.T) {
+	constants := map[string][]byte{".LC1": Pack(int64(1)), ".LC2": Pack(int64(2))}
+	expected := []Instruction{
+		{LOAD, Constant(".LC1", Rg(1, Int64))},
+		{LOAD, Constant(".LC2", Rg(2, Int64))},
+		{LESS, Binary(Rg(1, Int64), Rg(2, Int64), Rg(0, Bool))},
+	}
+	program := generateBytecode(t, `1 < 2;`)
+	assert.Equal(t, constants, program.Data)
+	assert.Equal(t, expected, program.Procedures[0].Instructions)
+
+	// each operand is evaluated once, and later comparisons are skipped
+	constants = map[string][]byte{
+		".LC1": Pack(int64(1)),
+		".LC2": Pack(int64(2)),
+		".LC3": Pack(2.5),
+	}
+	expected = []Instruction{
+		{LOAD, Constant(".LC1", Rg(1, Int64))},
+		{LOAD, Constant(".LC2", Rg(2, Int64))},
+		{LESS, Binary(Rg(1, Int64), Rg(2, Int64), Rg(0, Bool))},
+		{JUMP_FALSE, JumpFalse(Rg(0, Bool), 7)},
+		{LOAD, Constant(".LC3", Rg(3, Float64))},
+		{CAST_F64, Unary(Rg(2, Int64), Rg(4, Float64))},
+		{LESS_EQUAL, Binary(Rg(4, Float64), Rg(3, Float64), Rg(0, Bool))},
+	}
+	program = generateBytecode(t, `1 < 2 <= 2.5;`)
+	assert.Equal(t, constants, program.Data)
+	assert.Equal(t, expected, program.Procedures[0].Instructions)
+}
+
+func TestEncodeMembership(t *testing.T) {
+	constants := map[string][]byte{
+		".LC1": Pack(int64(5)),
+		".LC2": Pack(int64(1)),
+		".LC3": Pack(int64(10)),
+	}
+	expected := []Instruction{
+		{LOAD, Constant(".LC1", Rg(1, Int64))},
+		{LOAD, Constant(".LC2", Rg(2, Int64))},
+		{LOAD, Constant(".LC3", Rg(3, Int64))},
+		{LESS_EQUAL, Binary(Rg(2, Int64), Rg(1, Int64), Rg(0, Bool))},
+		{JUMP_FALSE, JumpFalse(Rg(0, Bool), 6)},
+		{LESS_EQUAL, Binary(Rg(1, Int64), Rg(3, Int64), Rg(0, Bool))},
+		{NOT, Unary(Rg(0, Bool), Rg(0, Bool))},
+	}
+	program := generateBytecode(t, `5 not in 1..10;`)
+	assert.Equal(t, constants, program.Data)
+	assert.Equal(t, expected, program.Procedures[0].Instructions)
+
+	// constant text is unrolled
+	constants = map[string][]byte{".LC1": Pack(uint32('a')), ".LC2": Pack(uint32('é'))}
+	expected = []Instruction{
+		{LOAD, Constant(".LC1", Rg(2, Uint32))},
+		{EQUAL, Binary(Rg(0, Uint32), Rg(2, Uint32), Rg(1, Bool))},
+		{JUMP_TRUE, JumpTrue(Rg(1, Bool), 5)},
+		{LOAD, Constant(".LC2", Rg(3, Uint32))},
+		{EQUAL, Binary(Rg(0, Uint32), Rg(3, Uint32), Rg(1, Bool))},
+		{RETURN, Nullary(Rg(1, Bool))},
+	}
+	program = generateBytecode(t, "{ accent :: (c: char) -> bool { return c in \"a\u00e9\"; } }")
+	assert.Equal(t, constants, program.Data)
+	assert.Equal(t, expected, program.Procedures[1].Instructions)
 }
 
 func TestEncodeBlock(t *testing.T) {
@@ -221,24 +418,24 @@ func TestEncodeBlock(t *testing.T) {
 		// xyzzy = 0700;
 		{LOAD, Constant(".LC5", Rg(5, Uint64))},
 		{COPY, Unary(Rg(5, Uint64), Rg(3, Uint64))},
-		// plugh = 0.25 * plugh;
+		// plugh = cast(int) (0.25 * plugh);
 		{LOAD, Constant(".LC6", Rg(6, Float64))},
 		{CAST_F64, Unary(Rg(2, Int64), Rg(7, Float64))},
 		{MULTIPLY, Binary(Rg(6, Float64), Rg(7, Float64), Rg(8, Float64))},
 		{CAST_I64, Unary(Rg(8, Float64), Rg(9, Int64))},
 		{COPY, Unary(Rg(9, Int64), Rg(2, Int64))},
-		// xyzzy, nerrf, plugh = plugh, (xyzzy / 5.0), nerrf;
+		// xyzzy, nerrf, plugh = plugh, cast(int) (xyzzy / 5.0), nerrf;
 		{COPY, Unary(Rg(2, Int64), Rg(10, Int64))},
 		{CAST_F64, Unary(Rg(3, Uint64), Rg(11, Float64))},
 		{LOAD, Constant(".LC7", Rg(12, Float64))},
 		{DIVIDE, Binary(Rg(11, Float64), Rg(12, Float64), Rg(13, Float64))},
-		{COPY, Unary(Rg(13, Float64), Rg(14, Float64))},
-		{COPY, Unary(Rg(4, Int64), Rg(15, Int64))},
-		{CAST_U64, Unary(Rg(10, Int64), Rg(16, Uint64))},
-		{COPY, Unary(Rg(16, Uint64), Rg(3, Uint64))},
-		{CAST_I64, Unary(Rg(14, Float64), Rg(17, Int64))},
-		{COPY, Unary(Rg(17, Int64), Rg(4, Int64))},
-		{COPY, Unary(Rg(15, Int64), Rg(2, Int64))},
+		{CAST_I64, Unary(Rg(13, Float64), Rg(14, Int64))},
+		{COPY, Unary(Rg(14, Int64), Rg(15, Int64))},
+		{COPY, Unary(Rg(4, Int64), Rg(16, Int64))},
+		{CAST_U64, Unary(Rg(10, Int64), Rg(17, Uint64))},
+		{COPY, Unary(Rg(17, Uint64), Rg(3, Uint64))},
+		{COPY, Unary(Rg(15, Int64), Rg(4, Int64))},
+		{COPY, Unary(Rg(16, Int64), Rg(2, Int64))},
 		// barrf := xyzzy * 10000 + nerrf * 100;
 		{LOAD, Constant(".LC8", Rg(18, Int64))},
 		{CAST_U64, Unary(Rg(18, Int64), Rg(19, Uint64))},
@@ -248,17 +445,16 @@ func TestEncodeBlock(t *testing.T) {
 		{CAST_U64, Unary(Rg(22, Int64), Rg(23, Uint64))},
 		{ADD, Binary(Rg(20, Uint64), Rg(23, Uint64), Rg(24, Uint64))},
 	}
-	// FIXME: This example will break with more strict with implict casts
 	program = generateBytecode(t, `{
 		plugh := 1 - 4;
 		xyzzy := 012;
 		nerrf := 14;
 
 		xyzzy = 0700;                      // assignment
-		plugh = 0.25 * plugh;              // assignment with cast
+		plugh = cast(int) (0.25 * plugh);  // assignment with cast
 
 		// parallel assignment (with and without casts)
-		xyzzy, nerrf, plugh = plugh, (xyzzy / 5.0), nerrf;
+		xyzzy, nerrf, plugh = plugh, cast(int) (xyzzy / 5.0), nerrf;
 		barrf := xyzzy * 10000 + nerrf * 100;
 	}`)
 	assert.Equal(t, constants, program.Data)
@@ -326,3 +522,45 @@ func TestEncodeBlock(t *testing.T) {
 		assert.True(t, asm.HasOutput)
 	}
 }
+
+func TestEncodeOverloads(t *testing.T) {
+	program := generateBytecode(t, `{
+		_sub_ :: (a: text, b: text) -> text { return a; }
+		"ab" - "cd";
+	}`)
+	assert.Equal(t, []byte("ab"), program.Data[".LC1"])
+	assert.Equal(t, []byte("cd"), program.Data[".LC3"])
+	assert.Equal(t, 1, program.Text["_sub_"])
+
+	insts := program.Procedures[0].Instructions
+	if assert.Equal(t, 7, len(insts)) {
+		assert.Equal(t, Inst(LOAD, ConstPtr(".LC1", Rg(0, Pointer))), insts[0])
+		assert.Equal(t, Inst(TEXT, Binary(Rg(0, Pointer), Rg(1, Int64), Rg(2, Text))), insts[2])
+		assert.Equal(t, Inst(LOAD, ConstPtr(".LC3", Rg(3, Pointer))), insts[3])
+		assert.Equal(t, CALL, insts[6].Op)
+
+		call := insts[6].Args.(ProcedureArgs)
+		assert.Equal(t, program.Procedures[1], call.Proc)
+		assert.Equal(t, []Register{Rg(2, Text), Rg(5, Text)}, call.In)
+	}
+}
+
+func TestEncodeText(t *testing.T) {
+	program := generateBytecode(t, `{
+		a := "ab";
+		b := a + "cd";
+		a < b;
+		a.count + b.count;
+		a[1];
+		a.data;
+	}`)
+	assert.Equal(t, Pack(int64(2)), program.Data[".LC2"])
+
+	var ops []Opcode
+	for _, inst := range program.Procedures[0].Instructions {
+		if inst.Op != LOAD && inst.Op != COPY {
+			ops = append(ops, inst.Op)
+		}
+	}
+	assert.Equal(t, []Opcode{TEXT, TEXT, CONCAT, LESS, COUNT, COUNT, ADD, INDEX, DATA}, ops)
+}
@@ -0,0 +1,143 @@
+package interpreter
+
+import (
+	"reflect"
+
+	"github.com/kestred/philomath/code/ast"
+	bc "github.com/kestred/philomath/code/bytecode"
+	"github.com/kestred/philomath/code/scanner"
+	"github.com/kestred/philomath/code/utils"
+)
+
+// RunDirectives evaluates each "#run" directive in a tree during compilation,
+// and splices its result back into the tree as a literal; a directive which
+// traps is reported as an error at the location of the directive.
+func RunDirectives(root ast.Node, nodes []ast.Node, checked bool) []error {
+	var runs []*ast.RunExpr
+	for _, node := range nodes {
+		if run, ok := node.(*ast.RunExpr); ok && !run.Ran {
+			runs = append(runs, run)
+		}
+	}
+	if len(runs) == 0 {
+		return nil
+	}
+
+	// the directives may call any procedure, so generate bytecode for all of them
+	program := bc.NewProgram()
+	program.Checked = checked
+	program.Extend(root)
+
+	var errs []error
+	for _, run := range runs {
+		proc, ok := program.Directive(run)
+		if !ok {
+			continue // the directive is nested in a directive which failed
+		}
+
+		// each directive is a separate run, whose state is released once its
+		// result has been spliced into the tree
+		m := newMachine()
+		result, err := m.evaluateSafely(proc)
+		if err != nil {
+			errs = append(errs, &RuntimeError{
+				Pos:   ast.PositionOf(run),
+				Msg:   `Failed to evaluate "` + directiveName(run) + `": ` + err.Msg,
+				Stack: err.Stack,
+			})
+			continue
+		}
+
+		value, err := m.spliceResult(program, run, result)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		run.Ran = true
+		run.Result = value
+	}
+	return errs
+}
+
+// directiveName returns the name of the directive which is evaluated by a
+// run expression (eg. the condition of an "#assert" is evaluated like a "#run").
+func directiveName(run *ast.RunExpr) string {
+	if _, ok := run.GetParent().(*ast.AssertDirective); ok {
+		return "#assert"
+	}
+	return "#run"
+}
+
+// spliceResult converts the result of a directive into a literal.
+func (m *machine) spliceResult(program *bc.Program, run *ast.RunExpr, result []byte) (ast.Expr, *RuntimeError) {
+	if run.Type == ast.BuiltinEmpty {
+		return nil, nil
+	}
+
+	var lit ast.Expr
+	switch typ := bc.TypeFromAst(run.Type); typ {
+	case bc.Text:
+		data := append([]byte{}, m.textData(bc.Instruction{}, [][]byte{result}, bc.Rg(0, bc.Text))...)
+		text := ast.TxtLit(scanner.Quote(data))
+		text.Type = run.Type
+		text.Value = data
+		lit = text
+
+	case bc.Bool:
+		var value bool
+		unpackRegister(bc.Instruction{}, [][]byte{result}, 0, &value)
+		ast.SetConstant(run, value) // there are no literals for booleans
+		return nil, nil
+
+	default:
+		rg := bc.Rg(0, typ)
+		num := ast.NumLit(printRegister(bc.Instruction{}, [][]byte{result}, rg))
+		num.Type = run.Type
+		switch {
+		case isFloatRegister(typ):
+			num.Value = unpackFloat(bc.Instruction{}, [][]byte{result}, rg)
+		case isSignedRegister(typ):
+			num.Value = int64(unpackInteger(bc.Instruction{}, [][]byte{result}, rg))
+		default:
+			num.Value = unpackInteger(bc.Instruction{}, [][]byte{result}, rg)
+		}
+		ast.SetConstant(num, exactValue(result, typ))
+		lit = num
+	}
+
+	lit.SetParent(run)
+	ast.SetPosition(lit, ast.PositionOf(run))
+	return lit, nil
+}
+
+// exactValue unpacks a number with the Go type which represents its register.
+func exactValue(data []byte, typ bc.Type) ast.Value {
+	var ptr interface{}
+	switch typ {
+	case bc.Int8:
+		ptr = new(int8)
+	case bc.Int16:
+		ptr = new(int16)
+	case bc.Int32:
+		ptr = new(int32)
+	case bc.Int64:
+		ptr = new(int64)
+	case bc.Uint8:
+		ptr = new(uint8)
+	case bc.Uint16:
+		ptr = new(uint16)
+	case bc.Uint32:
+		ptr = new(uint32)
+	case bc.Uint64:
+		ptr = new(uint64)
+	case bc.Float32:
+		ptr = new(float32)
+	case bc.Float64:
+		ptr = new(float64)
+	default:
+		utils.Errorf("Unhandled register type '%s' in the result of a directive", typ)
+		utils.InvalidCodePath()
+	}
+	unpackRegister(bc.Instruction{}, [][]byte{data}, 0, ptr)
+	return reflect.ValueOf(ptr).Elem().Interface()
+}
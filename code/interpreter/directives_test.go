@@ -0,0 +1,81 @@
+package interpreter
+
+import (
+	"testing"
+
+	"github.com/kestred/philomath/code/ast"
+	"github.com/kestred/philomath/code/parser"
+	"github.com/kestred/philomath/code/semantics"
+	"github.com/stretchr/testify/assert"
+
+	bc "github.com/kestred/philomath/code/bytecode"
+)
+
+func runDirectives(t *testing.T, input string) (ast.Node, []error) {
+	p := parser.Make("example", false, []byte(input))
+	node := p.ParseEvaluable()
+	assert.Empty(t, p.Errors, "Unexpected parser errors")
+	section := semantics.FlattenTree(node, nil)
+	semantics.ResolveNames(&section)
+	semantics.InferTypes(&section)
+	assert.Empty(t, semantics.CheckTypes(&section), "Unexpected type-checking errors")
+	return node, RunDirectives(node, section.Nodes, true)
+}
+
+func TestRunDirectives(t *testing.T) {
+	node, errs := runDirectives(t, `{
+		square :: (n: int) -> int { return n * n; };
+		x :: #run { a := 2; a * 3; };
+		#run square(x) + 1;
+	}`)
+	assert.Empty(t, errs)
+
+	block := node.(*ast.Block)
+	decl := block.Nodes[1].(*ast.ImmutableDecl)
+	run := decl.Defn.(*ast.ConstantDefn).Expr.(*ast.RunExpr)
+	assert.True(t, run.Ran)
+	if lit, ok := run.Result.(*ast.NumberLiteral); assert.True(t, ok) {
+		assert.Equal(t, "6", lit.Literal)
+		assert.Equal(t, int64(6), lit.Value)
+	}
+
+	// the results are used instead of running the directives again
+	program := bc.NewProgram()
+	program.Extend(node)
+	assert.Equal(t, bc.Pack(int64(37)), Evaluate(program.Procedures[0], nil))
+
+	// text results are spliced back as text literals
+	node, errs = runDirectives(t, `#run "hello";`)
+	assert.Empty(t, errs)
+	run = node.(*ast.EvalStmt).Expr.(*ast.RunExpr)
+	if lit, ok := run.Result.(*ast.TextLiteral); assert.True(t, ok) {
+		assert.Equal(t, []byte("hello"), lit.Value)
+	}
+}
+
+func TestReportDirectiveErrors(t *testing.T) {
+	_, errs := runDirectives(t, `{ a: i8 = 100; #run { b: i8 = 100; b + 100; }; }`)
+	if assert.Equal(t, 1, len(errs)) {
+		err := errs[0].(*RuntimeError)
+		assert.Equal(t, "example:1:16", err.Pos.String())
+		assert.Equal(t, `Failed to evaluate "#run": Integer overflow: 100 + 100 can't be represented as Int8`, err.Msg)
+	}
+}
+
+func TestRunAssertions(t *testing.T) {
+	_, errs := runDirectives(t, `{
+		square :: (n: int) -> int { return n * n; };
+		#assert square(3) == 9, "squares are broken";
+	}`)
+	assert.Empty(t, errs)
+
+	_, errs = runDirectives(t, `{
+		div :: (n: int, d: int) -> int { return n / d; };
+		#assert div(3, 3 - 3) == 1;
+	}`)
+	if assert.Equal(t, 1, len(errs)) {
+		err := errs[0].(*RuntimeError)
+		assert.Equal(t, "example:3:3", err.Pos.String())
+		assert.Equal(t, `Failed to evaluate "#assert": Division by zero`, err.Msg)
+	}
+}
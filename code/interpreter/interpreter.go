@@ -1,23 +1,129 @@
 package interpreter
 
 import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/bits"
+	"unicode/utf8"
 	"unsafe"
 
 	bc "github.com/kestred/philomath/code/bytecode"
+	"github.com/kestred/philomath/code/token"
 	"github.com/kestred/philomath/code/utils"
 )
 
-func Run(prog *bc.Program) []byte {
+// A RuntimeError is raised (as a panic) when an instruction traps during
+// evaluation (eg. a checked cast of a value that is out of range).
+type RuntimeError struct {
+	Pos   token.Position
+	Msg   string
+	Stack []StackFrame // innermost procedure first
+}
+
+// A StackFrame is a procedure which was being evaluated when an error
+// occurred, and the position it had reached in that procedure.
+type StackFrame struct {
+	Procedure string
+	Pos       token.Position
+}
+
+func (e *RuntimeError) Error() string {
+	var buf bytes.Buffer
+	if e.Pos.IsValid() {
+		buf.WriteString(e.Pos.String() + ": ")
+	}
+	buf.WriteString(e.Msg)
+	for _, frame := range e.Stack {
+		if !frame.Pos.IsValid() {
+			continue // eg. the call to "main" which has no source
+		}
+		fmt.Fprintf(&buf, "\n\tin %s (%s)", frame.Procedure, frame.Pos)
+	}
+	return buf.String()
+}
+
+// A machine is the state of a single run of the interpreter (eg. of a program,
+// or of a directive), which is released when the run ends.
+type machine struct {
+	// the cells of variables captured by nested procedures, which are shared
+	// by every procedure that uses them
+	cells [][]byte
+
+	// the buffers which contain the data of text, by address; the data of a
+	// constant is added when it is loaded, and each concatenation allocates a
+	// new buffer
+	buffers map[uint64][]byte
+}
+
+func newMachine() *machine {
+	return &machine{buffers: make(map[uint64][]byte)}
+}
+
+// A textValue is the representation of text in a register.
+type textValue struct {
+	Data  uint64
+	Count int64
+}
+
+func trap(format string, args ...interface{}) {
+	panic(&RuntimeError{Msg: fmt.Sprintf(format, args...)})
+}
+
+func Run(prog *bc.Program) ([]byte, error) {
 	start := prog.Procedures[prog.Text["start_"]]
 	out := bc.Rg(start.AssignLocation(), start.PrevResult.Typ)
 	proc := prog.Procedures[prog.Text["main"]]
 	call := bc.Inst(bc.CALL, bc.Proc(proc, out, nil))
 	start.Instructions = append(start.Instructions, call)
-	return Evaluate(start, nil)
+
+	result, err := newMachine().evaluateSafely(start)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
 }
 
-// HACK: for now, Evaluate will return whatever the result of the last instruction is
-func Evaluate(proc bc.Procedure, args [][]byte) []byte {
+// evaluateSafely evaluates a procedure, returning an error instead of
+// panicking if any of its instructions trap.
+func (m *machine) evaluateSafely(proc *bc.Procedure) (result []byte, err *RuntimeError) {
+	defer func() {
+		if r := recover(); r != nil {
+			rerr, ok := r.(*RuntimeError)
+			if !ok {
+				panic(r)
+			}
+			err = rerr
+		}
+	}()
+
+	return m.evaluate(proc, nil), nil
+}
+
+// Evaluate evaluates a procedure in a new run of the interpreter.
+func Evaluate(proc *bc.Procedure, args [][]byte) []byte {
+	return newMachine().evaluate(proc, args)
+}
+
+// HACK: for now, evaluate will return whatever the result of the last instruction is
+func (m *machine) evaluate(proc *bc.Procedure, args [][]byte) []byte {
+	pc := 0
+	defer func() {
+		if r := recover(); r != nil {
+			if err, ok := r.(*RuntimeError); ok {
+				var pos token.Position
+				if pc < len(proc.Positions) {
+					pos = proc.Positions[pc]
+				}
+				if len(err.Stack) == 0 {
+					err.Pos = pos
+				}
+				err.Stack = append(err.Stack, StackFrame{proc.Name, pos})
+			}
+			panic(r)
+		}
+	}()
+
 	registers := make([][]byte, uint(proc.NextFree))
 	for i, arg := range proc.Arguments {
 		registers[arg.Loc] = args[i]
@@ -36,11 +142,18 @@ func Evaluate(proc bc.Procedure, args [][]byte) []byte {
 			returnRegister = args.Out
 		case bc.ProcedureArgs:
 			returnRegister = args.Out
+		case bc.IndirectArgs:
+			returnRegister = args.Out
+		case bc.TupleArgs:
+			if inst.Op == bc.PACK {
+				returnRegister = args.Tuple
+			}
 		}
 	}
 
 InstructionLoop:
-	for _, inst := range proc.Instructions {
+	for ; pc < len(proc.Instructions); pc++ {
+		inst := proc.Instructions[pc]
 		switch inst.Op {
 		case bc.NOOP:
 			continue
@@ -51,9 +164,7 @@ InstructionLoop:
 			switch args := inst.Args.(type) {
 			case bc.ConstantArgs:
 				if args.Ptr {
-					ptr := &proc.Program.Data[args.Name][0]
-					raw := uint64(uintptr(unsafe.Pointer(ptr)))
-					registers[args.Out.Loc] = bc.Pack(raw)
+					registers[args.Out.Loc] = bc.Pack(m.addressOf(proc.Program.Data[args.Name]))
 				} else {
 					registers[args.Out.Loc] = proc.Program.Data[args.Name]
 				}
@@ -61,6 +172,87 @@ InstructionLoop:
 				utils.NotImplemented("Loading data from a non-constant pointer during interpretation")
 				// registers[args.Out] = proc.Program.Constants[args.Left]
 			}
+		case bc.PACK:
+			// each element is prefixed by its size, because a register may be
+			// larger than its type (eg. a number literal is packed as 64-bit)
+			args := inst.Args.(bc.TupleArgs)
+			var tuple []byte
+			for _, element := range args.Elements {
+				tuple = append(tuple, bc.Pack(uint32(len(registers[element.Loc])))...)
+				tuple = append(tuple, registers[element.Loc]...)
+			}
+			registers[args.Tuple.Loc] = tuple
+		case bc.UNPACK:
+			args := inst.Args.(bc.TupleArgs)
+			for i, element := range unpackTuple(registers[args.Tuple.Loc]) {
+				registers[args.Elements[i].Loc] = element
+			}
+		case bc.INDEX:
+			args := inst.Args.(bc.BinaryArgs)
+			var index int64
+			unpackRegister(inst, registers, args.Right.Loc, &index)
+			if args.Left.Typ == bc.Text {
+				data := m.textData(inst, registers, args.Left)
+				if index < 0 || index >= int64(len(data)) {
+					trap("The index %d is out of range for text of %d bytes", index, len(data))
+				}
+				registers[args.Out.Loc] = bc.Pack(data[index])
+				break
+			}
+			elements := unpackTuple(registers[args.Left.Loc])
+			if index < 0 || index >= int64(len(elements)) {
+				trap("The index %d is out of range for an array of %d elements", index, len(elements))
+			}
+			registers[args.Out.Loc] = elements[index]
+		case bc.COUNT:
+			args := inst.Args.(bc.UnaryArgs)
+			if args.In.Typ == bc.Text {
+				registers[args.Out.Loc] = bc.Pack(unpackText(inst, registers, args.In).Count)
+				break
+			}
+			registers[args.Out.Loc] = bc.Pack(int64(len(unpackTuple(registers[args.In.Loc]))))
+		case bc.TEXT:
+			args := inst.Args.(bc.BinaryArgs)
+			var text textValue
+			unpackRegister(inst, registers, args.Left.Loc, &text.Data)
+			unpackRegister(inst, registers, args.Right.Loc, &text.Count)
+			registers[args.Out.Loc] = bc.Pack(text)
+		case bc.DATA:
+			args := inst.Args.(bc.UnaryArgs)
+			registers[args.Out.Loc] = bc.Pack(unpackText(inst, registers, args.In).Data)
+		case bc.CONCAT:
+			args := inst.Args.(bc.BinaryArgs)
+			left, right := m.textData(inst, registers, args.Left), m.textData(inst, registers, args.Right)
+			data := make([]byte, 0, len(left)+len(right))
+			data = append(append(data, left...), right...)
+			registers[args.Out.Loc] = bc.Pack(textValue{m.addressOf(data), int64(len(data))})
+		case bc.DECODE:
+			args := inst.Args.(bc.BinaryArgs)
+			var index int64
+			unpackRegister(inst, registers, args.Right.Loc, &index)
+			data := m.textData(inst, registers, args.Left)
+			if index < 0 || index >= int64(len(data)) {
+				trap("The index %d is out of range for text of %d bytes", index, len(data))
+			}
+			char, size := utf8.DecodeRune(data[index:])
+			if char == utf8.RuneError && size == 1 {
+				char = -1 // eg. a continuation byte
+			}
+			registers[args.Out.Loc] = bc.Pack(uint32(char))
+		case bc.CELL:
+			args := inst.Args.(bc.UnaryArgs)
+			m.cells = append(m.cells, registers[args.In.Loc])
+			registers[args.Out.Loc] = bc.Pack(int64(len(m.cells) - 1))
+		case bc.LOAD_CELL:
+			args := inst.Args.(bc.UnaryArgs)
+			var cell int64
+			unpackRegister(inst, registers, args.In.Loc, &cell)
+			registers[args.Out.Loc] = m.cells[cell]
+		case bc.STORE_CELL:
+			args := inst.Args.(bc.UnaryArgs)
+			var cell int64
+			unpackRegister(inst, registers, args.Out.Loc, &cell)
+			m.cells[cell] = registers[args.In.Loc]
 		case bc.CALL:
 			proc := inst.Args.(bc.ProcedureArgs)
 			args := make([][]byte, len(proc.In))
@@ -68,10 +260,27 @@ InstructionLoop:
 				args[i] = registers[in.Loc]
 			}
 
-			ret := Evaluate(proc.Proc, args)
+			ret := m.evaluate(proc.Proc, args)
 			if proc.Out.Loc >= 0 {
 				registers[proc.Out.Loc] = ret
 			}
+		case bc.CALL_INDIRECT:
+			call := inst.Args.(bc.IndirectArgs)
+			args := make([][]byte, len(call.In))
+			for i, in := range call.In {
+				args[i] = registers[in.Loc]
+			}
+
+			// a procedure value is its index in the procedure table, followed by
+			// the cells of its captured variables
+			closure := unpackTuple(registers[call.Proc.Loc])
+			var index int64
+			bc.Unpack(closure[0], &index)
+			args = append(args, closure[1:]...)
+			ret := m.evaluate(proc.Program.Procedures[index], args)
+			if call.Out.Loc >= 0 {
+				registers[call.Out.Loc] = ret
+			}
 		case bc.CALL_ASM:
 			asm := inst.Args.(*bc.AssemblyArgs)
 			CallAsm(asm, registers)
@@ -79,121 +288,131 @@ InstructionLoop:
 			returnRegister = inst.Args.(bc.NullaryArgs).Rg
 			break InstructionLoop
 
-		// signed 64-bit arithmetic
-		case bc.ADD:
-			args := inst.Args.(bc.BinaryArgs)
-			switch args.Left.Typ {
-			case bc.Int64:
-				var left, right int64
-				unpackRegister(inst, registers, args.Left.Loc, &left)
-				unpackRegister(inst, registers, args.Right.Loc, &right)
-				registers[args.Out.Loc] = bc.Pack(left + right)
-			case bc.Uint64:
-				var left, right uint64
-				unpackRegister(inst, registers, args.Left.Loc, &left)
-				unpackRegister(inst, registers, args.Right.Loc, &right)
-				registers[args.Out.Loc] = bc.Pack(left + right)
-			case bc.Float64:
-				var left, right float64
-				unpackRegister(inst, registers, args.Left.Loc, &left)
-				unpackRegister(inst, registers, args.Right.Loc, &right)
-				registers[args.Out.Loc] = bc.Pack(left + right)
+		// control flow
+		case bc.JUMP:
+			pc = inst.Args.(bc.JumpArgs).Target - 1
+		case bc.JUMP_TRUE:
+			args := inst.Args.(bc.JumpArgs)
+			var cond bool
+			unpackRegister(inst, registers, args.Cond.Loc, &cond)
+			if cond {
+				pc = args.Target - 1
 			}
-		case bc.SUBTRACT:
-			args := inst.Args.(bc.BinaryArgs)
-			switch args.Left.Typ {
-			case bc.Int64:
-				var left, right int64
-				unpackRegister(inst, registers, args.Left.Loc, &left)
-				unpackRegister(inst, registers, args.Right.Loc, &right)
-				registers[args.Out.Loc] = bc.Pack(left - right)
-			case bc.Uint64:
-				var left, right uint64
-				unpackRegister(inst, registers, args.Left.Loc, &left)
-				unpackRegister(inst, registers, args.Right.Loc, &right)
-				registers[args.Out.Loc] = bc.Pack(left - right)
-			case bc.Float64:
-				var left, right float64
-				unpackRegister(inst, registers, args.Left.Loc, &left)
-				unpackRegister(inst, registers, args.Right.Loc, &right)
-				registers[args.Out.Loc] = bc.Pack(left - right)
+		case bc.JUMP_FALSE:
+			args := inst.Args.(bc.JumpArgs)
+			var cond bool
+			unpackRegister(inst, registers, args.Cond.Loc, &cond)
+			if !cond {
+				pc = args.Target - 1
 			}
-		case bc.MULTIPLY:
+
+		// arithmetic (integers wrap-around at the width of their register,
+		// unless the program is checked in which case overflow traps)
+		case bc.ADD, bc.SUBTRACT, bc.MULTIPLY, bc.DIVIDE, bc.REMAINDER:
 			args := inst.Args.(bc.BinaryArgs)
-			switch args.Left.Typ {
-			case bc.Int64:
-				var left, right int64
-				unpackRegister(inst, registers, args.Left.Loc, &left)
-				unpackRegister(inst, registers, args.Right.Loc, &right)
-				registers[args.Out.Loc] = bc.Pack(left * right)
-			case bc.Uint64:
-				var left, right uint64
-				unpackRegister(inst, registers, args.Left.Loc, &left)
-				unpackRegister(inst, registers, args.Right.Loc, &right)
-				registers[args.Out.Loc] = bc.Pack(left * right)
-			case bc.Float64:
-				var left, right float64
-				unpackRegister(inst, registers, args.Left.Loc, &left)
-				unpackRegister(inst, registers, args.Right.Loc, &right)
-				registers[args.Out.Loc] = bc.Pack(left * right)
+			if isFloatRegister(args.Left.Typ) {
+				left, right := unpackFloat(inst, registers, args.Left), unpackFloat(inst, registers, args.Right)
+				registers[args.Out.Loc] = packFloat(args.Out.Typ, floatArithmetic(inst.Op, left, right))
+				break
 			}
-		case bc.DIVIDE:
+
+			left, right := unpackInteger(inst, registers, args.Left), unpackInteger(inst, registers, args.Right)
+			if right == 0 && (inst.Op == bc.DIVIDE || inst.Op == bc.REMAINDER) {
+				trap("Division by zero")
+			}
+
+			result, overflow := integerArithmetic(inst.Op, args.Left.Typ, left, right)
+			if overflow && proc.Program.Checked {
+				trap("Integer overflow: %s %s %s can't be represented as %s",
+					printRegister(inst, registers, args.Left), arithmeticSymbols[inst.Op],
+					printRegister(inst, registers, args.Right), args.Out.Typ)
+			}
+			registers[args.Out.Loc] = packInteger(args.Out.Typ, result)
+		case bc.NEGATE:
+			args := inst.Args.(bc.UnaryArgs)
+			if isFloatRegister(args.In.Typ) {
+				registers[args.Out.Loc] = packFloat(args.Out.Typ, -unpackFloat(inst, registers, args.In))
+				break
+			}
+
+			result, overflow := integerArithmetic(bc.SUBTRACT, args.In.Typ, 0, unpackInteger(inst, registers, args.In))
+			if overflow && proc.Program.Checked {
+				trap("Integer overflow: -(%s) can't be represented as %s",
+					printRegister(inst, registers, args.In), args.Out.Typ)
+			}
+			registers[args.Out.Loc] = packInteger(args.Out.Typ, result)
+
+		// bitwise operations
+		case bc.BIT_AND:
 			args := inst.Args.(bc.BinaryArgs)
-			switch args.Left.Typ {
-			case bc.Int64:
-				var left, right int64
-				unpackRegister(inst, registers, args.Left.Loc, &left)
-				unpackRegister(inst, registers, args.Right.Loc, &right)
-				registers[args.Out.Loc] = bc.Pack(left / right)
-			case bc.Uint64:
-				var left, right uint64
-				unpackRegister(inst, registers, args.Left.Loc, &left)
-				unpackRegister(inst, registers, args.Right.Loc, &right)
-				registers[args.Out.Loc] = bc.Pack(left / right)
-			case bc.Float64:
-				var left, right float64
-				unpackRegister(inst, registers, args.Left.Loc, &left)
-				unpackRegister(inst, registers, args.Right.Loc, &right)
-				registers[args.Out.Loc] = bc.Pack(left / right)
+			left, right := unpackInteger(inst, registers, args.Left), unpackInteger(inst, registers, args.Right)
+			registers[args.Out.Loc] = packInteger(args.Out.Typ, left&right)
+		case bc.BIT_OR:
+			args := inst.Args.(bc.BinaryArgs)
+			left, right := unpackInteger(inst, registers, args.Left), unpackInteger(inst, registers, args.Right)
+			registers[args.Out.Loc] = packInteger(args.Out.Typ, left|right)
+		case bc.BIT_XOR:
+			args := inst.Args.(bc.BinaryArgs)
+			left, right := unpackInteger(inst, registers, args.Left), unpackInteger(inst, registers, args.Right)
+			registers[args.Out.Loc] = packInteger(args.Out.Typ, left^right)
+		case bc.BIT_NOT:
+			args := inst.Args.(bc.UnaryArgs)
+			in := unpackInteger(inst, registers, args.In)
+			registers[args.Out.Loc] = packInteger(args.Out.Typ, ^in)
+		case bc.SHIFT_LEFT:
+			args := inst.Args.(bc.BinaryArgs)
+			left, count := unpackInteger(inst, registers, args.Left), shiftCount(inst, registers, args, proc.Program.Checked)
+			registers[args.Out.Loc] = packInteger(args.Out.Typ, left<<count)
+		case bc.SHIFT_RIGHT:
+			args := inst.Args.(bc.BinaryArgs)
+			left, count := unpackInteger(inst, registers, args.Left), shiftCount(inst, registers, args, proc.Program.Checked)
+			if isSignedRegister(args.Left.Typ) {
+				registers[args.Out.Loc] = packInteger(args.Out.Typ, uint64(int64(left)>>count))
+			} else {
+				registers[args.Out.Loc] = packInteger(args.Out.Typ, left>>count)
 			}
 
-		// conversions
-		case bc.CAST_I64:
+		// comparisons
+		case bc.EQUAL:
+			args := inst.Args.(bc.BinaryArgs)
+			cmp, ordered := m.compareRegisters(inst, registers, args)
+			registers[args.Out.Loc] = bc.Pack(ordered && cmp == 0)
+		case bc.LESS:
+			args := inst.Args.(bc.BinaryArgs)
+			cmp, ordered := m.compareRegisters(inst, registers, args)
+			registers[args.Out.Loc] = bc.Pack(ordered && cmp < 0)
+		case bc.LESS_EQUAL:
+			args := inst.Args.(bc.BinaryArgs)
+			cmp, ordered := m.compareRegisters(inst, registers, args)
+			registers[args.Out.Loc] = bc.Pack(ordered && cmp <= 0)
+		case bc.GREATER:
+			args := inst.Args.(bc.BinaryArgs)
+			cmp, ordered := m.compareRegisters(inst, registers, args)
+			registers[args.Out.Loc] = bc.Pack(ordered && cmp > 0)
+		case bc.GREATER_EQUAL:
+			args := inst.Args.(bc.BinaryArgs)
+			cmp, ordered := m.compareRegisters(inst, registers, args)
+			registers[args.Out.Loc] = bc.Pack(ordered && cmp >= 0)
+
+		case bc.NOT:
 			args := inst.Args.(bc.UnaryArgs)
-			switch args.In.Typ {
-			case bc.Uint64:
-				var in uint64
-				unpackRegister(inst, registers, args.In.Loc, &in)
-				registers[args.Out.Loc] = bc.Pack(int64(in))
-			case bc.Float64:
-				var in float64
-				unpackRegister(inst, registers, args.In.Loc, &in)
-				registers[args.Out.Loc] = bc.Pack(int64(in))
-			}
-		case bc.CAST_U64:
+			var in bool
+			unpackRegister(inst, registers, args.In.Loc, &in)
+			registers[args.Out.Loc] = bc.Pack(!in)
+
+		// conversions
+		case bc.CAST_I8, bc.CAST_I16, bc.CAST_I32, bc.CAST_I64,
+			bc.CAST_U8, bc.CAST_U16, bc.CAST_U32, bc.CAST_U64,
+			bc.CAST_F32, bc.CAST_F64:
 			args := inst.Args.(bc.UnaryArgs)
-			switch args.In.Typ {
-			case bc.Int64:
-				var in int64
-				unpackRegister(inst, registers, args.In.Loc, &in)
-				registers[args.Out.Loc] = bc.Pack(uint64(in))
-			case bc.Float64:
-				var in float64
-				unpackRegister(inst, registers, args.In.Loc, &in)
-				registers[args.Out.Loc] = bc.Pack(uint64(in))
-			}
-		case bc.CAST_F64:
+			registers[args.Out.Loc] = convertRegister(inst, registers, args.In, args.Out.Typ)
+		case bc.CAST_CHECKED:
 			args := inst.Args.(bc.UnaryArgs)
-			switch args.In.Typ {
-			case bc.Int64:
-				var in int64
-				unpackRegister(inst, registers, args.In.Loc, &in)
-				registers[args.Out.Loc] = bc.Pack(float64(in))
-			case bc.Uint64:
-				var in uint64
-				unpackRegister(inst, registers, args.In.Loc, &in)
-				registers[args.Out.Loc] = bc.Pack(float64(in))
+			if !isRepresentable(inst, registers, args.In, args.Out.Typ) {
+				trap("The value %s is out of range for a cast to %s",
+					printRegister(inst, registers, args.In), args.Out.Typ)
 			}
+			registers[args.Out.Loc] = convertRegister(inst, registers, args.In, args.Out.Typ)
 
 		default:
 			utils.Errorf("Unhandled opcode '%s' in interpreter", inst.Op)
@@ -208,6 +427,353 @@ InstructionLoop:
 	}
 }
 
+var arithmeticSymbols = map[bc.Opcode]string{
+	bc.ADD:       "+",
+	bc.SUBTRACT:  "-",
+	bc.MULTIPLY:  "*",
+	bc.DIVIDE:    "/",
+	bc.REMAINDER: "%",
+}
+
+func floatArithmetic(op bc.Opcode, left float64, right float64) float64 {
+	switch op {
+	case bc.ADD:
+		return left + right
+	case bc.SUBTRACT:
+		return left - right
+	case bc.MULTIPLY:
+		return left * right
+	case bc.DIVIDE:
+		return left / right
+	default:
+		return math.Mod(left, right)
+	}
+}
+
+// integerArithmetic evaluates an arithmetic operation on integers of the given
+// type, reporting whether the result overflows the width of the type; the
+// result is returned wrapped-around in 64-bits.  The right operand of a
+// division must not be zero.
+func integerArithmetic(op bc.Opcode, typ bc.Type, left uint64, right uint64) (result uint64, overflow bool) {
+	if isSignedRegister(typ) {
+		a, b := int64(left), int64(right)
+		var r int64
+		switch op {
+		case bc.ADD:
+			r = a + b
+			overflow = (a^r)&(b^r) < 0
+		case bc.SUBTRACT:
+			r = a - b
+			overflow = (a^b)&(a^r) < 0
+		case bc.MULTIPLY:
+			r = a * b
+			overflow = a != 0 && (r/a != b || (a == -1 && b == math.MinInt64))
+		case bc.DIVIDE:
+			r = a / b
+			overflow = a == math.MinInt64 && b == -1
+		case bc.REMAINDER:
+			r = a % b
+		}
+
+		width := registerBits(typ)
+		overflow = overflow || r != (r<<(64-width))>>(64-width)
+		return uint64(r), overflow
+	}
+
+	var carry uint64
+	switch op {
+	case bc.ADD:
+		result, carry = bits.Add64(left, right, 0)
+	case bc.SUBTRACT:
+		result, carry = bits.Sub64(left, right, 0)
+	case bc.MULTIPLY:
+		carry, result = bits.Mul64(left, right)
+	case bc.DIVIDE:
+		result = left / right
+	case bc.REMAINDER:
+		result = left % right
+	}
+
+	width := registerBits(typ)
+	overflow = carry != 0 || (width < 64 && result>>width != 0)
+	return result, overflow
+}
+
+// compareRegisters returns -1, 0, or +1 when the left operand is less than,
+// equal to, or greater than the right operand; the comparison is unordered if
+// either operand is NaN.
+func (m *machine) compareRegisters(inst bc.Instruction, registers [][]byte, args bc.BinaryArgs) (cmp int, ordered bool) {
+	switch {
+	case args.Left.Typ == bc.Text:
+		return bytes.Compare(m.textData(inst, registers, args.Left), m.textData(inst, registers, args.Right)), true
+	case isFloatRegister(args.Left.Typ):
+		left, right := unpackFloat(inst, registers, args.Left), unpackFloat(inst, registers, args.Right)
+		return compareOrdered(left < right, left > right), left == left && right == right
+	case isSignedRegister(args.Left.Typ):
+		left, right := int64(unpackInteger(inst, registers, args.Left)), int64(unpackInteger(inst, registers, args.Right))
+		return compareOrdered(left < right, left > right), true
+	case args.Left.Typ == bc.Bool:
+		var left, right bool
+		unpackRegister(inst, registers, args.Left.Loc, &left)
+		unpackRegister(inst, registers, args.Right.Loc, &right)
+		return compareOrdered(!left && right, left && !right), true
+	default:
+		left, right := unpackInteger(inst, registers, args.Left), unpackInteger(inst, registers, args.Right)
+		return compareOrdered(left < right, left > right), true
+	}
+}
+
+func compareOrdered(less bool, greater bool) int {
+	if less {
+		return -1
+	} else if greater {
+		return +1
+	} else {
+		return 0
+	}
+}
+
+// unpackInteger reads an integer register of any width as 64-bits; signed
+// values are sign-extended so that their 64-bit value is unchanged.
+func unpackInteger(inst bc.Instruction, registers [][]byte, rg bc.Register) uint64 {
+	switch rg.Typ {
+	case bc.Uint8:
+		var v uint8
+		unpackRegister(inst, registers, rg.Loc, &v)
+		return uint64(v)
+	case bc.Uint16:
+		var v uint16
+		unpackRegister(inst, registers, rg.Loc, &v)
+		return uint64(v)
+	case bc.Uint32:
+		var v uint32
+		unpackRegister(inst, registers, rg.Loc, &v)
+		return uint64(v)
+	case bc.Uint64:
+		var v uint64
+		unpackRegister(inst, registers, rg.Loc, &v)
+		return v
+	case bc.Int8:
+		var v int8
+		unpackRegister(inst, registers, rg.Loc, &v)
+		return uint64(v)
+	case bc.Int16:
+		var v int16
+		unpackRegister(inst, registers, rg.Loc, &v)
+		return uint64(v)
+	case bc.Int32:
+		var v int32
+		unpackRegister(inst, registers, rg.Loc, &v)
+		return uint64(v)
+	case bc.Int64:
+		var v int64
+		unpackRegister(inst, registers, rg.Loc, &v)
+		return uint64(v)
+	default:
+		utils.Errorf("Unhandled register type '%s' in integer operation", rg.Typ)
+		utils.InvalidCodePath()
+		return 0
+	}
+}
+
+// packInteger truncates a 64-bit integer to the width of a register.
+func packInteger(typ bc.Type, v uint64) []byte {
+	switch typ {
+	case bc.Uint8, bc.Int8:
+		return bc.Pack(uint8(v))
+	case bc.Uint16, bc.Int16:
+		return bc.Pack(uint16(v))
+	case bc.Uint32, bc.Int32:
+		return bc.Pack(uint32(v))
+	case bc.Uint64, bc.Int64:
+		return bc.Pack(v)
+	default:
+		utils.Errorf("Unhandled register type '%s' in integer operation", typ)
+		utils.InvalidCodePath()
+		return nil
+	}
+}
+
+// unpackFloat reads a float register of any width as 64-bits.
+func unpackFloat(inst bc.Instruction, registers [][]byte, rg bc.Register) float64 {
+	switch rg.Typ {
+	case bc.Float32:
+		var v float32
+		unpackRegister(inst, registers, rg.Loc, &v)
+		return float64(v)
+	case bc.Float64:
+		var v float64
+		unpackRegister(inst, registers, rg.Loc, &v)
+		return v
+	default:
+		utils.Errorf("Unhandled register type '%s' in float operation", rg.Typ)
+		utils.InvalidCodePath()
+		return 0
+	}
+}
+
+// packFloat rounds a 64-bit float to the width of a register.
+func packFloat(typ bc.Type, v float64) []byte {
+	switch typ {
+	case bc.Float32:
+		return bc.Pack(float32(v))
+	case bc.Float64:
+		return bc.Pack(v)
+	default:
+		utils.Errorf("Unhandled register type '%s' in float operation", typ)
+		utils.InvalidCodePath()
+		return nil
+	}
+}
+
+// convertRegister converts the value of a number register to another type.
+func convertRegister(inst bc.Instruction, registers [][]byte, in bc.Register, to bc.Type) []byte {
+	switch {
+	case isFloatRegister(in.Typ) && isFloatRegister(to):
+		return packFloat(to, unpackFloat(inst, registers, in))
+	case isFloatRegister(in.Typ) && isSignedRegister(to):
+		return packInteger(to, uint64(int64(unpackFloat(inst, registers, in))))
+	case isFloatRegister(in.Typ):
+		return packInteger(to, uint64(unpackFloat(inst, registers, in)))
+	case isFloatRegister(to) && isSignedRegister(in.Typ):
+		return packFloat(to, float64(int64(unpackInteger(inst, registers, in))))
+	case isFloatRegister(to):
+		return packFloat(to, float64(unpackInteger(inst, registers, in)))
+	default:
+		return packInteger(to, unpackInteger(inst, registers, in))
+	}
+}
+
+// isRepresentable reports whether the value of a number register can be
+// converted to another type without being truncated or wrapping around.
+func isRepresentable(inst bc.Instruction, registers [][]byte, in bc.Register, to bc.Type) bool {
+	switch {
+	case isFloatRegister(in.Typ) && isFloatRegister(to):
+		v := unpackFloat(inst, registers, in)
+		return to == bc.Float64 || math.IsNaN(v) || math.IsInf(v, 0) || math.Abs(v) <= math.MaxFloat32
+	case isFloatRegister(in.Typ):
+		v := unpackFloat(inst, registers, in)
+		if v != math.Trunc(v) {
+			return false // NaN, infinite, or has a fraction
+		}
+		min, max := integerBounds(to)
+		return min <= v && v < max
+	case isFloatRegister(to):
+		return true
+	case isSignedRegister(in.Typ):
+		v := int64(unpackInteger(inst, registers, in))
+		if isSignedRegister(to) {
+			bits := registerBits(to)
+			return v == (v<<(64-bits))>>(64-bits)
+		}
+		return v >= 0 && uint64(v)>>registerBits(to) == 0
+	default:
+		v := unpackInteger(inst, registers, in)
+		bits := registerBits(to)
+		if isSignedRegister(to) {
+			bits -= 1
+		}
+		return v>>bits == 0
+	}
+}
+
+// integerBounds returns the inclusive minimum and exclusive maximum of an
+// integer type as floats (which are exact, unlike the inclusive maximum).
+func integerBounds(typ bc.Type) (float64, float64) {
+	bits := int(registerBits(typ))
+	if isSignedRegister(typ) {
+		return -math.Ldexp(1, bits-1), math.Ldexp(1, bits-1)
+	}
+	return 0, math.Ldexp(1, bits)
+}
+
+// shiftCount reads the count of a shift; a checked program traps if the count
+// is negative, or isn't less than the width of the shifted integer.
+func shiftCount(inst bc.Instruction, registers [][]byte, args bc.BinaryArgs, checked bool) uint64 {
+	count := unpackInteger(inst, registers, args.Right)
+	negative := isSignedRegister(args.Right.Typ) && int64(count) < 0
+	if checked && (negative || count >= uint64(registerBits(args.Left.Typ))) {
+		trap("The shift count %s is out of range for %s", printRegister(inst, registers, args.Right), args.Left.Typ)
+	}
+	return count
+}
+
+func registerBits(typ bc.Type) uint {
+	switch typ {
+	case bc.Uint8, bc.Int8:
+		return 8
+	case bc.Uint16, bc.Int16:
+		return 16
+	case bc.Uint32, bc.Int32, bc.Float32:
+		return 32
+	default:
+		return 64
+	}
+}
+
+// printRegister formats the value of a number register for an error message.
+func printRegister(inst bc.Instruction, registers [][]byte, rg bc.Register) string {
+	switch {
+	case isFloatRegister(rg.Typ):
+		return fmt.Sprint(unpackFloat(inst, registers, rg))
+	case isSignedRegister(rg.Typ):
+		return fmt.Sprint(int64(unpackInteger(inst, registers, rg)))
+	default:
+		return fmt.Sprint(unpackInteger(inst, registers, rg))
+	}
+}
+
+func isFloatRegister(typ bc.Type) bool {
+	return typ == bc.Float32 || typ == bc.Float64
+}
+
+func isSignedRegister(typ bc.Type) bool {
+	return typ == bc.Int8 || typ == bc.Int16 || typ == bc.Int32 || typ == bc.Int64
+}
+
+// addressOf returns the address of a buffer, which is added to the buffers
+// that text may point to; an empty buffer has the address 0.
+func (m *machine) addressOf(data []byte) uint64 {
+	if len(data) == 0 {
+		return 0
+	}
+	ptr := uint64(uintptr(unsafe.Pointer(&data[0])))
+	m.buffers[ptr] = data
+	return ptr
+}
+
+func unpackText(inst bc.Instruction, registers [][]byte, rg bc.Register) textValue {
+	var text textValue
+	unpackRegister(inst, registers, rg.Loc, &text)
+	return text
+}
+
+// textData returns the bytes of a text register; the text must point into a
+// buffer which was allocated by the interpreter.
+func (m *machine) textData(inst bc.Instruction, registers [][]byte, rg bc.Register) []byte {
+	text := unpackText(inst, registers, rg)
+	if text.Count == 0 {
+		return nil
+	}
+	data, ok := m.buffers[text.Data]
+	if !ok || text.Count < 0 || text.Count > int64(len(data)) {
+		trap("The text at %#x wasn't allocated by the interpreter", text.Data)
+	}
+	return data[:text.Count]
+}
+
+// unpackTuple splits the value of a tuple register into its elements.
+func unpackTuple(tuple []byte) [][]byte {
+	var elements [][]byte
+	for len(tuple) > 0 {
+		var size uint32
+		bc.Unpack(tuple[:4], &size)
+		elements = append(elements, tuple[4:4+size])
+		tuple = tuple[4+size:]
+	}
+	return elements
+}
+
 func unpackRegister(inst bc.Instruction, registers [][]byte, loc bc.Location, ptr interface{}) {
 	err := bc.Unpack(registers[loc], ptr)
 	utils.Assert(err == nil, `%v (at %v)`, err, inst)
@@ -1,6 +1,7 @@
 package interpreter
 
 import (
+	"math"
 	"testing"
 
 	"github.com/kestred/philomath/code/parser"
@@ -11,6 +12,16 @@ import (
 )
 
 func evalExample(t *testing.T, input string) []byte {
+	return evalProgram(t, input, false)
+}
+
+func evalProgram(t *testing.T, input string, checked bool) []byte {
+	program := compileExample(t, input, checked)
+	t.Log(program.Procedures[0].Instructions)
+	return Evaluate(program.Procedures[0], nil)
+}
+
+func compileExample(t *testing.T, input string, checked bool) *bc.Program {
 	p := parser.Make("example", false, []byte(input))
 	node := p.ParseEvaluable()
 	assert.Empty(t, p.Errors, "Unexpected parser errors")
@@ -18,10 +29,9 @@ func evalExample(t *testing.T, input string) []byte {
 	semantics.ResolveNames(&section)
 	semantics.InferTypes(&section)
 	program := bc.NewProgram()
+	program.Checked = checked
 	program.Extend(node)
-
-	t.Log(program.Procedures[0].Instructions)
-	return Evaluate(program.Procedures[0])
+	return program
 }
 
 func TestEvaluateNoop(t *testing.T) {
@@ -32,7 +42,7 @@ func TestEvaluateNoop(t *testing.T) {
 	program = bc.NewProgram()
 	program.Procedures[0].NextFree = 1
 	program.Procedures[0].Instructions = []bc.Instruction{{Op: bc.NOOP}}
-	result = Evaluate(program.Procedures[0])
+	result = Evaluate(program.Procedures[0], nil)
 	assert.Equal(t, []byte(nil), result)
 
 	// interleaved noops
@@ -50,7 +60,7 @@ func TestEvaluateNoop(t *testing.T) {
 		{bc.NOOP, nil},
 		{bc.ADD, bc.Binary(bc.Rg(1, bc.Int64), bc.Rg(2, bc.Int64), bc.Rg(3, bc.Int64))},
 	}
-	result = Evaluate(program.Procedures[0])
+	result = Evaluate(program.Procedures[0], nil)
 	assert.Equal(t, bc.Pack(int64(3)), result)
 }
 
@@ -87,6 +97,446 @@ func TestEvaluateArithmetic(t *testing.T) {
 	result = evalExample(t, `(02 + 3.0) + 04;`)
 	assert.Equal(t, bc.Pack(float64((02+3.0)+04)), result)
 	assert.Equal(t, bc.Pack(float64(9.0)), result)
+
+	// negation
+	assert.Equal(t, bc.Pack(int64(-3)), evalExample(t, `{ a := 3; -a; }`))
+	assert.Equal(t, bc.Pack(int64(10)), evalExample(t, `{ a := 3 - 8; -a * 2; }`))
+	assert.Equal(t, bc.Pack(float64(-2.5)), evalExample(t, `{ a := 2.5; -a; }`))
+	assert.Equal(t, bc.Pack(int64(3)), evalExample(t, `{ a := 3; +a; }`))
+}
+
+func TestEvaluateUnicodeIdentifiers(t *testing.T) {
+	assert.Equal(t, bc.Pack(int64(6)), evalExample(t, `{ φ := 2; φ * 3; }`))
+	assert.Equal(t, bc.Pack(int64(5)), evalExample(t, "{ caf\u00E9 := 4; cafe\u0301 + 1; }")) // equivalent after NFC
+}
+
+func TestEvaluateSizedTypes(t *testing.T) {
+	// integers wrap around at their width
+	assert.Equal(t, bc.Pack(int8(-56)), evalExample(t, `{ a: i8 = 100; a + 100; }`))
+	assert.Equal(t, bc.Pack(uint8(44)), evalExample(t, `{ a: u8 = 200; a + 100; }`))
+	assert.Equal(t, bc.Pack(uint16(0)), evalExample(t, `{ a: u16 = 0177777; a + 01; }`))
+	assert.Equal(t, bc.Pack(int32(-2147483648)), evalExample(t, `{ a: i32 = 2147483647; a + 1; }`))
+	assert.Equal(t, bc.Pack(int16(-3)), evalExample(t, `{ a: i16 = 1 - 8; a / 2; }`))
+	assert.Equal(t, bc.Pack(uint32(0xFFFFFFFF)), evalExample(t, `{ a: u32 = 01; a - 02; }`))
+
+	// floats are rounded to their width
+	x := float32(0.1)
+	assert.Equal(t, bc.Pack(x*3), evalExample(t, `{ a: f32 = 0.1; a * 3; }`))
+	assert.Equal(t, bc.Pack(float64(-3.0)), evalExample(t, `{ a: i8 = 1 - 3; b: f64 = a; b * 1.5; }`))
+
+	// casts between widths preserve the value (and sign) where possible
+	assert.Equal(t, bc.Pack(int64(-298)), evalExample(t, `{ a: i16 = 1 - 300; b: i64 = a; b + 1; }`))
+	assert.Equal(t, bc.Pack(uint8(255)), evalExample(t, `{ a: u16 = 0777; b: u8 = a; b + 0; }`))
+
+	// comparisons respect the signedness of the operands
+	assert.Equal(t, bc.Pack(true), evalExample(t, `{ a: u8 = 200; a > 100; }`))
+	assert.Equal(t, bc.Pack(true), evalExample(t, `{ a: i8 = 1 - 2; a < 1; }`))
+
+	// typed literals
+	assert.Equal(t, bc.Pack(uint8(44)), evalExample(t, `255u8 + 45;`))
+	assert.Equal(t, bc.Pack(int16(-32768)), evalExample(t, `0x7FFFi16 + 1;`))
+	assert.Equal(t, bc.Pack(float32(0.5)), evalExample(t, `1f32 / 2;`))
+}
+
+func evalError(t *testing.T, input string, checked bool) (err *RuntimeError) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = r.(*RuntimeError)
+		}
+	}()
+
+	evalProgram(t, input, checked)
+	return nil
+}
+
+func TestEvaluateCasts(t *testing.T) {
+	// unchecked casts wrap around or truncate
+	assert.Equal(t, bc.Pack(uint8(44)), evalExample(t, `cast(u8) 300;`))
+	assert.Equal(t, bc.Pack(int8(-56)), evalExample(t, `cast(i8) 200;`))
+	assert.Equal(t, bc.Pack(int64(2)), evalExample(t, `cast(i64) 2.75;`))
+	assert.Equal(t, bc.Pack(float32(3)), evalExample(t, `cast(f32) 3;`))
+	assert.Equal(t, bc.Pack(uint32('a')), evalExample(t, `cast(char) 97;`))
+
+	// checked casts trap when the value is out of range
+	assert.Equal(t, bc.Pack(uint8(255)), evalExample(t, `cast?(u8) 255;`))
+	assert.Equal(t, bc.Pack(int32(-2)), evalExample(t, `cast?(i32) (1.0 - 3);`))
+	if err := evalError(t, `cast?(u8) 256;`, false); assert.NotNil(t, err) {
+		assert.Equal(t, "The value 256 is out of range for a cast to Uint8", err.Msg)
+	}
+	if err := evalError(t, `cast?(u32) (1 - 2);`, false); assert.NotNil(t, err) {
+		assert.Equal(t, "The value -1 is out of range for a cast to Uint32", err.Msg)
+	}
+	if err := evalError(t, `cast?(i32) 2.5;`, false); assert.NotNil(t, err) {
+		assert.Equal(t, "The value 2.5 is out of range for a cast to Int32", err.Msg)
+	}
+}
+
+func TestEvaluateChecked(t *testing.T) {
+	// division by zero always traps
+	if err := evalError(t, `{ a := 0; 7 / a; }`, false); assert.NotNil(t, err) {
+		assert.Equal(t, "Division by zero", err.Msg)
+	}
+	if err := evalError(t, `{ a: u8 = 0; 7 % a; }`, false); assert.NotNil(t, err) {
+		assert.Equal(t, "Division by zero", err.Msg)
+	}
+
+	// overflow only traps in a checked program
+	assert.Equal(t, bc.Pack(int8(100)), evalProgram(t, `{ a: i8 = 50; a + 50; }`, true))
+	assert.Equal(t, bc.Pack(uint8(255)), evalProgram(t, `{ a: u8 = 0377; a * 01; }`, true))
+	if err := evalError(t, `{ a: i8 = 100; a + 100; }`, true); assert.NotNil(t, err) {
+		assert.Equal(t, "Integer overflow: 100 + 100 can't be represented as Int8", err.Msg)
+		assert.Equal(t, "example:1:18", err.Pos.String())
+		assert.Equal(t, []StackFrame{{"start_", err.Pos}}, err.Stack)
+	}
+	if err := evalError(t, `{ a: u32 = 01; a - 02; }`, true); assert.NotNil(t, err) {
+		assert.Equal(t, "Integer overflow: 1 - 2 can't be represented as Uint32", err.Msg)
+	}
+	if err := evalError(t, `{ a := 9223372036854775807; a * 2; }`, true); assert.NotNil(t, err) {
+		assert.Equal(t, "Integer overflow: 9223372036854775807 * 2 can't be represented as Int64", err.Msg)
+	}
+
+	// lossy implicit conversions trap in a checked program
+	assert.Equal(t, bc.Pack(uint8(44)), evalProgram(t, `{ a: u8 = 300; a + 0; }`, false))
+	if err := evalError(t, `{ a: u8 = 300; a + 0; }`, true); assert.NotNil(t, err) {
+		assert.Equal(t, "The value 300 is out of range for a cast to Uint8", err.Msg)
+	}
+	assert.Equal(t, bc.Pack(int16(100)), evalProgram(t, `{ a: i8 = 100; b: i16 = a; b * 1; }`, true))
+
+	// negating the minimum value of a signed integer only traps in a checked program
+	assert.Equal(t, bc.Pack(int8(-127)), evalProgram(t, `{ a: i8 = 127; -a; }`, true))
+	assert.Equal(t, bc.Pack(int8(-128)), evalProgram(t, `{ a: i8 = -128; -a; }`, false))
+	if err := evalError(t, `{ a: i8 = -128; -a; }`, true); assert.NotNil(t, err) {
+		assert.Equal(t, "Integer overflow: -(-128) can't be represented as Int8", err.Msg)
+		assert.Equal(t, "example:1:17", err.Pos.String())
+	}
+	if err := evalError(t, `{ a := -9223372036854775808; -a; }`, true); assert.NotNil(t, err) {
+		assert.Equal(t, "Integer overflow: -(-9223372036854775808) can't be represented as Int64", err.Msg)
+	}
+
+	// shifts by a negative count (or by at least the width) only trap in a checked program
+	assert.Equal(t, bc.Pack(int64(0)), evalProgram(t, `{ a := 1; a << 70; }`, false))
+	assert.Equal(t, bc.Pack(int64(math.MinInt64)), evalProgram(t, `{ a := 1; a << 63; }`, true))
+	if err := evalError(t, `{ a := 1; a << 70; }`, true); assert.NotNil(t, err) {
+		assert.Equal(t, "The shift count 70 is out of range for Int64", err.Msg)
+	}
+	if err := evalError(t, `{ a := 1; b := 1 - 2; a << b; }`, true); assert.NotNil(t, err) {
+		assert.Equal(t, "The shift count -1 is out of range for Int64", err.Msg)
+	}
+	if err := evalError(t, `{ a: u8 = 1; a >> 8; }`, true); assert.NotNil(t, err) {
+		assert.Equal(t, "The shift count 8 is out of range for Uint8", err.Msg)
+	}
+	assert.Equal(t, bc.Pack(uint64(math.MaxUint64)), evalProgram(t, `{ a: u64 = 18446744073709551615; a + 0; }`, true))
+}
+
+func TestEvaluateBitwise(t *testing.T) {
+	assert.Equal(t, bc.Pack(int64(1)), evalExample(t, `7 % 3;`))
+	assert.Equal(t, bc.Pack(int64(-1)), evalExample(t, `{ a := 1 - 8; a % 3; }`))
+	assert.Equal(t, bc.Pack(uint64(0x30)), evalExample(t, `0360 & 074;`))
+	assert.Equal(t, bc.Pack(uint64(0xFC)), evalExample(t, `0360 | 074;`))
+	assert.Equal(t, bc.Pack(uint64(0xCC)), evalExample(t, `0360 xor 074;`))
+	assert.Equal(t, bc.Pack(uint64(0xF)), evalExample(t, `0b1010 | 0x0F;`))
+	assert.Equal(t, bc.Pack(int64(1000000)), evalExample(t, `1_000 * 1_000;`))
+	assert.Equal(t, bc.Pack(int64(-8)), evalExample(t, `!7;`))
+	assert.Equal(t, bc.Pack(int64(40)), evalExample(t, `5 << 3;`))
+
+	// arithmetic shift for signed values, logical shift for unsigned values
+	assert.Equal(t, bc.Pack(int64(-4)), evalExample(t, `{ a := 1 - 17; a >> 2; }`))
+	assert.Equal(t, bc.Pack(uint64(0x3FFFFFFFFFFFFFFC)), evalExample(t, `01777777777777777777760 >> 2;`))
+
+	// compound forms
+	assert.Equal(t, bc.Pack(int64(12)), evalExample(t, `{ a := 3; a <<= 2; a + 0; }`))
+}
+
+func TestEvaluateComparisons(t *testing.T) {
+	assert.Equal(t, bc.Pack(true), evalExample(t, `1 < 2;`))
+	assert.Equal(t, bc.Pack(false), evalExample(t, `2 < 1;`))
+	assert.Equal(t, bc.Pack(true), evalExample(t, `1 == 1.0;`))
+	assert.Equal(t, bc.Pack(false), evalExample(t, `0 >= 1;`))
+	assert.Equal(t, bc.Pack(true), evalExample(t, `01 <= 01 < 02;`))
+
+	// chained comparisons
+	assert.Equal(t, bc.Pack(true), evalExample(t, `1 < 2 <= 2 < 3.5;`))
+	assert.Equal(t, bc.Pack(false), evalExample(t, `1 < 3 <= 2 < 3.5;`))
+	assert.Equal(t, bc.Pack(false), evalExample(t, `3 < 1 < 2;`))
+	assert.Equal(t, bc.Pack(true), evalExample(t, `3 > 2 >= 2 > 1;`))
+	assert.Equal(t, bc.Pack(false), evalExample(t, `4 == 4 == 5;`))
+}
+
+func TestEvaluateMembership(t *testing.T) {
+	assert.Equal(t, bc.Pack(true), evalExample(t, `5 in 0..10;`))
+	assert.Equal(t, bc.Pack(true), evalExample(t, `10 in 0..10;`))
+	assert.Equal(t, bc.Pack(false), evalExample(t, `11 in 0..10;`))
+	assert.Equal(t, bc.Pack(false), evalExample(t, `5 in 6..10;`))
+	assert.Equal(t, bc.Pack(true), evalExample(t, `2.5 in 2..3;`))
+	assert.Equal(t, bc.Pack(false), evalExample(t, `5 not in 0..10;`))
+	assert.Equal(t, bc.Pack(true), evalExample(t, `11 not in 0..10;`))
+	assert.Equal(t, bc.Pack(true), evalExample(t, `'é' in "café";`))
+	assert.Equal(t, bc.Pack(false), evalExample(t, `'\u{E9}' in "cafe";`))
+	assert.Equal(t, bc.Pack(true), evalExample(t, `{ s := "café"; 'é' in s; }`))
+	assert.Equal(t, bc.Pack(true), evalExample(t, `{ s := "café"; 'z' not in s; }`))
+	assert.Equal(t, bc.Pack(false), evalExample(t, `{ s := ""; 'a' in s; }`))
+	assert.Equal(t, bc.Pack(true), evalExample(t, `{
+		has :: (x: int, xs: ..int) -> bool { return x in xs; };
+		has(3, 1, 2, 3);
+	}`))
+	assert.Equal(t, bc.Pack(true), evalExample(t, `{
+		lacks :: (x: int, xs: ..int) -> bool { return x not in xs; };
+		lacks(4, 1, 2, 3);
+	}`))
+
+	p := parser.Make("example", false, []byte(`{ vowel :: (c: char) -> bool { return c in "aeiou"; } }`))
+	node := p.ParseEvaluable()
+	section := semantics.FlattenTree(node, nil)
+	semantics.ResolveNames(&section)
+	semantics.InferTypes(&section)
+	program := bc.NewProgram()
+	program.Extend(node)
+
+	vowel := program.Procedures[program.Text["vowel"]]
+	assert.Equal(t, bc.Pack(true), Evaluate(vowel, [][]byte{bc.Pack(uint32('a'))}))
+	assert.Equal(t, bc.Pack(true), Evaluate(vowel, [][]byte{bc.Pack(uint32('u'))}))
+	assert.Equal(t, bc.Pack(false), Evaluate(vowel, [][]byte{bc.Pack(uint32('y'))}))
+}
+
+func TestEvaluateCompoundAssignment(t *testing.T) {
+	result := evalExample(t, `{ a := 2; a += 3; a *= 4; a + 0; }`)
+	assert.Equal(t, bc.Pack(int64(20)), result)
+
+	result = evalExample(t, `{ a := 2; b := 3.0; a, b -= 1, 0.5; a + b; }`)
+	assert.Equal(t, bc.Pack(float64(3.5)), result)
+}
+
+func TestEvaluateDefaultArguments(t *testing.T) {
+	result := evalExample(t, `{
+		scale :: (n: int, by: int = 2, plus: int = 1) -> int { return n * by + plus; };
+		scale(3) + scale(3, plus = 5) + scale(by = 10, n = 1);
+	}`)
+	assert.Equal(t, bc.Pack(int64(29)), result)
+}
+
+func TestEvaluateMultipleReturns(t *testing.T) {
+	result := evalExample(t, `{
+		divide :: (n: int, d: int) -> (int, int) { return n / d, n % d; };
+		quotient, remainder := divide(17, 5);
+		quotient, remainder = divide(quotient * 10, remainder + 2);
+		quotient * 10 + remainder;
+	}`)
+	assert.Equal(t, bc.Pack(int64(72)), result)
+}
+
+func TestEvaluateProcedureValues(t *testing.T) {
+	result := evalExample(t, `{
+		double :: (n: int) -> int { return n * 2; };
+		square :: (n: int) -> int { return n * n; };
+		apply :: (f: (int) -> int, n: int) -> int { return f(n); };
+
+		f: (int) -> int = double;
+		a := f(5);
+		f = square;
+		b := apply(f, 3) + apply((n: int) -> int { return n + 1; }, 4);
+		a * 100 + b;
+	}`)
+	assert.Equal(t, bc.Pack(int64(1014)), result)
+
+	// a procedure stored in a struct is called through its field
+	program := compileExample(t, `{
+		S :: struct { op: (int) -> int; count: int; };
+		double :: (n: int) -> int { return n * 2; };
+		apply :: (s: S) -> int { return s.op(s.count) + 1; };
+	}`, false)
+
+	// structs aren't constructed yet, so the value of "s" is packed by hand
+	closure := packTuple(bc.Pack(int64(program.Text["double"])))
+	s := packTuple(closure, bc.Pack(int64(5)))
+	assert.Equal(t, bc.Pack(int64(11)), Evaluate(program.Procedures[program.Text["apply"]], [][]byte{s}))
+}
+
+// packTuple packs values the same way as the PACK instruction
+func packTuple(elements ...[]byte) []byte {
+	var tuple []byte
+	for _, element := range elements {
+		tuple = append(tuple, bc.Pack(uint32(len(element)))...)
+		tuple = append(tuple, element...)
+	}
+	return tuple
+}
+
+func TestEvaluateClosures(t *testing.T) {
+	result := evalExample(t, `{
+		total := 1;
+		add :: (n: int) { total += n; };
+		scale :: (by: int) -> (int) -> int {
+			return (n: int) -> int { return n * by; };
+		};
+		apply :: (f: (int) -> int) -> int { return f(total); };
+
+		add(2);
+		twice := scale(2);
+		add(apply(twice));
+		nested :: () {
+			inner :: () { total = total * 10; };
+			inner();
+		};
+		nested();
+		total;
+	}`)
+	assert.Equal(t, bc.Pack(int64(90)), result)
+
+	// each run of the interpreter has its own cells
+	program := compileExample(t, `{ total := 1; add :: (n: int) { total += n; }; add(2); total; }`, false)
+	for i := 0; i < 2; i++ {
+		m := newMachine()
+		assert.Equal(t, bc.Pack(int64(3)), m.evaluate(program.Procedures[0], nil))
+		assert.Equal(t, [][]byte{bc.Pack(int64(3))}, m.cells)
+	}
+}
+
+func TestEvaluatePolymorphicProcedures(t *testing.T) {
+	result := evalExample(t, `{
+		sum :: (a: $T, b: T) -> T { return a + b; };
+		apply :: (f: ($T) -> T, v: T) -> T { return f(v); };
+		half :: (x: float) -> float { return x / 2; };
+
+		n := sum(3, 4);
+		x := sum(0.25, apply(half, 0.5));
+		sum(n, 2) + cast(int) (x * 100);
+	}`)
+	assert.Equal(t, bc.Pack(int64(59)), result)
+}
+
+func TestEvaluateArgumentCasts(t *testing.T) {
+	result := evalExample(t, `{
+		f :: (a: i16) -> i16 { return a * 1; };
+		x: i8 = 100;
+		f(x) + 200;
+	}`)
+	assert.Equal(t, bc.Pack(int16(300)), result)
+
+	result = evalExample(t, `{
+		id :: (a: $T, b: T) -> T { return a + b; };
+		x: i16 = 1000;
+		y: i8 = 100;
+		id(x, y);
+	}`)
+	assert.Equal(t, bc.Pack(int16(1100)), result)
+
+	result = evalExample(t, `{
+		half :: (x: float) -> float { return x / 2; };
+		g := half;
+		y: f32 = 3;
+		g(y);
+	}`)
+	assert.Equal(t, bc.Pack(float64(1.5)), result)
+}
+
+func TestEvaluateVariadics(t *testing.T) {
+	result := evalExample(t, `{
+		count :: (args: ..int) -> int { return args.count; };
+		second :: (first: int, rest: ..int) -> int { return rest[1]; };
+		forward :: (args: ..int) -> int { return second(args[0], ..args) * 10 + count(..args); };
+		apply :: (f: (int, ..int) -> int) -> int { return f(1, 2, 3); };
+
+		count() + count(1, 2, 3) * 10 + forward(7, 8, 9) * 100 + apply(second);
+	}`)
+	assert.Equal(t, bc.Pack(int64(8333)), result)
+}
+
+func TestEvaluateDefer(t *testing.T) {
+	result := evalExample(t, `{
+		log := 1;
+		push :: (n: int) { log = log * 10 + n; };
+		f :: () -> int {
+			defer push(1);
+			{
+				defer push(2);
+				push(3);
+			}
+			defer { push(4); push(5); }
+			x := 6;
+			defer x = 0;
+			return x;
+		};
+		r := f();
+		log * 10 + r;
+	}`)
+	assert.Equal(t, bc.Pack(int64(1324516)), result)
+
+	// the value of a block is evaluated before its deferred statements
+	result = evalExample(t, `{
+		n := 1;
+		defer n = 5;
+		n + 1;
+	}`)
+	assert.Equal(t, bc.Pack(int64(2)), result)
+
+	// "done" evaluates the deferred statements of the loop's blocks
+	result = evalExample(t, `{
+		log := 1;
+		push :: (n: int) { log = log * 10 + n; };
+		n := 0;
+		while n < 100 {
+			defer push(1);
+			{
+				defer push(2);
+				n += 1;
+				done;
+			}
+		}
+		push(3);
+		log * 10 + n;
+	}`)
+	assert.Equal(t, bc.Pack(int64(12131)), result)
+}
+
+func TestEvaluateReturn(t *testing.T) {
+	result := evalExample(t, `{
+		same :: (a: int) -> int { return a; };
+		early :: (a: int) -> int {
+			while 1 < 2 { return a * 2; }
+			return 0;
+		};
+		same(3) * 10 + early(4);
+	}`)
+	assert.Equal(t, bc.Pack(int64(38)), result)
+}
+
+func TestEvaluateWhile(t *testing.T) {
+	result := evalExample(t, `{
+		n := 0;
+		count := 0;
+		while n < 5 {
+			defer count += 1;
+			n += 2;
+		}
+		n * 10 + count;
+	}`)
+	assert.Equal(t, bc.Pack(int64(63)), result)
+}
+
+func TestEvaluateText(t *testing.T) {
+	result := evalExample(t, `{
+		greeting := "Hello" + ", " + "world!";
+		greeting.count * 1000 + cast(int) greeting[4];
+	}`)
+	assert.Equal(t, bc.Pack(int64(13*1000+'o')), result)
+
+	// concatenation copies both texts into a new buffer
+	program := compileExample(t, `{ a := "ab"; b := a + "cd"; a + b; }`, false)
+	m := newMachine()
+	result = m.evaluate(program.Procedures[0], nil)
+	assert.Equal(t, []byte("ababcd"), m.textData(bc.Instruction{}, [][]byte{result}, bc.Rg(0, bc.Text)))
+
+	// text is compared byte-by-byte
+	assert.Equal(t, bc.Pack(true), evalExample(t, `"ab" + "cd" == "abcd";`))
+	assert.Equal(t, bc.Pack(true), evalExample(t, `"ab" < "abc" < "b";`))
+	assert.Equal(t, bc.Pack(false), evalExample(t, `"" == "a";`))
+	assert.Equal(t, bc.Pack(true), evalExample(t, `"tab\t\u{E9}" == "tab	é";`))
+	assert.Equal(t, bc.Pack(true), evalExample(t, `'a' < 'b' < '\u{E9}';`))
+	assert.Equal(t, bc.Pack(true), evalExample(t, "\"\"\"\n\t\t\tab\n\t\t\t  \\u{E9}\n\t\t\t\"\"\" == `ab\n  é`;"))
+
+	if err := evalError(t, `{ s := "abc"; s[3]; }`, false); assert.NotNil(t, err) {
+		assert.Equal(t, "The index 3 is out of range for text of 3 bytes", err.Msg)
+	}
 }
 
 func TestEncodeBlock(t *testing.T) {
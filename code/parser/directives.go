@@ -0,0 +1,216 @@
+package parser
+
+import (
+	"github.com/kestred/philomath/code/ast"
+	"github.com/kestred/philomath/code/token"
+)
+
+// A directive (eg. "#asm") declares where it may appear with a parser for its
+// body in each of those places; a directive without a parser for a place is
+// an error when it is used there.
+type directive struct {
+	block func(p *Parser) ast.Evaluable // where a block or statement is expected
+	value func(p *Parser) ast.Expr      // where an expression is expected
+	decl  func(p *Parser) ast.Decl      // where a top-level declaration is expected
+}
+
+var directives map[string]directive
+
+func init() {
+	directives = map[string]directive{
+		"asm":    {block: (*Parser).parseAsmDirective},
+		"assert": {block: (*Parser).parseAssertDirective, decl: (*Parser).parseTopAssertDirective},
+		"if":     {block: (*Parser).parseIfDirective, decl: (*Parser).parseTopIfDirective},
+		"run":    {value: (*Parser).parseRunDirective},
+	}
+}
+
+// lookupDirective finds the directive at the current token, reporting an
+// error if the directive is unknown.
+func (p *Parser) lookupDirective() (directive, bool) {
+	d, ok := directives[p.lit]
+	if !ok {
+		p.error(p.scanner.PosAt(p.pos), `Unknown directive "#`+p.lit+`"`)
+	}
+	return d, ok
+}
+
+func (p *Parser) misplacedDirective(where string) {
+	p.error(p.scanner.PosAt(p.pos), `The directive "#`+p.lit+`" can't be used `+where)
+}
+
+// parseBlockDirective parses a directive where a block is expected (eg. the
+// body of a procedure); a misplaced directive is skipped.
+func (p *Parser) parseBlockDirective() ast.Evaluable {
+	if d, ok := p.lookupDirective(); ok && d.block != nil {
+		offset := p.pos
+		p.next() // eat directive
+		node := d.block(p)
+		p.mark(node, offset)
+		return node
+	} else if ok {
+		p.misplacedDirective("as a block")
+	}
+	p.next() // eat directive
+	return p.parseBlock()
+}
+
+// parseValueDirective parses a directive where an expression is expected; a
+// misplaced directive is skipped.
+func (p *Parser) parseValueDirective() ast.Expr {
+	if d, ok := p.lookupDirective(); ok && d.value != nil {
+		p.next() // eat directive
+		return d.value(p)
+	} else if ok {
+		p.misplacedDirective("as a value")
+	}
+	p.next() // eat directive
+	return p.parseBaseExpressionBody()
+}
+
+// parseTopDirective parses a directive where a top-level declaration is
+// expected, or returns nil if the directive is misplaced.
+func (p *Parser) parseTopDirective() ast.Decl {
+	if d, ok := p.lookupDirective(); ok && d.decl != nil {
+		offset := p.pos
+		p.next() // eat directive
+		node := d.decl(p)
+		p.mark(node, offset)
+		return node
+	} else if ok {
+		p.misplacedDirective("at the top level")
+	}
+
+	// skip the rest of the statement (eg. "#run main();" or "#asm { ... }")
+	p.next() // eat directive
+	depth := 0
+	for p.tok != token.END {
+		switch p.tok {
+		case token.SEMICOLON:
+			if depth == 0 {
+				return nil
+			}
+		case token.LEFT_BRACE:
+			depth += 1
+		case token.RIGHT_BRACE:
+			depth -= 1
+			if depth == 0 {
+				p.next() // eat '}'
+				return nil
+			}
+		}
+		p.next()
+	}
+	return nil
+}
+
+func (p *Parser) parseAsmDirective() ast.Evaluable {
+	if p.tok == token.COLON {
+		p.error(p.scanner.Pos(), "Use of short block syntax is not allowed after specifying directives")
+	}
+
+	var start, end, depth int
+	depth = 1
+	start = p.pos + 1
+	linepos := p.scanner.Pos()
+	p.expect(token.LEFT_BRACE)
+	for depth > 0 {
+		switch p.tok {
+		case token.LEFT_BRACE:
+			depth += 1
+		case token.RIGHT_BRACE:
+			depth -= 1
+			end = p.pos - 1
+		case token.END:
+			p.error(linepos, `Missing a matching '}' to close an "#asm" block`)
+			p.stopParsing()
+		}
+		p.next()
+	}
+
+	asm := ast.Asm(p.scanner.SourceAt(start, end))
+	parseAssembly(asm)
+	return ast.Blok([]ast.Evaluable{asm})
+}
+
+func (p *Parser) parseRunDirective() ast.Expr {
+	if p.tok == token.LEFT_BRACE {
+		return ast.RunExp(nil, p.parseBlock())
+	}
+	return ast.RunExp(p.parseOperators(ast.PrefixPrec), nil)
+}
+
+func (p *Parser) parseAssertDirective() ast.Evaluable {
+	return p.parseTopAssertDirective()
+}
+
+func (p *Parser) parseTopAssertDirective() ast.Decl {
+	condition := p.parseExpression()
+
+	var message *ast.TextLiteral
+	if p.tok == token.COMMA {
+		p.next() // eat ','
+		offset := p.pos
+		if p.tok == token.TEXT {
+			message = ast.TxtLit(p.lit)
+			p.mark(message, offset)
+		} else {
+			p.error(p.scanner.PosAt(offset), `The message of an "#assert" must be text (eg. "#assert x > 0, "x must be positive";")`)
+		}
+		p.next()
+	}
+
+	p.expect(token.SEMICOLON)
+	return ast.AssertDir(condition, message)
+}
+
+func (p *Parser) parseIfDirective() ast.Evaluable {
+	return p.parseIfDirectiveWith((*Parser).parseBlock)
+}
+
+func (p *Parser) parseTopIfDirective() ast.Decl {
+	return p.parseIfDirectiveWith((*Parser).parseDeclarationBlock)
+}
+
+// parseIfDirectiveWith parses the condition and blocks of an "#if", which may
+// be followed by an "#else" block or an "#else #if".
+func (p *Parser) parseIfDirectiveWith(parseBody func(p *Parser) *ast.Block) *ast.IfDirective {
+	condition := p.parseExpression()
+	thenBlock := parseBody(p)
+
+	var elseBlock *ast.Block
+	if p.tok == token.DIRECTIVE && p.lit == "else" {
+		p.next() // eat "#else"
+		if p.tok == token.DIRECTIVE && p.lit == "if" {
+			offset := p.pos
+			p.next() // eat "#if"
+			elseIf := p.parseIfDirectiveWith(parseBody)
+			p.mark(elseIf, offset)
+			elseBlock = ast.Blok([]ast.Evaluable{elseIf})
+		} else {
+			elseBlock = parseBody(p)
+		}
+	}
+
+	return ast.IfDir(condition, thenBlock, elseBlock)
+}
+
+// parseDeclarationBlock parses a block of top-level declarations.
+func (p *Parser) parseDeclarationBlock() *ast.Block {
+	p.expect(token.LEFT_BRACE)
+	var decls []ast.Evaluable
+	for p.tok != token.RIGHT_BRACE && p.tok != token.END {
+		if p.tok == token.DIRECTIVE {
+			if decl := p.parseTopDirective(); decl != nil {
+				decls = append(decls, decl)
+			}
+		} else {
+			decls = append(decls, p.parseDeclaration())
+		}
+		for p.tok == token.SEMICOLON {
+			p.next() // eat extra semicolons
+		}
+	}
+	p.expect(token.RIGHT_BRACE)
+	return ast.Blok(decls)
+}
@@ -64,8 +64,12 @@ type Parser struct {
 	Errors []error
 }
 
-func Make(filename string, trace bool, src []byte) Parser {
-	p := Parser{}
+// Make allocates and initializes a new parser for the text src.
+//
+// The parser is returned by reference because the scanner's error handler
+// refers back to it; a copy would drop the scanner's diagnostics.
+func Make(filename string, trace bool, src []byte) *Parser {
+	p := &Parser{}
 	p.Init(filename, trace, src)
 	return p
 }
@@ -90,7 +94,13 @@ func (p *Parser) ParseTop() *ast.TopScope {
 	defer p.recoverStopped()
 	var decls []ast.Decl
 	for p.tok != token.END {
-		decls = append(decls, p.parseDeclaration())
+		if p.tok == token.DIRECTIVE {
+			if decl := p.parseTopDirective(); decl != nil {
+				decls = append(decls, decl)
+			}
+		} else {
+			decls = append(decls, p.parseDeclaration())
+		}
 		for p.tok == token.SEMICOLON {
 			p.next() // eat extra semicolons
 		}
@@ -215,67 +225,53 @@ func (p *Parser) next() {
 	p.pos, p.tok, p.lit = p.scanner.Scan()
 }
 
+// mark records the source position of a node from the offset of the token
+// which started it, so that later passes can report errors with positions.
+func (p *Parser) mark(node ast.Node, offset int) {
+	ast.SetPosition(node, p.scanner.PosAt(offset))
+}
+
 func (p *Parser) parseBlock() *ast.Block {
-	var directives []string
 	if p.tok == token.DIRECTIVE {
-		directives = append(directives, p.lit)
-		p.next()
+		stmt := p.parseBlockDirective()
+		if block, ok := stmt.(*ast.Block); ok {
+			return block
+		}
+		return ast.Blok([]ast.Evaluable{stmt})
 	}
 
 	if p.tok == token.COLON {
-		if len(directives) > 0 {
-			p.error(p.scanner.Pos(), "Use of short block syntax is not allowed after specifying directives")
-		}
 		p.next() // eat ":"
 		stmt := p.parseStatement()
 		return ast.Blok([]ast.Evaluable{stmt})
 	}
 
-	// TODO: Proper directive handling
-	if len(directives) > 0 && directives[0] == "asm" {
-		var start, end, depth int
-		depth = 1
-		start = p.pos + 1
-		linepos := p.scanner.Pos()
-		p.expect(token.LEFT_BRACE)
-		for depth > 0 {
-			switch p.tok {
-			case token.LEFT_BRACE:
-				depth += 1
-			case token.RIGHT_BRACE:
-				depth -= 1
-				end = p.pos - 1
-			case token.END:
-				p.error(linepos, `Missing a matching '}' to close an "#asm" block`)
-				p.stopParsing()
-			}
-			p.next()
-		}
+	p.expect(token.LEFT_BRACE)
+	for p.tok == token.SEMICOLON {
+		p.next() // eat leading semicolons
+	}
 
-		asm := ast.Asm(p.scanner.SourceAt(start, end))
-		parseAssembly(asm)
-		return ast.Blok([]ast.Evaluable{asm})
-	} else {
-		p.expect(token.LEFT_BRACE)
+	var stmts []ast.Evaluable
+	for p.tok != token.RIGHT_BRACE && p.tok != token.END {
+		stmts = append(stmts, p.parseEvaluable())
 		for p.tok == token.SEMICOLON {
-			p.next() // eat leading semicolons
-		}
-
-		var stmts []ast.Evaluable
-		for p.tok != token.RIGHT_BRACE && p.tok != token.END {
-			stmts = append(stmts, p.parseEvaluable())
-			for p.tok == token.SEMICOLON {
-				p.next() // eat extra semicolons
-			}
+			p.next() // eat extra semicolons
 		}
-		p.expect(token.RIGHT_BRACE)
-		return ast.Blok(stmts)
 	}
+	p.expect(token.RIGHT_BRACE)
+	return ast.Blok(stmts)
 }
 
 func (p *Parser) parseEvaluable() ast.Evaluable {
-	if p.tok == token.LEFT_BRACE || p.tok == token.DIRECTIVE {
+	if p.tok == token.DIRECTIVE {
+		if d := directives[p.lit]; d.block == nil && d.value != nil {
+			return p.parseStatement() // the statement is an expression (eg. "#run f();")
+		}
+		return p.parseBlockDirective()
+	} else if p.tok == token.LEFT_BRACE {
 		return p.parseBlock()
+	} else if p.tok == token.OPERATOR && p.scanner.Peek() == token.CONS {
+		return p.parseDeclaration() // an operator overload (eg. "_add_ :: (...)")
 	} else if p.tok != token.IDENT {
 		return p.parseStatement()
 	}
@@ -289,28 +285,48 @@ func (p *Parser) parseEvaluable() ast.Evaluable {
 }
 
 func (p *Parser) parseDeclaration() ast.Decl {
+	offset := p.pos
 	name := p.lit
-	p.expect(token.IDENT)
+	if p.tok == token.OPERATOR && ast.IsOverloadName(name) {
+		// operator overloads are declared with the overload name as their name
+		// (eg. "_add_ :: (a: Vec, b: Vec) -> Vec { ... }")
+		p.next()
+		if p.tok != token.CONS {
+			p.error(p.scanner.Pos(), "An operator overload must be declared as a constant (eg. \""+name+" :: (...) { ... }\")")
+		}
+	} else {
+		p.expect(token.IDENT)
+	}
 
+	decl := p.parseDeclarationBody(name)
+	p.mark(decl, offset)
+	return decl
+}
+
+func (p *Parser) parseDeclarationBody(name string) ast.Decl {
 	if p.tok == token.COLON {
 		// parse mutable decl
 		p.next() // eat ":"
+		var typ ast.Type
 		if p.tok != token.EQUALS {
-			utils.NotImplemented("Parsing mutable declarations with explicit types")
-			return nil
+			typ = p.parseType()
+		}
+
+		// the value is optional when the type is explicit (eg. "x: u8;")
+		var expr ast.Expr
+		if typ == nil || p.tok == token.EQUALS {
+			p.expect(token.EQUALS)
+			expr = p.parseExpression()
 		}
-		p.expect(token.EQUALS)
-		expr := p.parseExpression()
 		p.expect(token.SEMICOLON)
-		return ast.Mutable(name, nil, expr)
+		return ast.Mutable(name, typ, expr)
 	}
 
 	// parse const decl
 	p.expect(token.CONS)
 	switch p.tok {
 	case token.STRUCT:
-		utils.NotImplemented("Parsing struct declarations")
-		return nil
+		return ast.Immutable(name, p.parseStruct())
 	case token.MODULE:
 		utils.NotImplemented("Parsing module declarations")
 		return nil
@@ -323,21 +339,71 @@ func (p *Parser) parseDeclaration() ast.Decl {
 	}
 }
 
+func (p *Parser) parseStruct() *ast.StructDefn {
+	p.expect(token.STRUCT)
+	p.expect(token.LEFT_BRACE)
+
+	var fields []*ast.StructField
+	for p.tok == token.IDENT {
+		offset := p.pos
+		name := p.lit
+		p.next() // eat ident
+		p.expect(token.COLON)
+		field := ast.Field(name, p.parseType())
+		p.mark(field, offset)
+		fields = append(fields, field)
+		p.expect(token.SEMICOLON)
+	}
+
+	p.expect(token.RIGHT_BRACE)
+	return ast.Struct(fields)
+}
+
 func (p *Parser) parseStatement() ast.Stmt {
+	offset := p.pos
+	stmt := p.parseStatementBody()
+	p.mark(stmt, offset)
+	return stmt
+}
+
+func (p *Parser) parseStatementBody() ast.Stmt {
 	if p.tok.IsKeyword() {
 		switch p.tok {
 		case token.FOR:
 			utils.NotImplemented("Parsing for loops")
 		case token.IF:
 			return p.parseIf()
+		case token.WHILE:
+			p.next() // eat 'while'
+			condition := p.parseExpression()
+			return ast.While(condition, p.parseBlock())
+		case token.DONE:
+			p.next() // eat 'done'
+			p.expect(token.SEMICOLON)
+			return ast.Done()
 		case token.RETURN:
 			p.next() // eat 'return'
 			var expr ast.Expr
 			if p.tok != token.SEMICOLON {
-				expr = p.parseExpression()
+				offset := p.pos
+				exprs := p.parseExpressionList()
+				if len(exprs) > 1 {
+					expr = ast.TupleExp(exprs) // multiple return values (eg. "return x, ok;")
+					p.mark(expr, offset)
+				} else {
+					expr = exprs[0]
+				}
 			}
 			p.expect(token.SEMICOLON)
 			return ast.Return(expr)
+		case token.DEFER:
+			p.next() // eat 'defer'
+			if p.tok == token.LEFT_BRACE {
+				return ast.Defer(p.parseBlock())
+			}
+			return ast.Defer(p.parseStatement())
+		case token.CAST:
+			break // the statement is an expression
 		default:
 			utils.Errorf("Unhandled keyword '%s' in parse statement", p.lit)
 			utils.InvalidCodePath()
@@ -345,13 +411,33 @@ func (p *Parser) parseStatement() ast.Stmt {
 	}
 
 	exprs := p.parseExpressionList()
-	// TODO: Handle combined assignment (eg. a += 2);
-	//       Generate an error but still continue if it is (a + = 2)
-	if p.tok == token.EQUALS {
+	if op := p.parseInfixOperator(); op != nil {
+		opOffset := p.pos
+		opEnd := p.pos + len(p.lit)
+		if op.Type != ast.BinaryInfix || op.Precedence <= ast.ComparisonPrec {
+			p.error(p.scanner.PosAt(opOffset), "The operator '"+p.lit+"' cannot be used in a compound assignment")
+		}
+
+		p.eatOperator(op)
+		if p.tok == token.EQUALS && p.pos != opEnd {
+			p.error(p.scanner.PosAt(opOffset), "A compound assignment can't have spaces between the operator and '=' (eg. \"a "+op.Literal+"= b\")")
+		}
+		p.expect(token.EQUALS)
+		values := p.parseExpressionList()
+		p.expect(token.SEMICOLON)
+
+		stmt := ast.Assign(exprs, op, values)
+		for _, operation := range stmt.Operations {
+			p.mark(operation, opOffset)
+		}
+		return stmt
+	} else if p.tok == token.EQUALS {
 		p.next() // eat '='
 		values := p.parseExpressionList()
 		p.expect(token.SEMICOLON)
 		return ast.Assign(exprs, nil, values)
+	} else if p.tok == token.COLON && len(exprs) > 1 {
+		return p.parseDestructuring(exprs)
 	} else if len(exprs) == 1 {
 		p.expect(token.SEMICOLON)
 		return ast.Eval(exprs[0])
@@ -362,6 +448,30 @@ func (p *Parser) parseStatement() ast.Stmt {
 	}
 }
 
+// parseDestructuring parses the declaration of multiple names from the values
+// returned by a procedure (eg. "x, ok := f();").
+func (p *Parser) parseDestructuring(exprs []ast.Expr) ast.Stmt {
+	names := make([]string, len(exprs))
+	for i, expr := range exprs {
+		if ident, ok := expr.(*ast.Identifier); ok {
+			names[i] = ident.Literal
+		} else {
+			p.error(ast.PositionOf(expr), "Expected a name to declare on the left side of ':='")
+		}
+	}
+
+	p.next() // eat ':'
+	p.expect(token.EQUALS)
+	value := p.parseExpression()
+	p.expect(token.SEMICOLON)
+
+	stmt := ast.Destructure(names, value)
+	for i, decl := range stmt.Decls {
+		ast.SetPosition(decl, ast.PositionOf(exprs[i]))
+	}
+	return stmt
+}
+
 func (p *Parser) parseIf() *ast.IfStmt {
 	p.expect(token.IF)
 	condition := p.parseExpression()
@@ -380,6 +490,42 @@ func (p *Parser) parseIf() *ast.IfStmt {
 	return ast.If(condition, thenBlock, elseBlock)
 }
 
+// parseArguments parses the arguments of a call, which are positional or
+// named (eg. "print(msg = "x")"); the names are nil if no argument is named.
+// The last argument may be an array spread into a variadic parameter (eg. "..args").
+func (p *Parser) parseArguments() ([]ast.Expr, []*ast.Identifier, bool) {
+	var args []ast.Expr
+	var names []*ast.Identifier
+	var named, spread bool
+	for p.tok != token.RIGHT_PAREN && p.tok != token.END {
+		if spread {
+			p.error(p.scanner.Pos(), `Only the last argument of a call can be spread (eg. "f(1, ..rest)")`)
+		}
+		var name *ast.Identifier
+		if p.tok == token.IDENT && p.scanner.Peek() == token.EQUALS {
+			name = ast.Ident(p.lit)
+			p.mark(name, p.pos)
+			p.next() // eat name
+			p.next() // eat '='
+			named = true
+		}
+		if p.tok == token.RANGE {
+			p.next() // eat '..'
+			spread = true
+		}
+		args = append(args, p.parseExpression())
+		names = append(names, name)
+		if p.tok != token.RIGHT_PAREN {
+			p.expect(token.COMMA)
+		}
+	}
+
+	if !named {
+		names = nil
+	}
+	return args, names, spread
+}
+
 func (p *Parser) parseExpressionList() []ast.Expr {
 	list := []ast.Expr{p.parseExpression()}
 	for p.tok == token.COMMA {
@@ -394,38 +540,66 @@ func (p *Parser) parseExpression() ast.Expr {
 }
 
 func (p *Parser) parseOperators(precedence ast.OpPrecedence) ast.Expr {
+	offset := p.pos
 	lhs := p.parseBaseExpression()
-	if p.tok == token.LEFT_BRACKET {
-		utils.NotImplemented("Parsing array subscripts")
-		return nil
-	} else if p.tok == token.LEFT_PAREN {
-		p.next() // eat '('
-		var args []ast.Expr
-		if p.tok != token.RIGHT_PAREN {
-			args = p.parseExpressionList()
+	if _, isProc := lhs.(*ast.ProcedureExpr); isProc {
+		// the procedure's block ends the expression, so that a following
+		// declaration (eg. "_add_ :: ...") is not mistaken for an operator
+		return lhs
+	}
+
+	// calls, subscripts, and members may be chained (eg. "f(x)[0].count")
+	for {
+		if p.tok == token.LEFT_BRACKET {
+			p.next() // eat '['
+			index := p.parseExpression()
+			p.expect(token.RIGHT_BRACKET)
+			lhs = ast.IdxExp(lhs, index)
+		} else if p.tok == token.LEFT_PAREN {
+			p.next() // eat '('
+			args, names, spread := p.parseArguments()
+			p.expect(token.RIGHT_PAREN)
+			call := ast.CallExp(lhs, args)
+			call.Names = names
+			call.Spread = spread
+			lhs = call
+		} else if p.tok == token.PERIOD {
+			p.next() // eat '.'
+			member := p.lit
+			p.expect(token.IDENT)
+			lhs = ast.GetExp(lhs, member)
+		} else {
+			break
 		}
-		p.expect(token.RIGHT_PAREN)
-		return ast.CallExp(lhs, args)
-	} else if !p.tok.IsOperator() {
+		p.mark(lhs, offset)
+	}
+
+	op := p.parseInfixOperator()
+	if op == nil || p.isCompoundAssignment(op) {
 		return lhs
 	}
 
-	op := p.parseBinaryOperator()
 	consumable := ast.MaxPrecedence
 	for (op.Type == ast.BinaryInfix || op.Type == ast.UnaryPostfix) &&
 		(precedence <= op.Precedence && op.Precedence <= consumable) {
 
-		p.next() // eat operator
-		if op.Type == ast.BinaryInfix {
+		opOffset := p.pos
+		p.eatOperator(op)
+		if op.Precedence == ast.ComparisonPrec {
+			lhs = p.parseComparison(lhs, op, opOffset)
+		} else if op == ast.BuiltinElementOf || op == ast.BuiltinNotElementOf {
+			lhs = ast.InExp(lhs, op, p.parseCollection(op))
+		} else if op.Type == ast.BinaryInfix {
 			rhs := p.parseOperators(rightPrec(op))
 			lhs = ast.InExp(lhs, op, rhs)
 		} else {
 			lhs = ast.PostExp(lhs, op)
 		}
+		p.mark(lhs, opOffset)
 
-		if p.tok.IsOperator() {
-			op = p.parseBinaryOperator()
+		if next := p.parseInfixOperator(); next != nil && !p.isCompoundAssignment(next) {
 			consumable = nextPrec(op)
+			op = next
 		} else {
 			break
 		}
@@ -434,9 +608,100 @@ func (p *Parser) parseOperators(precedence ast.OpPrecedence) ast.Expr {
 	return lhs
 }
 
+// parseInfixOperator returns the infix or postfix operator at the current
+// token without eating it, or nil if the token doesn't start an operator.
+// Most operators are a single OPERATOR token, but membership is "in" or "not in"
+// and the bitwise exclusive or is "xor".
+func (p *Parser) parseInfixOperator() *ast.OperatorDefn {
+	switch {
+	case p.tok.IsOperator():
+		return p.parseBinaryOperator()
+	case p.tok == token.IN:
+		return ast.BuiltinElementOf
+	case p.tok == token.IDENT && p.lit == ast.BuiltinBitXor.Literal:
+		return ast.BuiltinBitXor
+	case p.tok == token.IDENT && p.lit == "not" && p.scanner.Peek() == token.IN:
+		return ast.BuiltinNotElementOf
+	default:
+		return nil
+	}
+}
+
+// isCompoundAssignment reports whether an operator is part of a compound
+// assignment (eg. the "+" in "a += 2") rather than the start of an operation.
+func (p *Parser) isCompoundAssignment(op *ast.OperatorDefn) bool {
+	return op.Type == ast.BinaryInfix && p.scanner.Peek() == token.EQUALS
+}
+
+func (p *Parser) eatOperator(op *ast.OperatorDefn) {
+	if op == ast.BuiltinNotElementOf {
+		p.next() // eat 'not'
+	}
+	p.next() // eat operator
+}
+
+// parseCollection parses the right side of a membership test, which may be a
+// range of values (eg. "x in 0..10") rather than an ordinary expression.
+func (p *Parser) parseCollection(op *ast.OperatorDefn) ast.Expr {
+	offset := p.pos
+	expr := p.parseOperators(rightPrec(op))
+	if p.tok == token.RANGE {
+		p.next() // eat '..'
+		expr = ast.RangeExp(expr, p.parseOperators(rightPrec(op)))
+		p.mark(expr, offset)
+	}
+	return expr
+}
+
+// parseComparison parses a chain of comparisons like "a < b <= c", where the
+// first operator has already been eaten.  The comparisons in a chain must all
+// be in the same direction (eg. "a < b > c" is an error).
+func (p *Parser) parseComparison(lhs ast.Expr, op *ast.OperatorDefn, opOffset int) ast.Expr {
+	operands := []ast.Expr{lhs, p.parseOperators(rightPrec(op))}
+	ops := []*ast.OperatorDefn{op}
+	offsets := []int{opOffset}
+	for {
+		next := p.parseInfixOperator()
+		if next == nil || next.Precedence != ast.ComparisonPrec {
+			break
+		}
+
+		if comparisonDirection(next) != comparisonDirection(op) {
+			p.error(p.scanner.PosAt(p.pos), fmt.Sprintf(`Comparisons can only be chained in one direction (eg. "a < b <= c"), but '%s' follows '%s'`, next.Literal, ops[len(ops)-1].Literal))
+		}
+
+		offsets = append(offsets, p.pos)
+		p.next() // eat operator
+		operands = append(operands, p.parseOperators(rightPrec(next)))
+		ops = append(ops, next)
+	}
+
+	expr := ast.CmpExp(operands, ops)
+	for i, comparison := range expr.Comparisons {
+		p.mark(comparison, offsets[i])
+	}
+	return expr
+}
+
+func comparisonDirection(op *ast.OperatorDefn) int {
+	switch op {
+	case ast.BuiltinLess, ast.BuiltinLessOrEqual:
+		return -1
+	case ast.BuiltinGreater, ast.BuiltinGreaterOrEqual:
+		return 1
+	case ast.BuiltinIdentical:
+		return 2
+	default:
+		return 0
+	}
+}
+
 func (p *Parser) parseBinaryOperator() *ast.OperatorDefn {
 	options, defined := p.operators.Lookup(p.lit)
 	if !defined {
+		if op := p.operators.DefineNamed(p.lit); op != nil {
+			return op
+		}
 		p.error(p.scanner.Pos(), "The operator '"+p.lit+"' has not been defined")
 		return ast.UndefinedOperator
 	}
@@ -474,6 +739,15 @@ func nextPrec(op *ast.OperatorDefn) ast.OpPrecedence {
 }
 
 func (p *Parser) parseBaseExpression() ast.Expr {
+	offset := p.pos
+	expr := p.parseBaseExpressionBody()
+	if expr != nil {
+		p.mark(expr, offset)
+	}
+	return expr
+}
+
+func (p *Parser) parseBaseExpressionBody() ast.Expr {
 	/* handle prefix expression */
 	if p.tok.IsOperator() {
 		options, defined := p.operators.Lookup(p.lit)
@@ -509,11 +783,31 @@ func (p *Parser) parseBaseExpression() ast.Expr {
 		if p.tok == token.IDENT && p.scanner.Peek() == token.COLON {
 			/* handle procedure params */
 			for p.tok == token.IDENT {
+				paramOffset := p.pos
 				name := p.lit
 				p.next() // eat ident
 				p.expect(token.COLON)
-				typ := p.parseType()
-				params = append(params, ast.Param(name, typ))
+				if len(params) > 0 && params[len(params)-1].Variadic {
+					p.error(p.scanner.PosAt(paramOffset), "Only the last parameter of a procedure can be variadic")
+				}
+
+				var param *ast.MutableDecl
+				if p.tok == token.RANGE {
+					p.next() // eat '..'
+					param = ast.VarParam(name, p.parseType())
+				} else {
+					param = ast.Param(name, p.parseType())
+				}
+				if p.tok == token.EQUALS {
+					if param.Variadic {
+						p.error(p.scanner.Pos(), "A variadic parameter can't have a default value")
+					}
+					// a default value is evaluated by the caller if the argument is omitted
+					p.next() // eat '='
+					param.Expr = p.parseExpression()
+				}
+				p.mark(param, paramOffset)
+				params = append(params, param)
 				if p.tok != token.RIGHT_PAREN {
 					p.expect(token.COMMA)
 				}
@@ -541,6 +835,23 @@ func (p *Parser) parseBaseExpression() ast.Expr {
 			return ast.GrpExp(expr)
 		}
 
+	case token.CAST:
+		/* handle cast expression */
+		p.next() // eat 'cast'
+		checked := false
+		if p.tok == token.QUESTION {
+			checked = true
+			p.next() // eat '?'
+		}
+		p.expect(token.LEFT_PAREN)
+		typ := p.parseType()
+		p.expect(token.RIGHT_PAREN)
+		expr := p.parseOperators(ast.PrefixPrec)
+		return ast.CastExp(typ, expr, checked)
+
+	case token.DIRECTIVE:
+		return p.parseValueDirective()
+
 	case token.IDENT:
 		name := p.lit
 		p.next() // eat ident
@@ -551,6 +862,11 @@ func (p *Parser) parseBaseExpression() ast.Expr {
 		p.next() // eat text
 		return expr
 
+	case token.CHAR:
+		expr := ast.CharLit(p.lit)
+		p.next() // eat char
+		return expr
+
 	case token.NUMBER:
 		expr := ast.NumLit(p.lit)
 		p.next() // eat number
@@ -575,8 +891,47 @@ func (p *Parser) parseType() ast.Type {
 		return ast.ArrTyp(typ, len)
 
 	case token.LEFT_PAREN:
-		utils.NotImplemented("Parsing procedure types")
-		return nil
+		p.next() // eat left paren
+		var types []ast.Type
+		var variadic bool
+		for p.tok != token.RIGHT_PAREN && p.tok != token.END {
+			if variadic {
+				p.error(p.scanner.Pos(), "Only the last parameter of a procedure can be variadic")
+			}
+			if p.tok == token.RANGE {
+				p.next() // eat '..'
+				variadic = true
+				types = append(types, ast.ArrTyp(p.parseType(), nil))
+			} else {
+				types = append(types, p.parseType())
+			}
+			if p.tok != token.RIGHT_PAREN {
+				p.expect(token.COMMA)
+			}
+		}
+		p.expect(token.RIGHT_PAREN)
+
+		if p.tok == token.ARROW {
+			p.next() // eat '->'
+			ret := p.parseType()
+			if tuple, ok := ret.(*ast.TupleType); ok && len(tuple.Elements) == 0 {
+				ret = nil // eg. "(text) -> ()"
+			}
+			typ := ast.ProcTyp(types, ret)
+			typ.Variadic = variadic
+			return typ
+		} else if variadic {
+			p.error(p.scanner.Pos(), `A variadic parameter must be part of a procedure type (eg. "(..int) -> ()")`)
+		} else if len(types) == 1 {
+			return types[0]
+		}
+		return ast.TupleTyp(types) // multiple return values (eg. "-> (int, bool)")
+
+	case token.POLYMORPH:
+		typ := ast.PolyTyp(p.lit)
+		p.mark(typ, p.pos)
+		p.next() // eat type parameter
+		return typ
 
 	case token.IDENT:
 		var typ ast.Type
@@ -584,6 +939,7 @@ func (p *Parser) parseType() ast.Type {
 			typ = builtin
 		} else {
 			typ = ast.NamTyp(p.lit)
+			p.mark(typ, p.pos)
 		}
 		p.next() // eat ident
 		return typ
@@ -621,11 +977,36 @@ func (o *Operators) InitBuiltin() {
 	o.defineHACKY(ast.BuiltinRemainder)
 	o.defineHACKY(ast.BuiltinPositive)
 	o.defineHACKY(ast.BuiltinNegative)
+	// bitwise operators
+	o.defineHACKY(ast.BuiltinBitAnd)
+	o.defineHACKY(ast.BuiltinBitOr)
+	o.defineHACKY(ast.BuiltinBitXor)
+	o.defineHACKY(ast.BuiltinShiftLeft)
+	o.defineHACKY(ast.BuiltinShiftRight)
+	o.defineHACKY(ast.BuiltinBitNot)
 	// pointer operators
 	o.defineHACKY(ast.BuiltinReference)
 	o.defineHACKY(ast.BuiltinDereference)
 }
 
+// DefineNamed defines a user operator from its name the first time that it is
+// used; "_dot_" is an infix operator and "_seconds" is a postfix operator.
+// The operator's meaning is provided by an overload of the same name.
+func (o *Operators) DefineNamed(literal string) *ast.OperatorDefn {
+	if len(literal) < 2 || literal[0] != '_' {
+		return nil
+	}
+
+	var op *ast.OperatorDefn
+	if literal[len(literal)-1] == '_' {
+		op = ast.Operator(literal, literal, literal, ast.BinaryInfix, ast.LeftAssociative, ast.ArithmeticPrec)
+	} else {
+		op = ast.Operator(literal, literal, literal, ast.UnaryPostfix, ast.LeftAssociative, ast.PostfixPrec)
+	}
+	o.defineHACKY(op)
+	return op
+}
+
 func (o *Operators) defineHACKY(op *ast.OperatorDefn) {
 	// TODO: Check that the operator has valid values and isn't stepping on any toes
 	o.literals[op.Literal] = append(o.literals[op.Literal], op)
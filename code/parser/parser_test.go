@@ -1,12 +1,52 @@
 package parser
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/kestred/philomath/code/ast"
+	"github.com/kestred/philomath/code/token"
 	"github.com/stretchr/testify/assert"
 )
 
+// withoutPositions clears the source positions of a parsed tree, so that it
+// compares equal to a tree built with the constructors.
+func withoutPositions(node ast.Node) ast.Node {
+	clearPositions(reflect.ValueOf(node), make(map[ast.Node]bool))
+	return node
+}
+
+func clearPositions(v reflect.Value, visited map[ast.Node]bool) {
+	switch v.Kind() {
+	case reflect.Interface:
+		if !v.IsNil() {
+			clearPositions(v.Elem(), visited)
+		}
+	case reflect.Ptr:
+		if v.IsNil() {
+			return
+		}
+		if node, ok := v.Interface().(ast.Node); ok {
+			if visited[node] {
+				return
+			}
+			visited[node] = true
+			ast.SetPosition(node, token.Position{})
+		}
+		clearPositions(v.Elem(), visited)
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			clearPositions(v.Index(i), visited)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).PkgPath == "" { // skips the unexported fields of ast.NodeBase
+				clearPositions(v.Field(i), visited)
+			}
+		}
+	}
+}
+
 func TestParseMain(t *testing.T) {
 	input := `main :: () { somevar := 1; }`
 	parser := Make("example", false, []byte(input))
@@ -19,7 +59,7 @@ func TestParseMain(t *testing.T) {
 				})),
 			)),
 		})
-		assert.Equal(t, expected, top)
+		assert.Equal(t, expected, withoutPositions(top))
 	}
 }
 
@@ -39,16 +79,54 @@ func TestParseError(t *testing.T) {
 	}
 }
 
+func TestParseScannerErrors(t *testing.T) {
+	p := Make("error.phi", false, []byte(`{ x := "\q"; }`))
+	p.ParseEvaluable()
+	if assert.True(t, len(p.Errors) > 0, "Expected some errors but found none.") {
+		assert.Equal(t, "error.phi:1:10: unknown escape sequence", p.Errors[0].Error())
+	}
+}
+
+func TestParseNumberErrors(t *testing.T) {
+	p := Make("error.phi", false, []byte(`{ a := 1__000; }`))
+	p.ParseEvaluable()
+	if assert.True(t, len(p.Errors) > 0, "Expected some errors but found none.") {
+		assert.Equal(t, "error.phi:1:9: '_' must separate successive digits in number", p.Errors[0].Error())
+	}
+
+	p = Make("error.phi", false, []byte(`{ b := 0b102; }`))
+	p.ParseEvaluable()
+	if assert.True(t, len(p.Errors) > 0, "Expected some errors but found none.") {
+		assert.Equal(t, "error.phi:1:12: invalid digit '2' in binary literal", p.Errors[0].Error())
+	}
+}
+
+func TestParseIdentifierErrors(t *testing.T) {
+	p := Make("error.phi", false, []byte("{ \u0440ass := 1; }"))
+	p.ParseEvaluable()
+	if assert.True(t, len(p.Errors) > 0, "Expected some errors but found none.") {
+		assert.Equal(t, "error.phi:1:3: identifier \"\u0440ass\" contains U+0440 '\u0440', which looks like 'p' (eg. \"pass\")", p.Errors[0].Error())
+	}
+
+	p = Make("error.phi", false, []byte("{ a := 1 \u2013 2; }"))
+	p.ParseEvaluable()
+	if assert.True(t, len(p.Errors) > 0, "Expected some errors but found none.") {
+		assert.Equal(t, "error.phi:1:10: unexpected character U+2013 '\u2013', which looks like '-'", p.Errors[0].Error())
+	}
+}
+
 func parseAny(t *testing.T, input string) ast.Node {
 	p := Make("example", false, []byte(input))
 	node := p.ParseEvaluable()
 	assert.Empty(t, p.Errors, "Unexpected parser errors")
-	return node
+	return withoutPositions(node)
 }
 
 func TestParseDeclarations(t *testing.T) {
 	expected := ast.Blok([]ast.Evaluable{
 		ast.Mutable("foo", nil, ast.NumLit("3")),
+		ast.Mutable("bar", ast.BuiltinUint8, ast.NumLit("7")),
+		ast.Mutable("qux", ast.BuiltinFloat32, nil),
 		ast.Immutable("baz", ast.Constant(ast.NumLit("1"))),
 		ast.Eval(ast.InExp(
 			ast.InExp(ast.NumLit("2"), ast.BuiltinAdd, ast.Ident("foo")),
@@ -59,6 +137,8 @@ func TestParseDeclarations(t *testing.T) {
 
 	assert.Equal(t, expected, parseAny(t, `{
 		foo := 3;      // mutable declaration
+		bar: u8 = 7;   // mutable declaration with an explicit type
+		qux: f32;      // mutable declaration without a value
 		baz :: 1;      // constant definition
 		2 + foo + baz; // evaluated statement
 	}`))
@@ -117,6 +197,166 @@ func TestParseProcedures(t *testing.T) {
 	}`))
 }
 
+func TestParseDefaultArguments(t *testing.T) {
+	length := ast.Param("length", ast.BuiltinInt)
+	length.Expr = ast.NumLit("1")
+	named := ast.CallExp(ast.Ident("print"), []ast.Expr{ast.TxtLit(`"a"`), ast.NumLit("2")})
+	named.Names = []*ast.Identifier{nil, ast.Ident("length")}
+
+	expected := ast.Blok([]ast.Evaluable{
+		ast.Immutable("print", ast.Constant(
+			ast.ProcExp([]*ast.MutableDecl{ast.Param("message", ast.BuiltinText), length}, nil, ast.Blok(nil)),
+		)),
+		ast.Eval(ast.CallExp(ast.Ident("print"), []ast.Expr{ast.TxtLit(`"a"`)})),
+		ast.Eval(named),
+	})
+
+	assert.Equal(t, expected, parseAny(t, `{
+		print :: (message: text, length: int = 1) {}
+		print("a");
+		print("a", length = 2);
+	}`))
+}
+
+func TestParseMultipleReturns(t *testing.T) {
+	expected := ast.Blok([]ast.Evaluable{
+		ast.Immutable("find", ast.Constant(
+			ast.ProcExp(nil, ast.TupleTyp([]ast.Type{ast.BuiltinInt, ast.BuiltinBool}),
+				ast.Blok([]ast.Evaluable{ast.Return(ast.TupleExp([]ast.Expr{ast.NumLit("3"), ast.Ident("true")}))})),
+		)),
+		ast.Destructure([]string{"x", "ok"}, ast.CallExp(ast.Ident("find"), nil)),
+		ast.Assign([]ast.Expr{ast.Ident("x"), ast.Ident("ok")}, nil, []ast.Expr{ast.CallExp(ast.Ident("find"), nil)}),
+	})
+
+	assert.Equal(t, expected, parseAny(t, `{
+		find :: () -> (int, bool) { return 3, true; }
+		x, ok := find();
+		x, ok = find();
+	}`))
+}
+
+func TestParseProcedureTypes(t *testing.T) {
+	unary := func() ast.Type { return ast.ProcTyp([]ast.Type{ast.BuiltinInt}, ast.BuiltinInt) }
+	expected := ast.Blok([]ast.Evaluable{
+		ast.Immutable("Op", ast.Struct([]*ast.StructField{
+			ast.Field("apply", unary()),
+			ast.Field("report", ast.ProcTyp([]ast.Type{ast.BuiltinText, ast.BuiltinInt}, nil)),
+		})),
+		ast.Immutable("apply", ast.Constant(
+			ast.ProcExp([]*ast.MutableDecl{ast.Param("f", unary()), ast.Param("n", ast.BuiltinInt)}, ast.BuiltinInt,
+				ast.Blok([]ast.Evaluable{ast.Return(ast.CallExp(ast.Ident("f"), []ast.Expr{ast.Ident("n")}))})),
+		)),
+		ast.Mutable("f", unary(), ast.Ident("double")),
+	})
+
+	assert.Equal(t, expected, parseAny(t, `{
+		Op :: struct {
+			apply: (int) -> int;
+			report: (text, int) -> ();
+		}
+		apply :: (f: (int) -> int, n: int) -> int { return f(n); }
+		f: (int) -> int = double;
+	}`))
+}
+
+func TestParsePolymorphicProcedures(t *testing.T) {
+	expected := ast.Immutable("max", ast.Constant(
+		ast.ProcExp([]*ast.MutableDecl{
+			ast.Param("a", ast.PolyTyp("T")),
+			ast.Param("b", ast.NamTyp("T")),
+		}, ast.NamTyp("T"), ast.Blok([]ast.Evaluable{ast.Return(ast.Ident("a"))})),
+	))
+	assert.Equal(t, expected, parseAny(t, `max :: (a: $T, b: T) -> T { return a; }`))
+
+	// type parameters may be nested in other types
+	expected = ast.Immutable("apply", ast.Constant(
+		ast.ProcExp([]*ast.MutableDecl{
+			ast.Param("f", ast.ProcTyp([]ast.Type{ast.PolyTyp("T")}, ast.NamTyp("T"))),
+		}, nil, ast.Blok(nil)),
+	))
+	assert.Equal(t, expected, parseAny(t, `apply :: (f: ($T) -> T) {}`))
+}
+
+func TestParseVariadics(t *testing.T) {
+	sum := ast.CallExp(ast.Ident("sum"), []ast.Expr{ast.NumLit("1"), ast.Ident("rest")})
+	sum.Spread = true
+	report := ast.ProcTyp([]ast.Type{ast.BuiltinText, ast.ArrTyp(ast.BuiltinInt, nil)}, nil)
+	report.Variadic = true
+	expected := ast.Blok([]ast.Evaluable{
+		ast.Immutable("sum", ast.Constant(
+			ast.ProcExp([]*ast.MutableDecl{ast.Param("first", ast.BuiltinInt), ast.VarParam("rest", ast.BuiltinInt)}, ast.BuiltinInt,
+				ast.Blok([]ast.Evaluable{ast.Return(ast.InExp(ast.Ident("first"), ast.BuiltinAdd, ast.GetExp(ast.Ident("rest"), "count")))})),
+		)),
+		ast.Eval(sum),
+		ast.Eval(ast.IdxExp(ast.Ident("rest"), ast.NumLit("0"))),
+		ast.Mutable("f", report, nil),
+	})
+
+	assert.Equal(t, expected, parseAny(t, `{
+		sum :: (first: int, rest: ..int) -> int { return first + rest.count; }
+		sum(1, ..rest);
+		rest[0];
+		f: (text, ..int) -> ();
+	}`))
+}
+
+func TestParseDefer(t *testing.T) {
+	expected := ast.Blok([]ast.Evaluable{
+		ast.Defer(ast.Eval(ast.CallExp(ast.Ident("close"), []ast.Expr{ast.Ident("fd")}))),
+		ast.Defer(ast.Blok([]ast.Evaluable{ast.Assign([]ast.Expr{ast.Ident("fd")}, nil, []ast.Expr{ast.NumLit("0")})})),
+	})
+	assert.Equal(t, expected, parseAny(t, `{
+		defer close(fd);
+		defer { fd = 0; }
+	}`))
+}
+
+func TestParseWhile(t *testing.T) {
+	expected := ast.Blok([]ast.Evaluable{
+		ast.While(ast.Ident("more"), ast.Blok([]ast.Evaluable{
+			ast.Eval(ast.CallExp(ast.Ident("read"), []ast.Expr{ast.Ident("fd")})),
+			ast.Done(),
+		})),
+	})
+	assert.Equal(t, expected, parseAny(t, `{
+		while more {
+			read(fd);
+			done;
+		}
+	}`))
+}
+
+func TestParseOverloads(t *testing.T) {
+	vec := func() ast.Type { return ast.NamTyp("Vec") }
+	expected := ast.Blok([]ast.Evaluable{
+		ast.Immutable("Vec", ast.Struct([]*ast.StructField{
+			ast.Field("x", ast.BuiltinFloat),
+			ast.Field("y", ast.BuiltinFloat),
+		})),
+		ast.Immutable("_add_", ast.Constant(
+			ast.ProcExp([]*ast.MutableDecl{ast.Param("a", vec()), ast.Param("b", vec())}, vec(),
+				ast.Blok([]ast.Evaluable{ast.Return(ast.Ident("a"))})),
+		)),
+		ast.Immutable("neg_", ast.Constant(
+			ast.ProcExp([]*ast.MutableDecl{ast.Param("v", vec())}, vec(),
+				ast.Blok([]ast.Evaluable{ast.Return(ast.Ident("v"))})),
+		)),
+		ast.Eval(ast.InExp(ast.Ident("u"), ast.BuiltinAdd, ast.PreExp(ast.BuiltinNegative, ast.Ident("v")))),
+	})
+
+	assert.Equal(t, expected, parseAny(t, `{
+		Vec :: struct {
+			x: float;
+			y: float;
+		}
+
+		_add_ :: (a: Vec, b: Vec) -> Vec { return a; }
+		neg_ :: (v: Vec) -> Vec { return v; }
+
+		u + -v;
+	}`))
+}
+
 func TestParseBlocks(t *testing.T) {
 	expected := ast.Blok([]ast.Evaluable{
 		ast.Blok([]ast.Evaluable{
@@ -161,6 +401,47 @@ func TestParseBlocks(t *testing.T) {
 	}`))
 }
 
+func TestParseCompoundAssignment(t *testing.T) {
+	expected := ast.Blok([]ast.Evaluable{
+		ast.Assign([]ast.Expr{ast.Ident("a")}, ast.BuiltinAdd, []ast.Expr{ast.NumLit("2")}),
+		ast.Assign(
+			[]ast.Expr{ast.Ident("a"), ast.Ident("b")}, ast.BuiltinMultiply,
+			[]ast.Expr{ast.NumLit("2"), ast.NumLit("3")},
+		),
+		ast.Assign(
+			[]ast.Expr{ast.Ident("v")},
+			ast.Operator("_dot_", "_dot_", "_dot_", ast.BinaryInfix, ast.LeftAssociative, ast.ArithmeticPrec),
+			[]ast.Expr{ast.Ident("w")},
+		),
+	})
+
+	assert.Equal(t, expected, parseAny(t, `{
+		a += 2;
+		a, b *= 2, 3;   // parallel compound assignment
+		v _dot_= w;     // user-defined operator
+	}`))
+
+	// report spaces between the operator and '=', but keep parsing
+	p := Make("example", false, []byte(`{ a + = 2; }`))
+	node := p.ParseEvaluable()
+	if assert.Equal(t, 1, len(p.Errors)) {
+		assert.Equal(t, `example:1:5: A compound assignment can't have spaces between the operator and '=' (eg. "a += b")`,
+			p.Errors[0].Error())
+	}
+
+	expected = ast.Blok([]ast.Evaluable{
+		ast.Assign([]ast.Expr{ast.Ident("a")}, ast.BuiltinAdd, []ast.Expr{ast.NumLit("2")}),
+	})
+	assert.Equal(t, expected, withoutPositions(node))
+
+	// only arithmetic operators can be compounded
+	p = Make("example", false, []byte(`{ a < = 2; }`))
+	p.ParseEvaluable()
+	if assert.Equal(t, 1, len(p.Errors)) {
+		assert.Equal(t, "example:1:5: The operator '<' cannot be used in a compound assignment", p.Errors[0].Error())
+	}
+}
+
 func TestParseAsmBlock(t *testing.T) {
 	// GNU Assembler using .intel_syntax
 	asm := ast.Asm(`
@@ -192,7 +473,7 @@ func parseExpr(t *testing.T, input string) ast.Expr {
 	p := Make("example", false, []byte(input))
 	node := p.ParseEvaluable()
 	assert.Empty(t, p.Errors, "Unexpected parser errors")
-	return node.(*ast.EvalStmt).Expr
+	return withoutPositions(node).(*ast.EvalStmt).Expr
 }
 
 func TestParseArithmetic(t *testing.T) {
@@ -330,4 +611,263 @@ func TestParseArithmetic(t *testing.T) {
 	)
 
 	assert.Equal(t, expected, parseExpr(t, `-2 / +4;`))
+
+	// operators after a call
+	expected = ast.InExp(
+		ast.CallExp(ast.Ident("f"), []ast.Expr{ast.NumLit("2")}),
+		ast.BuiltinMultiply,
+		ast.NumLit("4"),
+	)
+
+	assert.Equal(t, expected, parseExpr(t, `f(2) * 4;`))
+}
+
+func TestParseCasts(t *testing.T) {
+	var expected ast.Expr
+
+	expected = ast.InExp(
+		ast.CastExp(ast.BuiltinUint8, ast.Ident("x"), false),
+		ast.BuiltinAdd,
+		ast.NumLit("1"),
+	)
+
+	assert.Equal(t, expected, parseExpr(t, `cast(u8) x + 1;`))
+
+	expected = ast.InExp(
+		ast.CastExp(ast.BuiltinInt32, ast.Ident("a"), true),
+		ast.BuiltinMultiply,
+		ast.CastExp(ast.BuiltinFloat, ast.GrpExp(ast.Ident("b")), false),
+	)
+
+	assert.Equal(t, expected, parseExpr(t, `cast?(i32) a * cast(float) (b);`))
+}
+
+func TestParseRunDirective(t *testing.T) {
+	var expected ast.Node
+
+	expected = ast.InExp(
+		ast.RunExp(ast.CallExp(ast.Ident("fib"), []ast.Expr{ast.NumLit("10")}), nil),
+		ast.BuiltinAdd,
+		ast.NumLit("1"),
+	)
+	assert.Equal(t, expected, parseExpr(t, `#run fib(10) + 1;`))
+
+	expected = ast.Blok([]ast.Evaluable{
+		ast.Immutable("x", ast.Constant(ast.RunExp(nil, ast.Blok([]ast.Evaluable{
+			ast.Mutable("a", nil, ast.NumLit("2")),
+			ast.Eval(ast.InExp(ast.Ident("a"), ast.BuiltinMultiply, ast.NumLit("3"))),
+		})))),
+		ast.Eval(ast.RunExp(ast.Ident("x"), nil)),
+	})
+	assert.Equal(t, expected, parseAny(t, `{ x :: #run { a := 2; a * 3; }; #run x; }`))
+}
+
+func TestParseAssertDirective(t *testing.T) {
+	var expected ast.Node
+
+	expected = ast.Blok([]ast.Evaluable{
+		ast.Immutable("page", ast.Constant(ast.NumLit("4096"))),
+		ast.AssertDir(
+			ast.CmpExp([]ast.Expr{ast.InExp(ast.Ident("page"), ast.BuiltinRemainder, ast.NumLit("8")), ast.NumLit("0")}, []*ast.OperatorDefn{ast.BuiltinEqual}),
+			ast.TxtLit(`"misaligned page"`),
+		),
+		ast.AssertDir(ast.Ident("page"), nil),
+	})
+	assert.Equal(t, expected, parseAny(t, `{ page :: 4096; #assert page % 8 == 0, "misaligned page"; #assert page; }`))
+
+	p := Make("example", false, []byte(`#assert POINTER_SIZE == 8, "requires a 64-bit target";`))
+	top := p.ParseTop()
+	if assert.Empty(t, p.Errors) && assert.Equal(t, 1, len(top.Decls)) {
+		_, ok := top.Decls[0].(*ast.AssertDirective)
+		assert.True(t, ok)
+	}
+
+	p = Make("example", false, []byte(`#assert 1 == 1, 2;`))
+	p.ParseTop()
+	if assert.Equal(t, 1, len(p.Errors)) {
+		assert.Equal(t, `example:1:17: The message of an "#assert" must be text (eg. "#assert x > 0, "x must be positive";")`, p.Errors[0].Error())
+	}
+}
+
+func TestParseIfDirective(t *testing.T) {
+	var expected ast.Node
+
+	expected = ast.Blok([]ast.Evaluable{
+		ast.IfDir(
+			ast.CmpExp([]ast.Expr{ast.Ident("POINTER_SIZE"), ast.NumLit("8")}, []*ast.OperatorDefn{ast.BuiltinEqual}),
+			ast.Blok([]ast.Evaluable{ast.Mutable("a", nil, ast.NumLit("1"))}),
+			ast.Blok([]ast.Evaluable{ast.Mutable("a", nil, ast.NumLit("2"))}),
+		),
+	})
+	assert.Equal(t, expected, parseAny(t, `{ #if POINTER_SIZE == 8 { a := 1; } #else { a := 2; } }`))
+
+	// at the top level, the blocks contain declarations
+	input := `
+	#if OS == OS_LINUX {
+		exit :: 60;
+	} #else #if OS == OS_DARWIN {
+		exit :: 1;
+	}
+	main :: () {}`
+	p := Make("example", false, []byte(input))
+	top := p.ParseTop()
+	if assert.Empty(t, p.Errors) {
+		expected = ast.Top([]ast.Decl{
+			ast.IfDir(
+				ast.CmpExp([]ast.Expr{ast.Ident("OS"), ast.Ident("OS_LINUX")}, []*ast.OperatorDefn{ast.BuiltinEqual}),
+				ast.Blok([]ast.Evaluable{ast.Immutable("exit", ast.Constant(ast.NumLit("60")))}),
+				ast.Blok([]ast.Evaluable{ast.IfDir(
+					ast.CmpExp([]ast.Expr{ast.Ident("OS"), ast.Ident("OS_DARWIN")}, []*ast.OperatorDefn{ast.BuiltinEqual}),
+					ast.Blok([]ast.Evaluable{ast.Immutable("exit", ast.Constant(ast.NumLit("1")))}),
+					nil,
+				)}),
+			),
+			ast.Immutable("main", ast.Constant(ast.ProcExp(nil, nil, ast.Blok(nil)))),
+		})
+		assert.Equal(t, "example:2:2", ast.PositionOf(top.Decls[0]).String())
+		assert.Equal(t, expected, withoutPositions(top))
+	}
+}
+
+func TestParseDirectiveErrors(t *testing.T) {
+	p := Make("example", false, []byte(`{ #unknown { 1; }; }`))
+	p.ParseEvaluable()
+	if assert.Equal(t, 1, len(p.Errors)) {
+		assert.Equal(t, `example:1:3: Unknown directive "#unknown"`, p.Errors[0].Error())
+	}
+
+	p = Make("example", false, []byte(`x := #asm { syscall };`))
+	p.ParseEvaluable()
+	if assert.True(t, len(p.Errors) > 0) {
+		assert.Equal(t, `example:1:6: The directive "#asm" can't be used as a value`, p.Errors[0].Error())
+	}
+
+	p = Make("example", false, []byte("#run main();\nmain :: () {}"))
+	top := p.ParseTop()
+	if assert.Equal(t, 1, len(p.Errors)) {
+		assert.Equal(t, `example:1:1: The directive "#run" can't be used at the top level`, p.Errors[0].Error())
+	}
+	assert.Equal(t, 1, len(top.Decls))
+}
+
+func TestParseComparisons(t *testing.T) {
+	var expected ast.Expr
+
+	// a single comparison
+	expected = ast.CmpExp(
+		[]ast.Expr{ast.Ident("a"), ast.InExp(ast.Ident("b"), ast.BuiltinAdd, ast.NumLit("1"))},
+		[]*ast.OperatorDefn{ast.BuiltinLess},
+	)
+
+	assert.Equal(t, expected, parseExpr(t, `a < b + 1;`))
+
+	expected = ast.CmpExp(
+		[]ast.Expr{ast.InExp(ast.Ident("a"), ast.BuiltinAdd, ast.NumLit("1")), ast.Ident("b")},
+		[]*ast.OperatorDefn{ast.BuiltinLess},
+	)
+
+	assert.Equal(t, expected, parseExpr(t, `a + 1 < b;`))
+
+	// chained comparisons
+	expected = ast.CmpExp(
+		[]ast.Expr{ast.Ident("a"), ast.Ident("b"), ast.Ident("c")},
+		[]*ast.OperatorDefn{ast.BuiltinLess, ast.BuiltinLessOrEqual},
+	)
+
+	assert.Equal(t, expected, parseExpr(t, `a < b <= c;`))
+
+	expected = ast.CmpExp(
+		[]ast.Expr{ast.Ident("a"), ast.Ident("b"), ast.Ident("c"), ast.Ident("d")},
+		[]*ast.OperatorDefn{ast.BuiltinGreaterOrEqual, ast.BuiltinGreater, ast.BuiltinGreaterOrEqual},
+	)
+
+	assert.Equal(t, expected, parseExpr(t, `a >= b > c >= d;`))
+
+	expected = ast.CmpExp(
+		[]ast.Expr{ast.Ident("a"), ast.Ident("b"), ast.Ident("c")},
+		[]*ast.OperatorDefn{ast.BuiltinEqual, ast.BuiltinEqual},
+	)
+
+	assert.Equal(t, expected, parseExpr(t, `a == b == c;`))
+
+	// mixed directions
+	p := Make("example", false, []byte(`a < b > c;`))
+	p.ParseEvaluable()
+	if assert.Equal(t, 1, len(p.Errors)) {
+		assert.Equal(t, `example:1:7: Comparisons can only be chained in one direction (eg. "a < b <= c"), but '>' follows '<'`, p.Errors[0].Error())
+	}
+
+	p = Make("example", false, []byte(`a == b <= c;`))
+	p.ParseEvaluable()
+	if assert.Equal(t, 1, len(p.Errors)) {
+		assert.Equal(t, `example:1:8: Comparisons can only be chained in one direction (eg. "a < b <= c"), but '<=' follows '=='`, p.Errors[0].Error())
+	}
+}
+
+func TestParseBitwise(t *testing.T) {
+	var expected ast.Expr
+
+	// "&" and shifts bind like "*", while "|" and "xor" bind like "+"
+	expected = ast.InExp(
+		ast.InExp(ast.Ident("a"), ast.BuiltinBitOr, ast.Ident("b")),
+		ast.BuiltinBitXor,
+		ast.InExp(
+			ast.InExp(ast.Ident("c"), ast.BuiltinBitAnd, ast.Ident("d")),
+			ast.BuiltinShiftLeft,
+			ast.NumLit("2"),
+		),
+	)
+
+	assert.Equal(t, expected, parseExpr(t, `a | b xor c & d << 2;`))
+
+	expected = ast.InExp(
+		ast.InExp(ast.Ident("a"), ast.BuiltinShiftRight, ast.NumLit("4")),
+		ast.BuiltinRemainder,
+		ast.PreExp(ast.BuiltinBitNot, ast.Ident("b")),
+	)
+
+	assert.Equal(t, expected, parseExpr(t, `a >> 4 % !b;`))
+
+	// compound forms
+	block := ast.Blok([]ast.Evaluable{
+		ast.Assign([]ast.Expr{ast.Ident("a")}, ast.BuiltinShiftLeft, []ast.Expr{ast.NumLit("1")}),
+		ast.Assign([]ast.Expr{ast.Ident("a")}, ast.BuiltinBitXor, []ast.Expr{ast.Ident("b")}),
+	})
+
+	assert.Equal(t, block, parseAny(t, `{ a <<= 1; a xor= b; }`))
+}
+
+func TestParseMembership(t *testing.T) {
+	var expected ast.Expr
+
+	// membership in a range
+	expected = ast.InExp(
+		ast.Ident("x"),
+		ast.BuiltinElementOf,
+		ast.RangeExp(ast.NumLit("0"), ast.NumLit("10")),
+	)
+
+	assert.Equal(t, expected, parseExpr(t, `x in 0..10;`))
+
+	// membership in an expression
+	expected = ast.InExp(ast.Ident("x"), ast.BuiltinNotElementOf, ast.Ident("arr"))
+	assert.Equal(t, expected, parseExpr(t, `x not in arr;`))
+
+	expected = ast.InExp(ast.Ident("c"), ast.BuiltinElementOf, ast.TxtLit(`"aeiou"`))
+	assert.Equal(t, expected, parseExpr(t, `c in "aeiou";`))
+
+	expected = ast.InExp(ast.CharLit(`'\n'`), ast.BuiltinNotElementOf, ast.Ident("line"))
+	assert.Equal(t, expected, parseExpr(t, `'\n' not in line;`))
+
+	// membership follows arithmetic
+	expected = ast.InExp(
+		ast.InExp(ast.Ident("x"), ast.BuiltinAdd, ast.NumLit("1")),
+		ast.BuiltinNotElementOf,
+		ast.RangeExp(
+			ast.NumLit("0"),
+			ast.InExp(ast.Ident("n"), ast.BuiltinMultiply, ast.NumLit("2")),
+		),
+	)
+
+	assert.Equal(t, expected, parseExpr(t, `x + 1 not in 0..n * 2;`))
 }
@@ -0,0 +1,312 @@
+package scanner
+
+import (
+	"bytes"
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+)
+
+// An EscapeError is an invalid escape sequence (or character) in a text or
+// char literal; the offset is relative to the start of the literal.
+type EscapeError struct {
+	Offset int
+	Msg    string
+}
+
+func (e *EscapeError) Error() string {
+	return fmt.Sprintf("%d: %s", e.Offset, e.Msg)
+}
+
+const errByteInChar = `a "\x" escape in a char literal must be at most "\x7F" (eg. use "\u{FF}")`
+
+// decodeEscape decodes the escape sequence starting at the backslash in
+// src[offset]; it returns the codepoint (or byte, for "\xNN") that the escape
+// represents, and the offset after the escape.  In case of an error, the
+// offset of the error is the offending character (or the character after the
+// backslash, if the escape is invalid as a whole).
+func decodeEscape(src []byte, offset int) (r rune, isByte bool, end int, err *EscapeError) {
+	esc := offset + 1
+	end = esc
+	if end >= len(src) {
+		return 0, false, end, &EscapeError{esc, "unterminated escape sequence"}
+	}
+
+	switch ch := src[end]; ch {
+	case 'a':
+		return '\a', false, end + 1, nil
+	case 'b':
+		return '\b', false, end + 1, nil
+	case 'f':
+		return '\f', false, end + 1, nil
+	case 'n':
+		return '\n', false, end + 1, nil
+	case 'r':
+		return '\r', false, end + 1, nil
+	case 't':
+		return '\t', false, end + 1, nil
+	case 'v':
+		return '\v', false, end + 1, nil
+	case '0':
+		return 0, false, end + 1, nil
+	case '\\', '"', '\'':
+		return rune(ch), false, end + 1, nil
+	case 'x':
+		// exactly two hex digits (eg. "\x7F")
+		end += 1
+		var x rune
+		for i := 0; i < 2; i++ {
+			if end >= len(src) || digitVal(rune(src[end])) >= 16 {
+				return 0, false, end, unexpectedInEscape(src, end)
+			}
+			x = x*16 + rune(digitVal(rune(src[end])))
+			end += 1
+		}
+		return x, true, end, nil
+	case 'u', 'U':
+		end += 1
+		if ch == 'u' && end < len(src) && src[end] == '{' {
+			return decodeBracedEscape(src, esc, end)
+		}
+
+		// exactly four (or eight, for "\U") hex digits (eg. "\u00E9")
+		n := 4
+		if ch == 'U' {
+			n = 8
+		}
+		var x rune
+		for i := 0; i < n; i++ {
+			if end >= len(src) || digitVal(rune(src[end])) >= 16 {
+				return 0, false, end, unexpectedInEscape(src, end)
+			}
+			x = x*16 + rune(digitVal(rune(src[end])))
+			end += 1
+		}
+		if x > unicode.MaxRune || 0xD800 <= x && x < 0xE000 {
+			return 0, false, end, &EscapeError{esc, "escape sequence is invalid Unicode code point"}
+		}
+		return x, false, end, nil
+	default:
+		return 0, false, end, &EscapeError{esc, "unknown escape sequence"}
+	}
+}
+
+// decodeBracedEscape decodes the one to six hex digits of an escape in braces
+// (eg. "\u{1F600}"), where src[open] is the opening brace.
+func decodeBracedEscape(src []byte, esc, open int) (r rune, isByte bool, end int, err *EscapeError) {
+	end = open + 1
+	var x rune
+	digits := 0
+	for end < len(src) && src[end] != '}' {
+		if digitVal(rune(src[end])) >= 16 || digits == 6 {
+			return 0, false, end, unexpectedInEscape(src, end)
+		}
+		x = x*16 + rune(digitVal(rune(src[end])))
+		digits += 1
+		end += 1
+	}
+	if end >= len(src) {
+		return 0, false, end, unexpectedInEscape(src, end)
+	} else if digits == 0 {
+		return 0, false, end, &EscapeError{end, "missing digits in escape sequence"}
+	}
+	end += 1 // eat '}'
+
+	if x > unicode.MaxRune || 0xD800 <= x && x < 0xE000 {
+		return 0, false, end, &EscapeError{esc, "escape sequence is invalid Unicode code point"}
+	}
+	return x, false, end, nil
+}
+
+func unexpectedInEscape(src []byte, offset int) *EscapeError {
+	if offset >= len(src) {
+		return &EscapeError{offset, "unterminated escape sequence"}
+	}
+	r, _ := utf8.DecodeRune(src[offset:])
+	return &EscapeError{offset, fmt.Sprintf("unexpected character in escape sequence: %#U", r)}
+}
+
+// Unquote decodes the value of a text literal (eg. `"a\tb"`), which is
+// encoded as UTF-8 except for any "\xNN" escapes.  The value of a raw text
+// literal is its content; and each line of multi-line text is decoded after
+// removing the indentation of its closing quotes.  The value of empty text
+// is an empty (rather than nil) slice.
+func Unquote(lit string) ([]byte, error) {
+	src := []byte(lit)
+	switch {
+	case len(src) >= 2 && src[0] == '`' && src[len(src)-1] == '`':
+		return append([]byte{}, bytes.Replace(src[1:len(src)-1], []byte("\r"), nil, -1)...), nil
+	case len(src) >= 6 && bytes.HasPrefix(src, []byte(`"""`)) && bytes.HasSuffix(src, []byte(`"""`)):
+		lines, err := multilineSpans(src)
+		if err != nil {
+			return nil, err
+		}
+
+		buf := bytes.NewBuffer(make([]byte, 0, len(src)))
+		for i, line := range lines {
+			if i > 0 {
+				buf.WriteByte('\n')
+			}
+			if err := decodeText(buf, src[:line.end], line.start); err != nil {
+				return nil, err
+			}
+		}
+		return buf.Bytes(), nil
+	case len(src) >= 2 && src[0] == '"' && src[len(src)-1] == '"':
+		buf := bytes.NewBuffer(make([]byte, 0, len(src)))
+		if err := decodeText(buf, src[:len(src)-1], 1); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, &EscapeError{0, "text literal is not quoted"}
+	}
+}
+
+// decodeText decodes the text from src[offset:], replacing any escapes.
+func decodeText(buf *bytes.Buffer, src []byte, offset int) *EscapeError {
+	for offset < len(src) {
+		if src[offset] != '\\' {
+			buf.WriteByte(src[offset])
+			offset += 1
+			continue
+		}
+
+		r, isByte, end, err := decodeEscape(src, offset)
+		if err != nil {
+			return err
+		} else if isByte {
+			buf.WriteByte(byte(r))
+		} else {
+			buf.WriteRune(r)
+		}
+		offset = end
+	}
+	return nil
+}
+
+type span struct {
+	start, end int
+}
+
+// multilineSpans returns the content of each line of a multi-line text
+// literal, after removing the indentation of its closing quotes; the content
+// starts on the line after the opening quotes.
+func multilineSpans(lit []byte) ([]span, *EscapeError) {
+	var lines []span
+	start, end := 3, len(lit)-3
+	for i := start; i < end; i++ {
+		if lit[i] == '\n' {
+			lines = append(lines, span{start, trimReturn(lit, start, i)})
+			start = i + 1
+		}
+	}
+
+	if len(lines) == 0 || !isBlank(lit[lines[0].start:lines[0].end]) {
+		return nil, &EscapeError{3, `multi-line text must start on a new line after the opening """`}
+	}
+	indent := lit[start:end]
+	if !isBlank(indent) {
+		return nil, &EscapeError{end, `the closing """ of multi-line text must be on its own line`}
+	}
+
+	lines = lines[1:]
+	for i, line := range lines {
+		content := lit[line.start:line.end]
+		if bytes.HasPrefix(content, indent) {
+			lines[i].start += len(indent)
+		} else if isBlank(content) {
+			lines[i].start = line.end
+		} else {
+			return nil, &EscapeError{line.start, `each line of multi-line text must be indented at least as much as the closing """`}
+		}
+	}
+	return lines, nil
+}
+
+// trimReturn excludes the carriage return of a "\r\n" line ending.
+func trimReturn(src []byte, start int, end int) int {
+	if end > start && src[end-1] == '\r' {
+		return end - 1
+	}
+	return end
+}
+
+func isBlank(text []byte) bool {
+	for _, ch := range text {
+		if ch != ' ' && ch != '\t' && ch != '\r' {
+			return false
+		}
+	}
+	return true
+}
+
+// UnquoteChar decodes the value of a char literal (eg. `'\n'`).
+func UnquoteChar(lit string) (rune, error) {
+	src := []byte(lit)
+	if len(src) < 2 || src[0] != '\'' || src[len(src)-1] != '\'' {
+		return 0, &EscapeError{0, "char literal is not quoted"}
+	}
+
+	r, size, err := decodeChar(src[:len(src)-1], 1)
+	if err != nil {
+		return 0, err
+	} else if size == 0 {
+		return 0, &EscapeError{0, "empty char literal"}
+	} else if 1+size < len(src)-1 {
+		return 0, &EscapeError{1 + size, "char literal must contain exactly one character"}
+	}
+	return r, nil
+}
+
+// decodeChar decodes one character (or escape) of a char literal, returning
+// its codepoint and size in the source.
+func decodeChar(src []byte, offset int) (rune, int, *EscapeError) {
+	if offset >= len(src) {
+		return 0, 0, nil
+	} else if src[offset] != '\\' {
+		r, size := utf8.DecodeRune(src[offset:])
+		return r, size, nil
+	}
+
+	r, isByte, end, err := decodeEscape(src, offset)
+	if err != nil {
+		return 0, end - offset, err
+	} else if isByte && r >= utf8.RuneSelf {
+		return 0, end - offset, &EscapeError{offset, errByteInChar}
+	}
+	return r, end - offset, nil
+}
+
+// Quote encodes text as a text literal, which Unquote decodes to the same
+// bytes; it is used for text which isn't from the source (eg. the result of
+// "#run").
+func Quote(text []byte) string {
+	var buf bytes.Buffer
+	buf.WriteByte('"')
+	for len(text) > 0 {
+		r, size := utf8.DecodeRune(text)
+		switch {
+		case r == utf8.RuneError && size == 1:
+			fmt.Fprintf(&buf, `\x%02X`, text[0])
+		case r == '"' || r == '\\':
+			buf.WriteByte('\\')
+			buf.WriteRune(r)
+		case r == '\n':
+			buf.WriteString(`\n`)
+		case r == '\r':
+			buf.WriteString(`\r`)
+		case r == '\t':
+			buf.WriteString(`\t`)
+		case r == 0:
+			buf.WriteString(`\0`)
+		case unicode.IsPrint(r):
+			buf.WriteRune(r)
+		default:
+			fmt.Fprintf(&buf, `\u{%X}`, r)
+		}
+		text = text[size:]
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
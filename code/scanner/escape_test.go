@@ -0,0 +1,77 @@
+package scanner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnquote(t *testing.T) {
+	text, err := Unquote(`"tab\t \"quote\" \\ \0 \x41\xFF \u{E9}\u{1F600}"`)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("tab\t \"quote\" \\ \x00 A\xFF é\U0001F600"), text)
+
+	text, err = Unquote(`"\u00E9\U0001F600"`)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("é\U0001F600"), text)
+
+	_, err = Unquote(`"bad \u{D800}"`)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, &EscapeError{6, "escape sequence is invalid Unicode code point"}, err)
+	}
+	_, err = Unquote(`"bad \q"`)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, &EscapeError{6, "unknown escape sequence"}, err)
+	}
+}
+
+func TestUnquoteChar(t *testing.T) {
+	for lit, expected := range map[string]rune{
+		`'a'`: 'a', `'é'`: 'é', `'\n'`: '\n', `'\''`: '\'', `'\x7F'`: 0x7F, `'\u{1F600}'`: 0x1F600,
+	} {
+		char, err := UnquoteChar(lit)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, char, lit)
+	}
+
+	_, err := UnquoteChar(`''`)
+	assert.Equal(t, &EscapeError{0, "empty char literal"}, err)
+	_, err = UnquoteChar(`'ab'`)
+	assert.Equal(t, &EscapeError{2, "char literal must contain exactly one character"}, err)
+	_, err = UnquoteChar(`'\xFF'`)
+	assert.Equal(t, &EscapeError{1, errByteInChar}, err)
+}
+
+func TestQuote(t *testing.T) {
+	text := []byte("tab\t \"quote\" \\ \x00\x07 \xFF é")
+	assert.Equal(t, `"tab\t \"quote\" \\ \0\u{7} \xFF é"`, Quote(text))
+
+	unquoted, err := Unquote(Quote(text))
+	assert.Nil(t, err)
+	assert.Equal(t, text, unquoted)
+}
+
+func TestUnquoteMultilineText(t *testing.T) {
+	text, err := Unquote("`raw \\n\r\n  text`")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("raw \\n\n  text"), text)
+
+	text, err = Unquote("\"\"\"\n    one\\t\n\n      \"two\"\r\n    \"\"\"")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("one\t\n\n  \"two\""), text)
+
+	text, err = Unquote("\"\"\"\n  \"\"\"")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte(""), text)
+
+	text, err = Unquote(`""`)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte(""), text)
+
+	text, err = Unquote("``")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte(""), text)
+
+	_, err = Unquote("\"\"\"\n    one\n  two\n    \"\"\"")
+	assert.Equal(t, &EscapeError{12, `each line of multi-line text must be indented at least as much as the closing """`}, err)
+}
@@ -0,0 +1,105 @@
+package scanner
+
+import (
+	"bytes"
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+)
+
+// isIdentStart reports whether ch can start an identifier; beyond ASCII, these
+// are the ID_Start characters of UAX #31 (eg. "φ").
+func isIdentStart(ch rune) bool {
+	if ch < utf8.RuneSelf {
+		return isLetter(ch)
+	}
+	return unicode.In(ch, unicode.L, unicode.Nl, unicode.Other_ID_Start) &&
+		!unicode.In(ch, unicode.Pattern_Syntax, unicode.Pattern_White_Space)
+}
+
+// isIdentContinue reports whether ch can continue an identifier; beyond ASCII,
+// these are the ID_Continue characters of UAX #31 (eg. combining accents).
+func isIdentContinue(ch rune) bool {
+	if ch < utf8.RuneSelf {
+		return isLetter(ch) || isDigit(ch) || ch == '_'
+	}
+	return isIdentStart(ch) ||
+		unicode.In(ch, unicode.Mn, unicode.Mc, unicode.Nd, unicode.Pc, unicode.Other_ID_Continue) &&
+			!unicode.In(ch, unicode.Pattern_Syntax, unicode.Pattern_White_Space)
+}
+
+// confusables are the characters which are easily mistaken for an ASCII
+// character; see also the fullwidth forms in confusableWith.
+var confusables = map[rune]rune{
+	// cyrillic
+	0x0430: 'a', 0x0435: 'e', 0x043E: 'o', 0x0440: 'p', 0x0441: 'c', 0x0443: 'y',
+	0x0445: 'x', 0x0456: 'i', 0x0458: 'j', 0x0455: 's', 0x0501: 'd', 0x04BB: 'h',
+	0x051B: 'q', 0x051D: 'w', 0x0410: 'A', 0x0412: 'B', 0x0415: 'E', 0x041A: 'K',
+	0x041C: 'M', 0x041D: 'H', 0x041E: 'O', 0x0420: 'P', 0x0421: 'C', 0x0422: 'T',
+	0x0425: 'X', 0x0406: 'I', 0x0408: 'J', 0x0405: 'S',
+
+	// greek
+	0x03BF: 'o', 0x0391: 'A', 0x0392: 'B', 0x0395: 'E', 0x0396: 'Z',
+	0x0397: 'H', 0x0399: 'I', 0x039A: 'K', 0x039C: 'M', 0x039D: 'N', 0x039F: 'O',
+	0x03A1: 'P', 0x03A4: 'T', 0x03A5: 'Y', 0x03A7: 'X',
+
+	// punctuation
+	0x201C: '"', 0x201D: '"', 0x201E: '"', 0x2033: '"', 0x2018: '\'', 0x2019: '\'',
+	0x201A: '\'', 0x2032: '\'', 0x2010: '-', 0x2013: '-', 0x2014: '-', 0x2212: '-',
+	0x00D7: '*', 0x2217: '*', 0x00F7: '/', 0x2044: '/', 0x2039: '<', 0x203A: '>',
+	0x037E: ';', // greek question mark
+
+	// whitespace
+	0x00A0: ' ', 0x2002: ' ', 0x2003: ' ', 0x2009: ' ', 0x3000: ' ',
+}
+
+// confusableWith returns the ASCII character that ch is easily mistaken for.
+func confusableWith(ch rune) (rune, bool) {
+	if 0xFF01 <= ch && ch <= 0xFF5E {
+		return ch - 0xFEE0, true // eg. fullwidth "ａ"
+	}
+	ascii, ok := confusables[ch]
+	return ascii, ok
+}
+
+// checkConfusable reports the first confusable character in an identifier
+// which is either mixed with ASCII letters (eg. "pаypal", with a cyrillic
+// "а") or which contains only confusables (eg. "рое" in cyrillic).
+func (s *Scanner) checkConfusable(offset int, ident []byte) {
+	hasASCII, allConfusable := false, true
+	firstOffset := -1
+	var skeleton bytes.Buffer
+	for i, ch := range string(ident) {
+		if ascii, ok := confusableWith(ch); ok {
+			if firstOffset < 0 {
+				firstOffset = i
+			}
+			skeleton.WriteRune(ascii)
+			continue
+		}
+
+		skeleton.WriteRune(ch)
+		if isLetter(ch) {
+			hasASCII = true
+		} else if ch >= utf8.RuneSelf {
+			allConfusable = false
+		}
+	}
+
+	if firstOffset >= 0 && (hasASCII || allConfusable) {
+		ch, _ := utf8.DecodeRune(ident[firstOffset:])
+		ascii, _ := confusableWith(ch)
+		msg := fmt.Sprintf(`identifier "%s" contains %#U, which looks like '%c' (eg. "%s")`, ident, ch, ascii, skeleton.String())
+		s.error(offset+firstOffset, msg)
+	}
+}
+
+// unexpectedCharacter describes a character which can't begin a token.
+func unexpectedCharacter(ch rune) string {
+	if ascii, ok := confusableWith(ch); ok {
+		return fmt.Sprintf("unexpected character %#U, which looks like '%c'", ch, ascii)
+	} else if isIdentContinue(ch) {
+		return fmt.Sprintf("identifier cannot start with %#U", ch)
+	}
+	return fmt.Sprintf("unexpected character %#U", ch)
+}
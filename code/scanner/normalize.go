@@ -0,0 +1,104 @@
+package scanner
+
+import "sort"
+
+//go:generate sh -c "python3 normalize_tables.py | gofmt > normalize_tables.go"
+
+// The Hangul syllables are composed of a leading consonant, a vowel, and an
+// optional trailing consonant; they are decomposed (and composed) by their
+// position in the block of syllables, rather than by the tables.
+const (
+	hangulBase    = 0xAC00
+	hangulCount   = 11172
+	leadingBase   = 0x1100
+	leadingCount  = 19
+	vowelBase     = 0x1161
+	trailingBase  = 0x11A7
+	vowelCount    = 21
+	trailingCount = 28
+)
+
+// normalizeIdentifier returns an identifier in Unicode Normalization Form C,
+// so that identifiers which are canonically equivalent (eg. "é" as a single
+// character, or as "e" with a combining accent) have the same name.
+func normalizeIdentifier(ident []byte) string {
+	var runes []rune
+	for _, ch := range string(ident) {
+		runes = decompose(runes, ch)
+	}
+
+	// put each sequence of marks in canonical order
+	for i := 0; i < len(runes); i++ {
+		j := i
+		for j < len(runes) && combiningClass(runes[j]) != 0 {
+			j += 1
+		}
+		if j-i > 1 {
+			marks := runes[i:j]
+			sort.SliceStable(marks, func(a, b int) bool {
+				return combiningClass(marks[a]) < combiningClass(marks[b])
+			})
+		}
+		i = j
+	}
+
+	// compose each mark with the preceding letter, unless it is blocked by a
+	// mark between them with the same (or a greater) combining class
+	var composed []rune
+	starter := -1
+	for _, ch := range runes {
+		class := combiningClass(ch)
+		if starter >= 0 {
+			last := len(composed) - 1
+			if prev := combiningClass(composed[last]); last == starter || prev != 0 && prev < class {
+				if letter, ok := compose(composed[starter], ch); ok {
+					composed[starter] = letter
+					continue
+				}
+			}
+		}
+		if class == 0 {
+			starter = len(composed)
+		}
+		composed = append(composed, ch)
+	}
+	return string(composed)
+}
+
+// decompose appends the canonical decomposition of a character.
+func decompose(runes []rune, ch rune) []rune {
+	if syllable := ch - hangulBase; 0 <= syllable && syllable < hangulCount {
+		leading := leadingBase + syllable/(vowelCount*trailingCount)
+		vowel := vowelBase + syllable%(vowelCount*trailingCount)/trailingCount
+		runes = append(runes, leading, vowel)
+		if trailing := syllable % trailingCount; trailing != 0 {
+			runes = append(runes, trailingBase+trailing)
+		}
+		return runes
+	} else if equivalent, ok := singletons[ch]; ok {
+		return decompose(runes, equivalent)
+	} else if pair, ok := decompositions[ch]; ok {
+		return decompose(decompose(runes, pair[0]), pair[1])
+	}
+	return append(runes, ch)
+}
+
+// compose returns the primary composite of a pair of characters, if any.
+func compose(first, second rune) (rune, bool) {
+	leading, vowel := first-leadingBase, second-vowelBase
+	if 0 <= leading && leading < leadingCount && 0 <= vowel && vowel < vowelCount {
+		return hangulBase + (leading*vowelCount+vowel)*trailingCount, true
+	}
+	syllable, trailing := first-hangulBase, second-trailingBase
+	if 0 <= syllable && syllable < hangulCount && syllable%trailingCount == 0 && 0 < trailing && trailing < trailingCount {
+		return first + trailing, true
+	}
+	letter, ok := compositions[[2]rune{first, second}]
+	return letter, ok
+}
+
+// combiningClass returns the canonical combining class of a character, which
+// orders the marks after a letter; most characters have the class 0.
+func combiningClass(ch rune) uint8 {
+	return combiningClasses[ch]
+}
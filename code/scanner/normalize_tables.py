@@ -0,0 +1,86 @@
+#!/usr/bin/env python3
+# Generates normalize_tables.go from the Unicode database of Python's
+# unicodedata module; run it with "go generate" in the scanner package.
+#
+# The decompositions, composition pairs and combining classes are complete
+# for the database's version of Unicode, except for the Hangul syllables
+# which are decomposed (and composed) algorithmically by normalize.go.
+
+import sys
+import unicodedata
+
+HANGUL_FIRST, HANGUL_LAST = 0xAC00, 0xD7A3
+
+
+def canonical_decomposition(ch):
+    fields = unicodedata.decomposition(ch).split()
+    if not fields or fields[0].startswith("<"):
+        return None  # none, or a compatibility decomposition
+    return [int(field, 16) for field in fields]
+
+
+def main():
+    decompositions = {}
+    singletons = {}
+    compositions = {}
+    classes = {}
+
+    for code in range(sys.maxunicode + 1):
+        if HANGUL_FIRST <= code <= HANGUL_LAST:
+            continue
+        ch = chr(code)
+        combining = unicodedata.combining(ch)
+        if combining:
+            classes[code] = combining
+
+        decomposed = canonical_decomposition(ch)
+        if decomposed is None:
+            continue
+        if len(decomposed) == 1:
+            singletons[code] = decomposed[0]
+            continue
+
+        decompositions[code] = decomposed
+        # only primary composites are composed (ie. a character which is
+        # excluded from composition is its own decomposition in NFC)
+        if unicodedata.normalize("NFC", ch) == ch:
+            compositions[tuple(decomposed)] = code
+
+    out = sys.stdout
+    out.write("// Code generated by normalize_tables.py; DO NOT EDIT.\n\n")
+    out.write("package scanner\n\n")
+    out.write("// The tables for normalizeIdentifier are derived from the Unicode Character\n")
+    out.write("// Database (Unicode %s).\n\n" % unicodedata.unidata_version)
+
+    out.write("// decompositions are the canonical decompositions of a character into two\n")
+    out.write("// characters (eg. \"é\" is \"e\" and U+0301).\n")
+    out.write("var decompositions = map[rune][2]rune{\n")
+    for code, (a, b) in sorted(decompositions.items()):
+        out.write("\t0x%04X: {0x%04X, 0x%04X},\n" % (code, a, b))
+    out.write("}\n\n")
+
+    out.write("// singletons are the characters which are canonically equivalent to another\n")
+    out.write("// character (eg. the angstrom sign U+212B is \"Å\").\n")
+    out.write("var singletons = map[rune]rune{\n")
+    for code, equivalent in sorted(singletons.items()):
+        out.write("\t0x%04X: 0x%04X,\n" % (code, equivalent))
+    out.write("}\n\n")
+
+    out.write("// compositions are the pairs of characters which compose to a primary\n")
+    out.write("// composite; the characters which are excluded from composition (eg. U+0344)\n")
+    out.write("// are always decomposed.\n")
+    out.write("var compositions = map[[2]rune]rune{\n")
+    for (a, b), code in sorted(compositions.items()):
+        out.write("\t{0x%04X, 0x%04X}: 0x%04X,\n" % (a, b, code))
+    out.write("}\n\n")
+
+    out.write("// combiningClasses are the canonical combining classes of the characters\n")
+    out.write("// which have a non-zero class.\n")
+    out.write("var combiningClasses = map[rune]uint8{\n")
+    for code, combining in sorted(classes.items()):
+        out.write("\t0x%04X: %d,\n" % (code, combining))
+    out.write("}\n")
+
+
+if __name__ == "__main__":
+    main()
@@ -0,0 +1,32 @@
+package scanner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeIdentifier(t *testing.T) {
+	for ident, expected := range map[string]string{
+		"e\u0323\u0302":      "\u1EC7",
+		"e\u0302\u0323":      "\u1EC7",
+		"\u00E9\u0323":       "\u1EB9\u0301",
+		"x\u0301":            "x\u0301",
+		"\u212Bngstr\u00F6m": "\u00C5ngstr\u00F6m",
+		"a\u0308\u0301":      "\u00E4\u0301",
+		"A\u030A\u0301":      "\u01FA",
+		"o\u031B\u0301":      "\u1EDB",
+		"\u0430\u0306":       "\u04D1",
+		"a\u0344":            "\u00E4\u0301",
+		"\u1EC7":             "\u1EC7",
+		"\u1100\u1161\u11A8": "\uAC01",
+		"\uAC00\u11A8":       "\uAC01",
+		"\uAC01":             "\uAC01",
+		"\u0928\u093C":       "\u0929",
+		"\u0958":             "\u0915\u093C",
+		"\u0B47\u0B3E":       "\u0B4B",
+		"\U0001D15E":         "\U0001D157\U0001D165",
+	} {
+		assert.Equal(t, expected, normalizeIdentifier([]byte(ident)), ident)
+	}
+}
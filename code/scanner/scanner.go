@@ -2,7 +2,6 @@ package scanner
 
 import (
 	"fmt"
-	"unicode"
 	"unicode/utf8"
 
 	"github.com/kestred/philomath/code/token"
@@ -117,7 +116,7 @@ scanAgain:
 	case ch == '_':
 		lit = s.scanOperator()
 		tok = token.OPERATOR
-	case isLetter(ch):
+	case isIdentStart(ch):
 		lit = s.scanIdentifier()
 		tok = token.IDENT
 		if len(lit) > 1 {
@@ -151,15 +150,35 @@ scanAgain:
 				tok = token.INVALID
 			}
 			// TODO: Scan directive
+		case '$':
+			if isIdentStart(s.char) {
+				lit = s.scanIdentifier()
+				tok = token.POLYMORPH
+			} else {
+				s.error(pos, fmt.Sprintf("unexpected character %#U", ch))
+				tok = token.INVALID
+			}
 		case '"':
-			tok, lit = s.scanText()
+			if s.char == '"' && s.peekByte() == '"' {
+				tok, lit = s.scanMultilineText()
+			} else {
+				tok, lit = s.scanText()
+			}
+		case '`':
+			tok, lit = s.scanRawText()
+		case '\'':
+			tok, lit = s.scanChar()
 		case '.':
-			if isDigit(s.char) {
+			if s.char == '.' {
+				s.next()
+				tok = token.RANGE
+				lit = ".."
+			} else if isDigit(s.char) {
 				tok, lit = s.scanNumber(true)
 			} else {
 				tok = token.PERIOD
 			}
-		case '+', '*', '%':
+		case '+', '*', '%', '&', '|', '!':
 			tok = token.OPERATOR
 		case '/':
 			if s.char == '/' {
@@ -207,10 +226,35 @@ scanAgain:
 			}
 		case ';':
 			tok = token.SEMICOLON
+		case '?':
+			tok = token.QUESTION
 		case ',':
 			tok = token.COMMA
 		case '=':
-			tok = token.EQUALS
+			if s.char == '=' {
+				s.next()
+				tok = token.OPERATOR
+				lit = "=="
+			} else {
+				tok = token.EQUALS
+			}
+		case '<':
+			if s.char == '<' {
+				s.next()
+			} else if s.char == '=' {
+				s.next()
+				if s.char == '>' {
+					s.next()
+				}
+			}
+			tok = token.OPERATOR
+			lit = string(s.src[pos:s.offset])
+		case '>':
+			if s.char == '>' || s.char == '=' {
+				s.next()
+			}
+			tok = token.OPERATOR
+			lit = string(s.src[pos:s.offset])
 		case '(':
 			tok = token.LEFT_PAREN
 		case '[':
@@ -225,7 +269,7 @@ scanAgain:
 			tok = token.RIGHT_BRACE
 		default:
 			if isValid(ch) {
-				s.error(pos, fmt.Sprintf("unexpected character %#U", ch))
+				s.error(pos, unexpectedCharacter(ch))
 			} else if ch != bom { // next reports unexpected BOMs - don't repeat
 				s.error(pos, fmt.Sprintf("invalid character %#U", ch))
 			}
@@ -268,18 +312,22 @@ func (s *Scanner) SourceAt(start, end int) string {
 	return string(s.src[start : end+1])
 }
 
+// PosAt returns the position of an earlier offset in the source (eg. the
+// offset of a token returned by Scan).
+func (s *Scanner) PosAt(offset int) token.Position {
+	line := s.LineAt(offset)
+	column := 1 + utf8.RuneCount(s.src[line.Offset:offset])
+	return token.Position{
+		Name:   s.filename,
+		Offset: offset,
+		Line:   line.Line,
+		Column: column,
+	}
+}
+
 func (s *Scanner) error(offset int, msg string) {
 	if s.err != nil {
-		line := s.LineAt(offset)
-		column := 1 + utf8.RuneCount(s.src[line.Offset:offset])
-		pos := token.Position{
-			Name:   s.filename,
-			Offset: offset,
-			Line:   line.Line,
-			Column: column,
-		}
-
-		s.err(pos, msg)
+		s.err(s.PosAt(offset), msg)
 	}
 }
 
@@ -287,18 +335,9 @@ func (s *Scanner) next() {
 	if s.readOffset < len(s.src) {
 		s.offset = s.readOffset
 
-		wasCarriageReturn := false
-		if s.char == '\n' {
-			line := token.Line{s.line, s.lineOffset, string(s.src[s.lineOffset:s.offset])}
-			s.lines = append(s.lines, line)
-			s.line += 1
-			s.lineOffset = s.offset
-		} else if s.char == '\r' {
-			wasCarriageReturn = true
-			line := token.Line{s.line, s.lineOffset, string(s.src[s.lineOffset:s.offset])}
-			s.lines = append(s.lines, line)
-			s.line += 1
-			s.lineOffset = s.offset
+		// a "\r\n" line ending is a single newline
+		if s.char == '\n' || s.char == '\r' && s.src[s.offset] != '\n' {
+			s.newline()
 		}
 
 		r, width := rune(s.src[s.readOffset]), 1
@@ -316,19 +355,32 @@ func (s *Scanner) next() {
 		}
 		s.readOffset += width
 		s.char = r
-
-		if s.char == '\n' && wasCarriageReturn {
-			s.line -= 1
-		}
 	} else {
 		s.offset = len(s.src)
 		if s.char == '\n' || s.char == '\r' {
-			s.lineOffset = s.offset
+			s.newline()
 		}
 		s.char = -1 // eof
 	}
 }
 
+// newline records the line which ends at the current offset.
+func (s *Scanner) newline() {
+	line := token.Line{s.line, s.lineOffset, string(s.src[s.lineOffset:s.offset])}
+	s.lines = append(s.lines, line)
+	s.line += 1
+	s.lineOffset = s.offset
+}
+
+// peekByte returns the byte after the current character (eg. to distinguish
+// the decimal point in "0.5" from the range in "0..5"), or 0 at the end.
+func (s *Scanner) peekByte() byte {
+	if s.readOffset < len(s.src) {
+		return s.src[s.readOffset]
+	}
+	return 0
+}
+
 func (s *Scanner) skipWhitespace() {
 	for s.char == ' ' || s.char == '\t' || s.char == '\n' || s.char == '\r' {
 		s.next()
@@ -341,16 +393,32 @@ func (s *Scanner) scanOperator() string {
 		s.next()
 	}
 
+	// operator names are ASCII, so that an operator (eg. "_dot_") is written
+	// the same way wherever it is used
+	if s.char >= utf8.RuneSelf && isIdentContinue(s.char) {
+		s.error(s.offset, fmt.Sprintf(`operator name cannot contain %#U (eg. "_dot_")`, s.char))
+		for isIdentContinue(s.char) {
+			s.next()
+		}
+	}
+
 	return string(s.src[offset:s.offset])
 }
 
 func (s *Scanner) scanIdentifier() string {
 	offset := s.offset
-	for isLetter(s.char) || isDigit(s.char) || s.char == '_' {
+	ascii := true
+	for isIdentContinue(s.char) {
+		ascii = ascii && s.char < utf8.RuneSelf
 		s.next()
 	}
 
-	return string(s.src[offset:s.offset])
+	ident := s.src[offset:s.offset]
+	if ascii {
+		return string(ident)
+	}
+	s.checkConfusable(offset, ident)
+	return normalizeIdentifier(ident)
 }
 
 // scanComment eats a (line or block) comment.
@@ -398,12 +466,50 @@ func (s *Scanner) scanComment(block bool) bool {
 	return true
 }
 
-func (s *Scanner) scanMantissa() {
-	for isDigit(s.char) {
+// scanDigits scans the digits of a number and any '_' which separate them;
+// it returns the number of digits, and false if any digit is invalid in the
+// base (eg. "0b102") or any '_' is misplaced.
+func (s *Scanner) scanDigits(base int, afterPrefix bool) (int, bool) {
+	count := 0
+	valid := true
+	separable := afterPrefix
+	for {
+		if s.char == '_' {
+			offset := s.offset
+			for s.char == '_' {
+				s.next()
+			}
+			if !separable || s.offset-offset > 1 || !(digitVal(s.char) < maxDigit(base) || isTypeSuffixStart(s.char)) {
+				s.error(offset, "'_' must separate successive digits in number")
+				valid = false
+			}
+			separable = false
+			continue
+		}
+
+		d := digitVal(s.char)
+		if d >= maxDigit(base) {
+			return count, valid
+		} else if d >= base {
+			s.error(s.offset, fmt.Sprintf("invalid digit %q in %s literal", s.char, baseNames[base]))
+			valid = false
+		}
 		s.next()
+		count += 1
+		separable = true
 	}
 }
 
+var baseNames = map[int]string{2: "binary", 8: "octal", 10: "decimal", 16: "hexadecimal"}
+
+// maxDigit is the smallest digit value which isn't scanned as part of a number.
+func maxDigit(base int) int {
+	if base == 16 {
+		return 16
+	}
+	return 10 // so that "0b2" reports an invalid digit, rather than a missing space
+}
+
 func (s *Scanner) scanNumber(afterDecimal bool) (token.Token, string) {
 	tok := token.NUMBER
 	offset := s.offset
@@ -413,43 +519,81 @@ func (s *Scanner) scanNumber(afterDecimal bool) (token.Token, string) {
 		likeNumber = true
 	}
 
-	s.scanMantissa()
-	if s.char == '.' && !afterDecimal { // TODO: maybe an error?
+	if prefix := s.peekByte(); !afterDecimal && s.char == '0' && (prefix == 'x' || prefix == 'b') {
+		base := 16
+		if prefix == 'b' {
+			base = 2
+		}
 		likeNumber = true
 		s.next()
+		s.next()
 
-		decOffset := s.offset
-		s.scanMantissa()
-		if s.offset == decOffset {
-			s.error(offset, "missing digits after decimal point in number")
+		if count, valid := s.scanDigits(base, true); count == 0 {
+			s.error(offset, fmt.Sprintf(`missing digits after "%s" in number`, s.src[offset:offset+2]))
+			tok = token.INVALID
+		} else if !valid {
 			tok = token.INVALID
 		}
-	}
-	if s.char == 'e' {
-		likeNumber = true
-		s.next()
+	} else {
+		isFloat := afterDecimal
+		if _, valid := s.scanDigits(10, false); !valid {
+			tok = token.INVALID
+		}
+		if s.char == '.' && !afterDecimal && s.peekByte() != '.' { // TODO: maybe an error?
+			likeNumber = true
+			isFloat = true
+			s.next()
 
-		if s.char == '+' || s.char == '-' {
+			if count, valid := s.scanDigits(10, false); count == 0 {
+				s.error(offset, "missing digits after decimal point in number")
+				tok = token.INVALID
+			} else if !valid {
+				tok = token.INVALID
+			}
+		}
+		if s.char == 'e' {
+			likeNumber = true
+			isFloat = true
 			s.next()
+
+			if s.char == '+' || s.char == '-' {
+				s.next()
+			}
+			if count, valid := s.scanDigits(10, false); count == 0 {
+				s.error(offset, "missing digits after exponent in number")
+				tok = token.INVALID
+			} else if !valid {
+				tok = token.INVALID
+			}
 		}
-		expOffset := s.offset
-		s.scanMantissa()
-		if s.offset == expOffset {
-			s.error(offset, "missing digits after exponent in number")
-			tok = token.INVALID
+
+		// an integer with a leading zero is octal
+		if !isFloat && s.src[offset] == '0' {
+			for i, ch := range s.src[offset:s.offset] {
+				if ch == '8' || ch == '9' {
+					s.error(offset+i, fmt.Sprintf("invalid digit %q in octal literal", ch))
+					tok = token.INVALID
+					break
+				}
+			}
 		}
 	}
 
-	if isLetter(s.char) {
+	if isIdentStart(s.char) {
 		charOffset := s.offset
-		for isLetter(s.char) || s.char == '_' {
+		for isIdentContinue(s.char) {
 			s.next()
 		}
 
 		// check if it seems like a number (exponent, decimal point, etc)
 		// also, if it is a long number (say, longer than a year), guess it is a number
-		if likeNumber || (charOffset-offset > 4) {
-			name := string(s.src[charOffset:s.offset])
+		name := string(s.src[charOffset:s.offset])
+		if IsTypeSuffix(name) {
+			return tok, string(s.src[offset:s.offset])
+		} else if isTypeSuffixStart(rune(name[0])) && len(name) > 1 && isDigit(rune(name[1])) {
+			msg := fmt.Sprintf(`unknown type suffix "%s" in number (eg. "255u8")`, name)
+			s.error(charOffset, msg)
+		} else if likeNumber || (charOffset-offset > 4) {
 			msg := fmt.Sprintf(`missing space after number before "%s"`, name)
 			s.error(charOffset, msg)
 		} else {
@@ -461,6 +605,21 @@ func (s *Scanner) scanNumber(afterDecimal bool) (token.Token, string) {
 	return tok, string(s.src[offset:s.offset])
 }
 
+// IsTypeSuffix reports whether a name is the suffix of a number which has an
+// explicit type (eg. "u8" in "255u8").
+func IsTypeSuffix(name string) bool {
+	switch name {
+	case "i8", "i16", "i32", "i64", "u8", "u16", "u32", "u64", "f32", "f64":
+		return true
+	default:
+		return false
+	}
+}
+
+func isTypeSuffixStart(ch rune) bool {
+	return ch == 'i' || ch == 'u' || ch == 'f'
+}
+
 func digitVal(ch rune) int {
 	switch {
 	case '0' <= ch && ch <= '9':
@@ -473,87 +632,146 @@ func digitVal(ch rune) int {
 	return 16 // larger than any legal digit val
 }
 
-// scanEscape parses an escape sequence where rune is the accepted
-// escaped quote. In case of a syntax error, it stops at the offending
-// character (without consuming it) and returns false. Otherwise
-// it returns true.
-func (s *Scanner) scanEscape(quote rune) bool {
-	offset := s.offset
-
-	var n int
-	var base, max uint32
-	switch s.char {
-	case 'a', 'b', 'f', 'n', 'r', 't', 'v', '\\', quote:
-		s.next()
-		return true
-	case '0', '1', '2', '3', '4', '5', '6', '7':
-		n, base, max = 3, 8, 255
-	case 'x':
-		s.next()
-		n, base, max = 2, 16, 255
-	case 'u':
+// scanEscape scans an escape sequence (the backslash already consumed), and
+// returns the codepoint (or byte, for "\xNN") that it represents.  In case of
+// a syntax error, it stops at the offending character (without consuming it)
+// and returns false.  Otherwise it returns true.
+func (s *Scanner) scanEscape() (r rune, isByte bool, ok bool) {
+	r, isByte, end, err := decodeEscape(s.src, s.offset-1)
+	if err != nil {
+		s.error(err.Offset, err.Msg)
+		end = err.Offset
+	}
+	for s.offset < end && s.char >= 0 {
 		s.next()
-		n, base, max = 4, 16, unicode.MaxRune
-	case 'U':
+	}
+	return r, isByte, err == nil
+}
+
+func (s *Scanner) scanText() (token.Token, string) {
+	// opening quote already consumed
+	offset := s.offset - 1
+	tok := token.TEXT
+
+	for {
+		ch := s.char
+		if ch == '\n' || ch == '\r' || ch < 0 {
+			tok = token.INVALID
+			s.error(offset, "unterminated text literal")
+			break
+		} else if !isValid(ch) {
+			msg := fmt.Sprintf("invalid character in text literal: %#U", ch)
+			s.error(s.offset, msg)
+		}
 		s.next()
-		n, base, max = 8, 16, unicode.MaxRune
-	default:
-		msg := "unknown escape sequence"
-		if s.char < 0 {
-			msg = "unterminated escape sequence"
+
+		if ch == '"' {
+			break
+		}
+		if ch == '\\' {
+			s.scanEscape()
 		}
-		s.error(offset, msg)
-		return false
 	}
 
-	var x uint32
-	for n > 0 {
-		d := uint32(digitVal(s.char))
-		if d >= base {
-			msg := fmt.Sprintf("unexpected character in escape sequence: %#U", s.char)
-			if s.char < 0 {
-				msg = "unterminated escape sequence"
-			}
+	return tok, string(s.src[offset:s.offset])
+}
+
+// scanRawText scans text which may contain newlines, but not escapes.
+func (s *Scanner) scanRawText() (token.Token, string) {
+	// opening quote already consumed
+	offset := s.offset - 1
+
+	for {
+		ch := s.char
+		if ch < 0 {
+			s.error(offset, "unterminated raw text literal")
+			return token.INVALID, string(s.src[offset:s.offset])
+		} else if !isValid(ch) {
+			msg := fmt.Sprintf("invalid character in text literal: %#U", ch)
 			s.error(s.offset, msg)
-			return false
 		}
-		x = x*base + d
 		s.next()
-		n--
+
+		if ch == '`' {
+			break
+		}
 	}
 
-	if x > max || 0xD800 <= x && x < 0xE000 {
-		s.error(offset, "escape sequence is invalid Unicode code point")
-		return false
+	return token.TEXT, string(s.src[offset:s.offset])
+}
+
+// scanMultilineText scans text which starts and ends with triple quotes, and
+// reports any lines which are indented less than the closing quotes.
+func (s *Scanner) scanMultilineText() (token.Token, string) {
+	// opening quote already consumed
+	offset := s.offset - 1
+	s.next()
+	s.next()
+
+	for {
+		ch := s.char
+		if ch < 0 {
+			s.error(offset, "unterminated multi-line text literal")
+			return token.INVALID, string(s.src[offset:s.offset])
+		} else if !isValid(ch) {
+			msg := fmt.Sprintf("invalid character in text literal: %#U", ch)
+			s.error(s.offset, msg)
+		}
+		s.next()
+
+		if ch == '"' && s.char == '"' && s.peekByte() == '"' {
+			s.next()
+			s.next()
+			break
+		}
+		if ch == '\\' {
+			s.scanEscape()
+		}
 	}
 
-	return true
+	lit := s.src[offset:s.offset]
+	if _, err := multilineSpans(lit); err != nil {
+		s.error(offset+err.Offset, err.Msg)
+	}
+	return token.TEXT, string(lit)
 }
 
-func (s *Scanner) scanText() (token.Token, string) {
+func (s *Scanner) scanChar() (token.Token, string) {
 	// opening quote already consumed
 	offset := s.offset - 1
-	tok := token.TEXT
+	tok := token.CHAR
 
+	count := 0
 	for {
 		ch := s.char
 		if ch == '\n' || ch == '\r' || ch < 0 {
 			tok = token.INVALID
-			s.error(offset, "unterminated text literal")
-			break
+			s.error(offset, "unterminated char literal")
+			return tok, string(s.src[offset:s.offset])
 		} else if !isValid(ch) {
-			msg := fmt.Sprintf("invalid character in text literal: %#U", ch)
+			msg := fmt.Sprintf("invalid character in char literal: %#U", ch)
 			s.error(s.offset, msg)
 		}
 		s.next()
 
-		if ch == '"' {
+		if ch == '\'' {
 			break
 		}
+		count += 1
 		if ch == '\\' {
-			s.scanEscape('"')
+			escOffset := s.offset - 1
+			if r, isByte, ok := s.scanEscape(); ok && isByte && r >= utf8.RuneSelf {
+				s.error(escOffset, errByteInChar)
+			}
 		}
 	}
 
+	if count == 0 {
+		tok = token.INVALID
+		s.error(offset, "empty char literal")
+	} else if count > 1 {
+		tok = token.INVALID
+		s.error(offset, "char literal must contain exactly one character")
+	}
 	return tok, string(s.src[offset:s.offset])
 }
@@ -227,6 +227,50 @@ func TestScansIdentifier(t *testing.T) {
 	}
 }
 
+func TestScansUnicodeIdentifiers(t *testing.T) {
+	for src, expected := range map[string]string{
+		"φ":                  "φ",
+		"Δt":                 "Δt",
+		"größe_2":            "größe_2",
+		"строка":             "строка",
+		"変数":                 "変数",
+		"x\u0301":            "x\u0301",
+		"cafe\u0301":         "caf\u00E9",          // normalized to NFC
+		"\u212Bngstr\u00F6m": "\u00C5ngstr\u00F6m", // the angstrom sign is normalized to "Å"
+	} {
+		scan, err := scanOnce(src)
+		assert.Nil(t, err, src)
+		assert.Equal(t, token.IDENT, scan.tok, src)
+		assert.Equal(t, expected, scan.lit, src)
+	}
+
+	scan, err := scanOnce(`$φ`)
+	assert.Nil(t, err)
+	assert.Equal(t, token.POLYMORPH, scan.tok)
+	assert.Equal(t, `φ`, scan.lit)
+}
+
+func TestReportsUsefulIdentifierErrors(t *testing.T) {
+	for src, expected := range map[string]struct {
+		offset int
+		msg    string
+	}{
+		"p\u0430ypal":        {1, "identifier \"p\u0430ypal\" contains U+0430 '\u0430', which looks like 'a' (eg. \"paypal\")"},
+		"\u0440\u043E\u0435": {0, "identifier \"\u0440\u043E\u0435\" contains U+0440 '\u0440', which looks like 'p' (eg. \"poe\")"},
+		"ｘ":                  {0, "identifier \"ｘ\" contains U+FF58 'ｘ', which looks like 'x' (eg. \"x\")"},
+		"“text”":             {0, "unexpected character U+201C '“', which looks like '\"'"},
+		"\u00A0":             {0, "unexpected character U+00A0, which looks like ' '"},
+		"\u0301x":            {0, "identifier cannot start with U+0301 '\u0301'"},
+		"_doté_":             {4, "operator name cannot contain U+00E9 'é' (eg. \"_dot_\")"},
+	} {
+		_, err := scanOnce(src)
+		if assert.NotNil(t, err, src) {
+			assert.Equal(t, expected.offset, err.pos.Offset, src)
+			assert.Equal(t, expected.msg, err.msg, src)
+		}
+	}
+}
+
 func TestScansDirective(t *testing.T) {
 	// ignore a shebang line
 	scan, err := scanOnce("#!/usr/bin/phi run\n   3    ")
@@ -241,6 +285,19 @@ func TestScansDirective(t *testing.T) {
 	assert.Equal(t, `asm`, scan.lit)
 }
 
+func TestScansTypeParameter(t *testing.T) {
+	scan, err := scanOnce("$T")
+	assert.Nil(t, err)
+	assert.Equal(t, token.POLYMORPH, scan.tok)
+	assert.Equal(t, 0, scan.pos)
+	assert.Equal(t, `T`, scan.lit)
+
+	_, err = scanOnce("$ T")
+	if assert.NotNil(t, err) {
+		assert.Equal(t, `unexpected character U+0024 '$'`, err.msg)
+	}
+}
+
 func TestScansStrings(t *testing.T) {
 	scan, err := scanOnce(`"simple"`)
 	assert.Nil(t, err)
@@ -271,6 +328,11 @@ func TestScansStrings(t *testing.T) {
 	assert.Equal(t, token.TEXT, scan.tok)
 	assert.Equal(t, 0, scan.pos)
 	assert.Equal(t, `"slashes \\ //"`, scan.lit)
+
+	scan, err = scanOnce(`"codes \0\x7F\u{E9}\u{1F600}\'"`)
+	assert.Nil(t, err)
+	assert.Equal(t, token.TEXT, scan.tok)
+	assert.Equal(t, `"codes \0\x7F\u{E9}\u{1F600}\'"`, scan.lit)
 }
 
 func TestReportsUsefulStringErrors(t *testing.T) {
@@ -422,6 +484,118 @@ func TestReportsUsefulStringErrors(t *testing.T) {
 		assert.Equal(t, 8, err.pos.Column)
 		assert.Equal(t, `unexpected character in escape sequence: U+0058 'X'`, err.msg)
 	}
+
+	scan, err = scanOnce(`"bad \u{1 esc"`)
+	assert.Equal(t, token.TEXT, scan.tok) // error is recoverable
+	if assert.NotNil(t, err) {
+		assert.Equal(t, 9, err.pos.Offset)
+		assert.Equal(t, 1, err.pos.Line)
+		assert.Equal(t, 10, err.pos.Column)
+		assert.Equal(t, `unexpected character in escape sequence: U+0020 ' '`, err.msg)
+	}
+
+	scan, err = scanOnce(`"bad \u{0XX1} esc"`)
+	assert.Equal(t, token.TEXT, scan.tok) // error is recoverable
+	if assert.NotNil(t, err) {
+		assert.Equal(t, 9, err.pos.Offset)
+		assert.Equal(t, 1, err.pos.Line)
+		assert.Equal(t, 10, err.pos.Column)
+		assert.Equal(t, `unexpected character in escape sequence: U+0058 'X'`, err.msg)
+	}
+
+	scan, err = scanOnce(`"bad \u{XXXX} esc"`)
+	assert.Equal(t, token.TEXT, scan.tok) // error is recoverable
+	if assert.NotNil(t, err) {
+		assert.Equal(t, 8, err.pos.Offset)
+		assert.Equal(t, 1, err.pos.Line)
+		assert.Equal(t, 9, err.pos.Column)
+		assert.Equal(t, `unexpected character in escape sequence: U+0058 'X'`, err.msg)
+	}
+
+	scan, err = scanOnce(`"bad \u{FXXX} esc"`)
+	assert.Equal(t, token.TEXT, scan.tok) // error is recoverable
+	if assert.NotNil(t, err) {
+		assert.Equal(t, 9, err.pos.Offset)
+		assert.Equal(t, 1, err.pos.Line)
+		assert.Equal(t, 10, err.pos.Column)
+		assert.Equal(t, `unexpected character in escape sequence: U+0058 'X'`, err.msg)
+	}
+
+	scan, err = scanOnce(`"bad \u{XXXF} esc"`)
+	assert.Equal(t, token.TEXT, scan.tok) // error is recoverable
+	if assert.NotNil(t, err) {
+		assert.Equal(t, 8, err.pos.Offset)
+		assert.Equal(t, 1, err.pos.Line)
+		assert.Equal(t, 9, err.pos.Column)
+		assert.Equal(t, `unexpected character in escape sequence: U+0058 'X'`, err.msg)
+	}
+
+	scan, err = scanOnce(`"bad \u{} esc"`)
+	assert.Equal(t, token.TEXT, scan.tok) // error is recoverable
+	if assert.NotNil(t, err) {
+		assert.Equal(t, 8, err.pos.Offset)
+		assert.Equal(t, `missing digits in escape sequence`, err.msg)
+	}
+
+	scan, err = scanOnce(`"bad \u{1234567} esc"`)
+	assert.Equal(t, token.TEXT, scan.tok) // error is recoverable
+	if assert.NotNil(t, err) {
+		assert.Equal(t, 14, err.pos.Offset)
+		assert.Equal(t, `unexpected character in escape sequence: U+0037 '7'`, err.msg)
+	}
+
+	scan, err = scanOnce(`"bad \u{110000} esc"`)
+	assert.Equal(t, token.TEXT, scan.tok) // error is recoverable
+	if assert.NotNil(t, err) {
+		assert.Equal(t, 6, err.pos.Offset)
+		assert.Equal(t, `escape sequence is invalid Unicode code point`, err.msg)
+	}
+
+	scan, err = scanOnce(`"bad \x4 esc"`)
+	assert.Equal(t, token.TEXT, scan.tok) // error is recoverable
+	if assert.NotNil(t, err) {
+		assert.Equal(t, 8, err.pos.Offset)
+		assert.Equal(t, `unexpected character in escape sequence: U+0020 ' '`, err.msg)
+	}
+}
+
+func TestScansChars(t *testing.T) {
+	for _, lit := range []string{`'a'`, `'\n'`, `'\''`, `'"'`, `'\0'`, `'\x7F'`, `'\u{1F600}'`, `'é'`} {
+		scan, err := scanOnce(lit)
+		assert.Nil(t, err)
+		assert.Equal(t, token.CHAR, scan.tok)
+		assert.Equal(t, lit, scan.lit)
+	}
+}
+
+func TestReportsUsefulCharErrors(t *testing.T) {
+	scan, err := scanOnce(`''`)
+	assert.Equal(t, token.INVALID, scan.tok)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, 0, err.pos.Offset)
+		assert.Equal(t, `empty char literal`, err.msg)
+	}
+
+	scan, err = scanOnce(`'ab'`)
+	assert.Equal(t, token.INVALID, scan.tok)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, 0, err.pos.Offset)
+		assert.Equal(t, `char literal must contain exactly one character`, err.msg)
+	}
+
+	scan, err = scanOnce(`'a`)
+	assert.Equal(t, token.INVALID, scan.tok)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, 0, err.pos.Offset)
+		assert.Equal(t, `unterminated char literal`, err.msg)
+	}
+
+	scan, err = scanOnce(`'\xFF'`)
+	assert.Equal(t, token.CHAR, scan.tok) // error is recoverable
+	if assert.NotNil(t, err) {
+		assert.Equal(t, 1, err.pos.Offset)
+		assert.Equal(t, `a "\x" escape in a char literal must be at most "\x7F" (eg. use "\u{FF}")`, err.msg)
+	}
 }
 
 func TestScansNumbers(t *testing.T) {
@@ -508,6 +682,14 @@ func TestScansNumbers(t *testing.T) {
 	assert.Equal(t, token.NUMBER, scan.tok)
 	assert.Equal(t, 0, scan.pos)
 	assert.Equal(t, ".123e4567", scan.lit)
+
+	for _, lit := range []string{"0b1010", "0xFF", "0x_FF", "0xDEAD_beef", "1_000_000", "0b1111_0000", "3.141_592e1_0",
+		"255u8", "0xFFu8", "0b1i64", "1f32", "2.5f64", "1_000u16"} {
+		scan, err = scanOnce(lit)
+		assert.Nil(t, err, lit)
+		assert.Equal(t, token.NUMBER, scan.tok, lit)
+		assert.Equal(t, lit, scan.lit)
+	}
 }
 
 func TestReportsUsefulNumberErrors(t *testing.T) {
@@ -560,6 +742,28 @@ func TestReportsUsefulNumberErrors(t *testing.T) {
 			assert.Equal(t, `missing digits after exponent in number`, err.msg)
 		}
 	}
+
+	for lit, expected := range map[string]struct {
+		offset int
+		msg    string
+	}{
+		"0x":     {0, `missing digits after "0x" in number`},
+		"0b":     {0, `missing digits after "0b" in number`},
+		"0b102":  {4, `invalid digit '2' in binary literal`},
+		"0789":   {2, `invalid digit '8' in octal literal`},
+		"1__000": {1, `'_' must separate successive digits in number`},
+		"1000_":  {4, `'_' must separate successive digits in number`},
+		"1.0_":   {3, `'_' must separate successive digits in number`},
+		"255u7":  {3, `unknown type suffix "u7" in number (eg. "255u8")`},
+		"1.5abc": {3, `missing space after number before "abc"`},
+	} {
+		scan, err := scanOnce(lit)
+		assert.Equal(t, token.INVALID, scan.tok, lit)
+		if assert.NotNil(t, err, lit) {
+			assert.Equal(t, expected.offset, err.pos.Offset, lit)
+			assert.Equal(t, expected.msg, err.msg, lit)
+		}
+	}
 }
 
 func TestScansOperators(t *testing.T) {
@@ -605,6 +809,42 @@ func TestScansOperators(t *testing.T) {
 	assert.Equal(t, 0, scan.pos)
 	assert.Equal(t, "-", scan.lit)
 
+	scan, err = scanOnce("==")
+	assert.Nil(t, err)
+	assert.Equal(t, token.OPERATOR, scan.tok)
+	assert.Equal(t, 0, scan.pos)
+	assert.Equal(t, "==", scan.lit)
+
+	scan, err = scanOnce("<")
+	assert.Nil(t, err)
+	assert.Equal(t, token.OPERATOR, scan.tok)
+	assert.Equal(t, 0, scan.pos)
+	assert.Equal(t, "<", scan.lit)
+
+	scan, err = scanOnce("<=")
+	assert.Nil(t, err)
+	assert.Equal(t, token.OPERATOR, scan.tok)
+	assert.Equal(t, 0, scan.pos)
+	assert.Equal(t, "<=", scan.lit)
+
+	scan, err = scanOnce("<=>")
+	assert.Nil(t, err)
+	assert.Equal(t, token.OPERATOR, scan.tok)
+	assert.Equal(t, 0, scan.pos)
+	assert.Equal(t, "<=>", scan.lit)
+
+	scan, err = scanOnce(">")
+	assert.Nil(t, err)
+	assert.Equal(t, token.OPERATOR, scan.tok)
+	assert.Equal(t, 0, scan.pos)
+	assert.Equal(t, ">", scan.lit)
+
+	scan, err = scanOnce(">=")
+	assert.Nil(t, err)
+	assert.Equal(t, token.OPERATOR, scan.tok)
+	assert.Equal(t, 0, scan.pos)
+	assert.Equal(t, ">=", scan.lit)
+
 	scan, err = scanOnce(".")
 	assert.Nil(t, err)
 	assert.Equal(t, token.PERIOD, scan.tok)
@@ -644,6 +884,49 @@ func TestScansOperators(t *testing.T) {
 	assert.Equal(t, 0, scan.pos)
 	assert.Equal(t, ",", scan.lit)
 
+	scan, err = scanOnce("%")
+	assert.Nil(t, err)
+	assert.Equal(t, token.OPERATOR, scan.tok)
+	assert.Equal(t, 0, scan.pos)
+	assert.Equal(t, "%", scan.lit)
+
+	scan, err = scanOnce("&")
+	assert.Nil(t, err)
+	assert.Equal(t, token.OPERATOR, scan.tok)
+	assert.Equal(t, 0, scan.pos)
+	assert.Equal(t, "&", scan.lit)
+
+	scan, err = scanOnce("|")
+	assert.Nil(t, err)
+	assert.Equal(t, token.OPERATOR, scan.tok)
+	assert.Equal(t, 0, scan.pos)
+	assert.Equal(t, "|", scan.lit)
+
+	scan, err = scanOnce("!")
+	assert.Nil(t, err)
+	assert.Equal(t, token.OPERATOR, scan.tok)
+	assert.Equal(t, 0, scan.pos)
+	assert.Equal(t, "!", scan.lit)
+
+	scan, err = scanOnce("<<")
+	assert.Nil(t, err)
+	assert.Equal(t, token.OPERATOR, scan.tok)
+	assert.Equal(t, 0, scan.pos)
+	assert.Equal(t, "<<", scan.lit)
+
+	scan, err = scanOnce(">>")
+	assert.Nil(t, err)
+	assert.Equal(t, token.OPERATOR, scan.tok)
+	assert.Equal(t, 0, scan.pos)
+	assert.Equal(t, ">>", scan.lit)
+
+	// a compound shift is still followed by '='
+	scan, err = scanOnce("<<=")
+	assert.Nil(t, err)
+	assert.Equal(t, token.OPERATOR, scan.tok)
+	assert.Equal(t, 0, scan.pos)
+	assert.Equal(t, "<<", scan.lit)
+
 	scan, err = scanOnce("=")
 	assert.Nil(t, err)
 	assert.Equal(t, token.EQUALS, scan.tok)
@@ -655,6 +938,25 @@ func TestScansOperators(t *testing.T) {
 	assert.Equal(t, token.ARROW, scan.tok)
 	assert.Equal(t, 0, scan.pos)
 	assert.Equal(t, "->", scan.lit)
+
+	scan, err = scanOnce("..")
+	assert.Nil(t, err)
+	assert.Equal(t, token.RANGE, scan.tok)
+	assert.Equal(t, 0, scan.pos)
+	assert.Equal(t, "..", scan.lit)
+
+	scan, err = scanOnce("?")
+	assert.Nil(t, err)
+	assert.Equal(t, token.QUESTION, scan.tok)
+	assert.Equal(t, 0, scan.pos)
+	assert.Equal(t, "?", scan.lit)
+
+	// a range isn't mistaken for a decimal point
+	scan, err = scanOnce("0..10")
+	assert.Nil(t, err)
+	assert.Equal(t, token.NUMBER, scan.tok)
+	assert.Equal(t, 0, scan.pos)
+	assert.Equal(t, "0", scan.lit)
 }
 
 func TestScansDelimiters(t *testing.T) {
@@ -786,3 +1088,106 @@ func TestScanPos(t *testing.T) {
 	assert.Equal(t, token.Position{"main", 24, 3, 2}, s.Pos())
 	assert.Nil(t, err)
 }
+
+func TestScansMultilineText(t *testing.T) {
+	scan, err := scanOnce("`raw \\n text`")
+	assert.Nil(t, err)
+	assert.Equal(t, token.TEXT, scan.tok)
+	assert.Equal(t, "`raw \\n text`", scan.lit)
+
+	scan, err = scanOnce("\"\"\"\n    one\n      \"two\"\n    \"\"\"")
+	assert.Nil(t, err)
+	assert.Equal(t, token.TEXT, scan.tok)
+	assert.Equal(t, "\"\"\"\n    one\n      \"two\"\n    \"\"\"", scan.lit)
+
+	// an empty text literal isn't mistaken for the start of multi-line text
+	scan, err = scanOnce(`"" ""`)
+	assert.Nil(t, err)
+	assert.Equal(t, `""`, scan.lit)
+}
+
+func TestReportsUsefulMultilineTextErrors(t *testing.T) {
+	scan, err := scanOnce("`no end\nquote")
+	assert.Equal(t, token.INVALID, scan.tok)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, 0, err.pos.Offset)
+		assert.Equal(t, `unterminated raw text literal`, err.msg)
+	}
+
+	scan, err = scanOnce("\"\"\"\n  no end quote\n")
+	assert.Equal(t, token.INVALID, scan.tok)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, 0, err.pos.Offset)
+		assert.Equal(t, `unterminated multi-line text literal`, err.msg)
+	}
+
+	scan, err = scanOnce("\"\"\"same line\n  \"\"\"")
+	assert.Equal(t, token.TEXT, scan.tok) // error is recoverable
+	if assert.NotNil(t, err) {
+		assert.Equal(t, 3, err.pos.Offset)
+		assert.Equal(t, `multi-line text must start on a new line after the opening """`, err.msg)
+	}
+
+	scan, err = scanOnce("\"\"\"\n  text\n  end\"\"\"")
+	assert.Equal(t, token.TEXT, scan.tok) // error is recoverable
+	if assert.NotNil(t, err) {
+		assert.Equal(t, 16, err.pos.Offset)
+		assert.Equal(t, 3, err.pos.Line)
+		assert.Equal(t, 6, err.pos.Column)
+		assert.Equal(t, `the closing """ of multi-line text must be on its own line`, err.msg)
+	}
+
+	scan, err = scanOnce("\"\"\"\n    indented\n  not indented\n    \"\"\"")
+	assert.Equal(t, token.TEXT, scan.tok) // error is recoverable
+	if assert.NotNil(t, err) {
+		assert.Equal(t, 17, err.pos.Offset)
+		assert.Equal(t, 3, err.pos.Line)
+		assert.Equal(t, 1, err.pos.Column)
+		assert.Equal(t, `each line of multi-line text must be indented at least as much as the closing """`, err.msg)
+	}
+}
+
+func TestScanPosAfterMultilineText(t *testing.T) {
+	s := Scanner{}
+	s.Init("main", []byte("x := `a\nb`;\ny := \"\"\"\r\n  c\r\n  \"\"\"; z"), nil)
+	var toks []token.Token
+	var positions []token.Position
+	for {
+		pos, tok, _ := s.Scan()
+		if tok == token.END {
+			break
+		}
+		toks = append(toks, tok)
+		positions = append(positions, s.PosAt(pos))
+	}
+
+	assert.Equal(t, []token.Token{
+		token.IDENT, token.COLON, token.EQUALS, token.TEXT, token.SEMICOLON,
+		token.IDENT, token.COLON, token.EQUALS, token.TEXT, token.SEMICOLON,
+		token.IDENT,
+	}, toks)
+	assert.Equal(t, token.Position{"main", 5, 1, 6}, positions[3])
+	assert.Equal(t, token.Position{"main", 10, 2, 3}, positions[4])
+	assert.Equal(t, token.Position{"main", 12, 3, 1}, positions[5])
+	assert.Equal(t, token.Position{"main", 32, 5, 6}, positions[9])
+	assert.Equal(t, token.Position{"main", 34, 5, 8}, positions[10])
+	assert.Equal(t, token.Position{"main", 35, 5, 9}, s.Pos())
+}
+
+func TestScanPosAfterNewlines(t *testing.T) {
+	s := Scanner{}
+	s.Init("main", []byte("a\r\nb\rc\n"), nil)
+	s.Scan()
+	_, _, lit := s.Scan()
+	assert.Equal(t, "b", lit)
+	assert.Equal(t, token.Position{"main", 3, 2, 1}, s.PosAt(3))
+	assert.Equal(t, token.Position{"main", 2, 1, 3}, s.PosAt(2)) // the newline ends the line
+
+	_, _, lit = s.Scan()
+	assert.Equal(t, "c", lit)
+	assert.Equal(t, token.Position{"main", 5, 3, 1}, s.PosAt(5))
+
+	_, tok, _ := s.Scan()
+	assert.Equal(t, token.END, tok)
+	assert.Equal(t, token.Position{"main", 7, 4, 1}, s.Pos())
+}
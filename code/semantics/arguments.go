@@ -0,0 +1,138 @@
+package semantics
+
+import "github.com/kestred/philomath/code/ast"
+
+// bindArguments matches the arguments of a call to the parameters of the
+// procedure being called; positional arguments come first, followed by any
+// named arguments, and an omitted parameter is bound to its default value.
+//
+// A variadic parameter is bound to the array of its arguments (a VariadicExpr),
+// unless an existing array is spread into it (eg. "f(..args)").
+func bindArguments(call *ast.CallExpr, proc *ast.ProcedureExpr) ([]ast.Expr, []error) {
+	var errs []error
+	var named bool
+	var rest []ast.Expr
+	variadic := variadicIndex(proc)
+	bound := make([]ast.Expr, len(proc.Params))
+	for i, arg := range call.Arguments {
+		index := i
+		if call.Names != nil && call.Names[i] != nil {
+			named = true
+			name := call.Names[i]
+			if index = paramIndex(proc, name.Literal); index < 0 {
+				errs = append(errs, errorAt(name, `The procedure has no parameter named "%s"`, name.Literal))
+				continue
+			} else if index == variadic {
+				errs = append(errs, errorAt(name, `The variadic parameter "%s" can't be given a named argument`, name.Literal))
+				continue
+			}
+		} else if named {
+			errs = append(errs, errorAt(arg, "A positional argument can't follow a named argument"))
+			continue
+		} else if call.Spread && i == len(call.Arguments)-1 {
+			if variadic < 0 {
+				errs = append(errs, errorAt(arg, "Only the argument for a variadic parameter can be spread"))
+			} else if index != variadic {
+				errs = append(errs, errorAt(arg, `The spread argument must be the only argument for the variadic parameter "%s"`,
+					proc.Params[variadic].Name.Literal))
+			} else {
+				bound[index] = arg
+			}
+			continue
+		} else if variadic >= 0 && index >= variadic {
+			rest = append(rest, arg)
+			continue
+		} else if index >= len(proc.Params) {
+			errs = append(errs, errorAt(arg, "Too many arguments; the procedure has %d parameter(s)", len(proc.Params)))
+			continue
+		}
+
+		if bound[index] != nil {
+			errs = append(errs, errorAt(arg, `The parameter "%s" was given more than one argument`, proc.Params[index].Name.Literal))
+			continue
+		}
+		bound[index] = arg
+	}
+
+	if variadic >= 0 && bound[variadic] == nil {
+		bound[variadic] = &ast.VariadicExpr{Elements: rest, Type: proc.Params[variadic].Type}
+	}
+	for i, param := range proc.Params {
+		if bound[i] != nil {
+			continue
+		} else if param.Expr != nil {
+			bound[i] = param.Expr
+		} else {
+			errs = append(errs, errorAt(call, `Missing an argument for the parameter "%s"`, param.Name.Literal))
+		}
+	}
+	return bound, errs
+}
+
+// bindValueArguments binds the arguments of a call through a variadic procedure
+// value (eg. a parameter "f: (text, ..int) -> ()"); it returns nil if the
+// procedure isn't variadic, or if there aren't enough arguments.
+func bindValueArguments(call *ast.CallExpr, typ *ast.ProcedureType) []ast.Expr {
+	fixed := len(typ.Params) - 1
+	if !typ.Variadic || len(call.Arguments) < fixed {
+		return nil
+	}
+
+	bound := append([]ast.Expr{}, call.Arguments[:fixed]...)
+	rest := call.Arguments[fixed:]
+	if call.Spread && len(rest) == 1 {
+		return append(bound, rest[0])
+	}
+	return append(bound, &ast.VariadicExpr{Elements: rest, Type: typ.Params[fixed]})
+}
+
+// variadicIndex returns the index of the variadic parameter of a procedure, or
+// -1 if the procedure isn't variadic.
+func variadicIndex(proc *ast.ProcedureExpr) int {
+	if n := len(proc.Params); n > 0 && proc.Params[n-1].Variadic {
+		return n - 1
+	}
+	return -1
+}
+
+// checkVariadic checks the types of the arguments bound to a variadic
+// parameter, which are either elements of the array or a spread array.
+func checkVariadic(arg ast.Expr, typ *ast.ArrayType) []error {
+	var errs []error
+	if variadic, ok := arg.(*ast.VariadicExpr); ok {
+		for _, element := range variadic.Elements {
+			found := element.GetType()
+			if !isError(found) && !sameType(found, typ.Element) && !canCastImplicitly(found, typ.Element) {
+				errs = append(errs, errorAt(element, "A value of type %s can't be used as %s", found.Print(), typ.Element.Print()))
+			}
+		}
+	} else if found := arg.GetType(); !isError(found) && !sameType(found, typ) {
+		errs = append(errs, errorAt(arg, "A value of type %s can't be spread as %s", found.Print(), typ.Print()))
+	}
+	return errs
+}
+
+func paramIndex(proc *ast.ProcedureExpr, name string) int {
+	for i, param := range proc.Params {
+		if param.Name.Literal == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// checkDefault reports uses of other parameters in a parameter's default
+// value, because defaults are evaluated by the caller, and checks that the
+// default can be used as the parameter's type.
+func checkDefault(param *ast.MutableDecl, proc *ast.ProcedureExpr) []error {
+	var errs []error
+	for _, node := range flattenTree(param.Expr, param) {
+		if ident, ok := node.(*ast.Identifier); ok {
+			if decl, ok := ident.Decl.(*ast.MutableDecl); ok && decl.Parent == proc {
+				errs = append(errs, errorAt(ident, `The default value of "%s" can't use the parameter "%s"`,
+					param.Name.Literal, ident.Literal))
+			}
+		}
+	}
+	return append(errs, checkValues(param, []ast.Type{param.Type}, param.Expr, "default value")...)
+}
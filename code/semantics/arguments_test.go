@@ -0,0 +1,131 @@
+package semantics
+
+import (
+	"testing"
+
+	"github.com/kestred/philomath/code/ast"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBindArguments(t *testing.T) {
+	node, errs := checkAny(t, `{
+		print :: (message: text, length: int = 1, stream: int = 2) {}
+		print("a");
+		print("a", 3);
+		print(stream = 4, message = "a");
+	}`)
+	assert.Empty(t, errs)
+
+	block := node.(*ast.Block)
+	proc := block.Nodes[0].(*ast.ImmutableDecl).Defn.(*ast.ConstantDefn).Expr.(*ast.ProcedureExpr)
+	defaults := []ast.Expr{proc.Params[1].Expr, proc.Params[2].Expr}
+
+	call := block.Nodes[1].(*ast.EvalStmt).Expr.(*ast.CallExpr)
+	assert.Equal(t, []ast.Expr{call.Arguments[0], defaults[0], defaults[1]}, call.Bound)
+	call = block.Nodes[2].(*ast.EvalStmt).Expr.(*ast.CallExpr)
+	assert.Equal(t, []ast.Expr{call.Arguments[0], call.Arguments[1], defaults[1]}, call.Bound)
+	call = block.Nodes[3].(*ast.EvalStmt).Expr.(*ast.CallExpr)
+	assert.Equal(t, []ast.Expr{call.Arguments[1], defaults[0], call.Arguments[0]}, call.Bound)
+}
+
+func TestReportArgumentErrors(t *testing.T) {
+	expectErrors := func(call string, messages ...string) {
+		_, errs := checkAny(t, "{ print :: (message: text, length: int = 1) {}\n"+call+"; }")
+		if assert.Equal(t, len(messages), len(errs), call) {
+			for i, msg := range messages {
+				assert.Equal(t, msg, errs[i].Error())
+			}
+		}
+	}
+
+	expectErrors(`print()`, `example:2:1: Missing an argument for the parameter "message"`)
+	expectErrors(`print("a", 2, 3)`, `example:2:15: Too many arguments; the procedure has 2 parameter(s)`)
+	expectErrors(`print(size = 2, message = "a")`, `example:2:7: The procedure has no parameter named "size"`)
+	expectErrors(`print(length = 2, "a")`,
+		`example:2:19: A positional argument can't follow a named argument`,
+		`example:2:1: Missing an argument for the parameter "message"`)
+	expectErrors(`print("a", message = "b")`, `example:2:22: The parameter "message" was given more than one argument`)
+
+	_, errs := checkAny(t, `{ clamp :: (n: int, max: int = n) {} }`)
+	if assert.Equal(t, 1, len(errs)) {
+		assert.Equal(t, `example:1:32: The default value of "max" can't use the parameter "n"`, errs[0].Error())
+	}
+
+	_, errs = checkAny(t, `{ f :: (a: int, b: text = 5) {} }`)
+	if assert.Equal(t, 1, len(errs)) {
+		assert.Equal(t, `example:1:27: A value of type <number> can't be used as text`, errs[0].Error())
+	}
+
+	// constant arguments must be representable by their parameters
+	_, errs = foldAny(t, `{
+		f :: (a: u8, b: i8 = 128, c: int = 1) {}
+		f(300);
+		f(1, c = 2, b = -129);
+	}`)
+	if assert.Equal(t, 3, len(errs)) {
+		assert.Equal(t, `example:2:24: Constant overflow: 128 can't be represented as i8`, errs[0].Error())
+		assert.Equal(t, `example:3:5: Constant overflow: 300 can't be represented as u8`, errs[1].Error())
+		assert.Equal(t, `example:4:19: Constant overflow: -129 can't be represented as i8`, errs[2].Error())
+	}
+}
+
+func TestBindVariadicArguments(t *testing.T) {
+	node, errs := checkAny(t, `{
+		sum :: (first: int, rest: ..int) -> int { return first + rest.count; }
+		sum(1);
+		sum(1, 2, 3);
+		forward :: (args: ..int) -> int { return sum(args[0], ..args); }
+		f: (..int) -> int = forward;
+		f(4, 5);
+	}`)
+	assert.Empty(t, errs)
+
+	block := node.(*ast.Block)
+	call := func(i int) *ast.CallExpr {
+		return block.Nodes[i].(*ast.EvalStmt).Expr.(*ast.CallExpr)
+	}
+
+	// the remaining arguments are collected into an array
+	assert.Equal(t, 0, len(call(1).Bound[1].(*ast.VariadicExpr).Elements))
+	assert.Equal(t, call(2).Arguments[1:], call(2).Bound[1].(*ast.VariadicExpr).Elements)
+	assert.Equal(t, call(5).Arguments, call(5).Bound[0].(*ast.VariadicExpr).Elements)
+
+	// a spread array is bound directly
+	proc := block.Nodes[3].(*ast.ImmutableDecl).Defn.(*ast.ConstantDefn).Expr.(*ast.ProcedureExpr)
+	spread := proc.Block.Nodes[0].(*ast.ReturnStmt).Value.(*ast.CallExpr)
+	assert.Equal(t, spread.Arguments, spread.Bound)
+	assert.Equal(t, ast.BuiltinInt, spread.Arguments[0].GetType())
+}
+
+func TestReportVariadicErrors(t *testing.T) {
+	_, errs := checkAny(t, `{
+		sum :: (first: int, rest: ..int) {}
+		pair :: (a: int, b: int) {}
+		sum(1, "two");
+		sum(rest = 2, first = 1);
+		sum(..1);
+		pair(1, ..2);
+		f: (text, ..int) -> () = sum;
+		f();
+		xs := 2;
+		xs[0];
+		xs.count;
+	}`)
+	expected := []string{
+		"example:4:10: A value of type <text> can't be used as int",
+		`example:5:7: The variadic parameter "rest" can't be given a named argument`,
+		`example:6:9: The spread argument must be the only argument for the variadic parameter "rest"`,
+		`example:6:3: Missing an argument for the parameter "first"`,
+		"example:7:13: Only the argument for a variadic parameter can be spread",
+		`example:7:3: Missing an argument for the parameter "b"`,
+		"example:8:28: A value of type (int, ..int) can't be used as (text, ..int)",
+		"example:9:3: Expected at least 1 arguments (text), but found 0",
+		"example:11:3: A value of type <number> can't be indexed",
+		`example:12:3: A value of type <number> has no member "count"`,
+	}
+	if assert.Equal(t, len(expected), len(errs)) {
+		for i, msg := range expected {
+			assert.Equal(t, msg, errs[i].Error())
+		}
+	}
+}
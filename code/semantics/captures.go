@@ -0,0 +1,42 @@
+package semantics
+
+import "github.com/kestred/philomath/code/ast"
+
+// captureVariables records the variables of enclosing procedures which are
+// used by a nested procedure, so that the nested procedure can share them
+// (by reference) with the procedure that declares them.
+//
+// A variable is captured by every procedure between its use and its
+// declaration, and a procedure which uses a nested procedure must also be
+// able to pass along the variables captured by that procedure.
+func captureVariables(ident *ast.Identifier) {
+	switch decl := ident.Decl.(type) {
+	case *ast.MutableDecl:
+		captureVariable(ident, decl)
+	case *ast.ImmutableDecl:
+		if proc := overloadProcedure(decl); proc != nil {
+			for _, captured := range proc.Captures {
+				captureVariable(ident, captured)
+			}
+		}
+	}
+}
+
+func captureVariable(ident *ast.Identifier, decl *ast.MutableDecl) {
+	owner := findProcedure(decl)
+	for proc := findProcedure(ident); proc != owner && proc != nil; proc = findProcedure(proc) {
+		decl.Captured = true
+		if !isCaptured(proc, decl) {
+			proc.Captures = append(proc.Captures, decl)
+		}
+	}
+}
+
+func isCaptured(proc *ast.ProcedureExpr, decl *ast.MutableDecl) bool {
+	for _, captured := range proc.Captures {
+		if captured == decl {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,36 @@
+package semantics
+
+import (
+	"testing"
+
+	"github.com/kestred/philomath/code/ast"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCaptureVariables(t *testing.T) {
+	node, errs := checkAny(t, `{
+		total := 1;
+		inner :: () { total = 2; };
+		outer :: () { inner(); };
+		local :: (n: int) { x := n; x = 2; };
+	}`)
+	assert.Empty(t, errs)
+
+	block := node.(*ast.Block)
+	procedure := func(i int) *ast.ProcedureExpr {
+		return block.Nodes[i].(*ast.ImmutableDecl).Defn.(*ast.ConstantDefn).Expr.(*ast.ProcedureExpr)
+	}
+
+	total := block.Nodes[0].(*ast.MutableDecl)
+	assert.True(t, total.Captured)
+	assert.Equal(t, []*ast.MutableDecl{total}, procedure(1).Captures)
+
+	// a procedure which calls a closure must be able to pass along its captures
+	assert.Equal(t, []*ast.MutableDecl{total}, procedure(2).Captures)
+
+	// the variables and parameters of a procedure aren't captures
+	local := procedure(3)
+	assert.Empty(t, local.Captures)
+	assert.False(t, local.Params[0].Captured)
+	assert.False(t, local.Block.Nodes[0].(*ast.MutableDecl).Captured)
+}
@@ -0,0 +1,553 @@
+package semantics
+
+import (
+	"math"
+	"math/big"
+
+	"github.com/kestred/philomath/code/ast"
+	"github.com/kestred/philomath/code/utils"
+)
+
+// FoldConstants evaluates expressions whose operands are all known at
+// compile-time (literals, and the names of "::" constants) and records their
+// values so that bytecode generation can embed them directly.
+func FoldConstants(cs *Section) []error {
+	utils.Assert(!cs.DidSteps(Step_FoldConstants), "Tried to fold constants twice on the same code section")
+	utils.Assert(cs.DidSteps(Step_InferTypes), "Tried to fold constants before type inference")
+
+	f := &folder{visited: make(map[ast.Expr]bool)}
+	for _, node := range cs.Nodes {
+		if expr, ok := node.(ast.Expr); ok {
+			f.fold(expr)
+		}
+		if call, ok := node.(*ast.CallExpr); ok && call.Instance != nil {
+			f.errs = append(f.errs, foldInstance(call)...)
+		}
+
+		// a constant must be representable by the type it is implicitly cast to
+		switch n := node.(type) {
+		case *ast.ReturnStmt:
+			proc := findProcedure(n)
+			if proc == nil || n.Value == nil {
+				break
+			}
+			tuple, isTuple := proc.Return.(*ast.TupleType)
+			values, isValues := n.Value.(*ast.TupleExpr)
+			if isTuple && isValues && len(tuple.Elements) == len(values.Elements) {
+				for i, value := range values.Elements {
+					f.foldImplicit(value, tuple.Elements[i])
+				}
+			} else {
+				f.foldImplicit(n.Value, proc.Return)
+			}
+		case *ast.AssignStmt:
+			if n.Operator == nil && len(n.Left) == len(n.Right) {
+				for i, value := range n.Right {
+					f.foldImplicit(value, concreteType(n.Left[i].GetType()))
+				}
+			}
+		case *ast.MutableDecl:
+			if n.Expr != nil {
+				f.foldImplicit(n.Expr, n.Type)
+			}
+		case *ast.CallExpr:
+			f.foldArguments(n)
+		}
+	}
+
+	// an assertion is checked once its condition has been evaluated; if the
+	// condition couldn't be evaluated, the error was reported when running it
+	for _, node := range cs.Nodes {
+		if assert, ok := node.(*ast.AssertDirective); ok {
+			if value, ok := f.fold(assert.Cond); ok && value == false {
+				f.errs = append(f.errs, assertionError(assert))
+			}
+		}
+	}
+
+	cs.StepsCompleted |= Step_FoldConstants
+	return f.errs
+}
+
+func assertionError(n *ast.AssertDirective) error {
+	if n.Message == nil {
+		return errorAt(n, "Static assertion failed")
+	}
+	return errorAt(n, "Static assertion failed: %s", n.Message.Value)
+}
+
+// chooseBlock evaluates the condition of an "#if" once its names have been
+// resolved, and chooses the block to compile; it returns nil if the condition
+// isn't a constant bool, which is reported during type-checking.
+func chooseBlock(n *ast.IfDirective) *ast.Block {
+	if inferTypesRecursive(n.Cond) != ast.BuiltinBool {
+		return nil
+	}
+
+	f := &folder{visited: make(map[ast.Expr]bool)}
+	value, ok := f.fold(n.Cond)
+	if !ok {
+		return nil
+	}
+
+	if value.(bool) {
+		n.Chosen = n.Then
+	} else if n.Else != nil {
+		n.Chosen = n.Else
+	} else {
+		n.Chosen = ast.Blok(nil)
+	}
+	return n.Chosen
+}
+
+type folder struct {
+	visited map[ast.Expr]bool
+	errs    []error
+}
+
+// fold returns the value of an expression if it is a constant; the value has
+// the Go type which represents the expression's type (eg. "int8" for "i8").
+func (f *folder) fold(expr ast.Expr) (ast.Value, bool) {
+	if value, ok := ast.ConstantOf(expr); ok {
+		return value, true
+	} else if f.visited[expr] {
+		return nil, false
+	}
+
+	f.visited[expr] = true
+	value, ok := f.evaluate(expr)
+	if ok {
+		ast.SetConstant(expr, value)
+	}
+	return value, ok
+}
+
+func (f *folder) evaluate(expr ast.Expr) (ast.Value, bool) {
+	typ := expr.GetType()
+	if _, ok := constantFormat(typ); !ok {
+		return nil, false
+	}
+
+	switch n := expr.(type) {
+	case *ast.NumberLiteral:
+		value, exact := convertConstant(n.Value, typ)
+		if !exact && !isNegated(n) { // eg. "-9223372036854775808" is checked once it is negated
+			f.errs = append(f.errs, errorAt(n, "Constant overflow: %s can't be represented as %s", n.Literal, typ.Print()))
+			return nil, false
+		}
+		return value, true
+	case *ast.CharLiteral:
+		return n.Value, true
+	case *ast.Identifier:
+		if decl, ok := n.Decl.(*ast.ImmutableDecl); ok {
+			if defn, ok := decl.Defn.(*ast.ConstantDefn); ok {
+				return f.foldAs(defn.Expr, typ)
+			}
+		}
+	case *ast.GroupExpr:
+		return f.fold(n.Subexpr)
+	case *ast.RunExpr:
+		if n.Result != nil {
+			return f.fold(n.Result)
+		} else if !n.Ran && n.Subexpr != nil {
+			return f.fold(n.Subexpr) // a constant doesn't need to be run
+		}
+	case *ast.CastExpr:
+		value, ok := f.fold(n.Subexpr)
+		if !ok {
+			return nil, false
+		}
+		result, exact := convertConstant(value, typ)
+		if n.Checked && !exact {
+			f.errs = append(f.errs, errorAt(n, "The constant %v is out of range for a cast to %s", value, typ.Print()))
+			return nil, false
+		}
+		return result, true
+	case *ast.PrefixExpr:
+		if n.Call == nil {
+			return f.foldPrefix(n)
+		}
+	case *ast.InfixExpr:
+		if n.Call == nil {
+			return f.foldInfix(n)
+		}
+	case *ast.ComparisonExpr:
+		return f.foldComparison(n)
+	}
+
+	return nil, false
+}
+
+// foldAs folds an expression and implicitly casts its value to a type.
+func (f *folder) foldAs(expr ast.Expr, typ ast.Type) (ast.Value, bool) {
+	value, ok := f.fold(expr)
+	if !ok {
+		return nil, false
+	}
+	result, exact := convertConstant(value, typ)
+	if !exact {
+		f.errs = append(f.errs, errorAt(expr, "Constant overflow: %v can't be represented as %s", value, typ.Print()))
+		return nil, false
+	}
+	return result, true
+}
+
+// foldImplicit folds an expression which is implicitly cast to another type
+// (eg. a return value), so that a constant which is out of range is reported.
+func (f *folder) foldImplicit(expr ast.Expr, typ ast.Type) {
+	if _, ok := constantFormat(typ); ok && typ != expr.GetType() {
+		f.foldAs(expr, typ)
+	}
+}
+
+// foldArguments checks that the constant arguments of a call are representable
+// by the types of their parameters; defaults are checked with the parameter.
+func (f *folder) foldArguments(n *ast.CallExpr) {
+	typ := n.Procedure.GetType()
+	if n.Instance != nil {
+		typ = n.Instance.Type
+	}
+	procType, ok := typ.(*ast.ProcedureType)
+	if !ok {
+		return
+	}
+
+	args := n.Arguments
+	if n.Bound != nil {
+		args = n.Bound
+	}
+	for i, arg := range args {
+		if i >= len(procType.Params) {
+			break
+		} else if variadic, ok := arg.(*ast.VariadicExpr); ok {
+			for _, element := range variadic.Elements {
+				f.foldImplicit(element, variadic.Type.(*ast.ArrayType).Element)
+			}
+		} else if _, isDefault := arg.GetParent().(*ast.MutableDecl); !isDefault {
+			f.foldImplicit(arg, procType.Params[i])
+		}
+	}
+}
+
+func (f *folder) foldPrefix(n *ast.PrefixExpr) (ast.Value, bool) {
+	value, ok := f.foldAs(n.Subexpr, n.Type)
+	if !ok {
+		return nil, false
+	}
+
+	switch n.Operator {
+	case ast.BuiltinPositive:
+		return value, true
+	case ast.BuiltinNegative:
+		if format, _ := constantFormat(n.Type); format.float {
+			return convertConstant(-constantFloat(value), n.Type)
+		}
+		operand := constantInteger(value)
+		if lit, ok := n.Subexpr.(*ast.NumberLiteral); ok {
+			operand = constantInteger(lit.Value) // eg. "-128i8" is in range, but "128i8" isn't
+		}
+		result, exact := convertConstant(new(big.Int).Neg(operand), n.Type)
+		if !exact {
+			f.errs = append(f.errs, errorAt(n, "Constant overflow: -%v can't be represented as %s", value, n.Type.Print()))
+			return nil, false
+		}
+		return result, true
+	case ast.BuiltinBitNot:
+		result, _ := convertConstant(new(big.Int).Not(constantInteger(value)), n.Type)
+		return result, true
+	default:
+		return nil, false
+	}
+}
+
+func (f *folder) foldInfix(n *ast.InfixExpr) (ast.Value, bool) {
+	if n.Operator.Precedence != ast.ArithmeticPrec &&
+		n.Operator.Precedence != ast.CommutativePrec &&
+		n.Operator.Precedence != ast.DistributivePrec {
+		return nil, false // comparisons are folded as part of their chain
+	}
+
+	left, ok := f.foldAs(n.Left, n.Type)
+	if !ok {
+		return nil, false
+	}
+	var right ast.Value
+	if n.Operator == ast.BuiltinShiftLeft || n.Operator == ast.BuiltinShiftRight {
+		right, ok = f.fold(n.Right) // the shift count keeps its own type
+	} else {
+		right, ok = f.foldAs(n.Right, n.Type)
+	}
+	if !ok {
+		return nil, false
+	}
+
+	if format, _ := constantFormat(n.Type); format.float {
+		var result float64
+		a, b := constantFloat(left), constantFloat(right)
+		switch n.Operator {
+		case ast.BuiltinAdd:
+			result = a + b
+		case ast.BuiltinSubtract:
+			result = a - b
+		case ast.BuiltinMultiply:
+			result = a * b
+		case ast.BuiltinDivide:
+			result = a / b
+		default:
+			return nil, false
+		}
+		return convertConstant(result, n.Type)
+	}
+
+	a, b := constantInteger(left), constantInteger(right)
+	if b.Sign() == 0 && (n.Operator == ast.BuiltinDivide || n.Operator == ast.BuiltinRemainder) {
+		f.errs = append(f.errs, errorAt(n, "Division by zero in a constant expression"))
+		return nil, false
+	}
+
+	result := new(big.Int)
+	checked := true
+	switch n.Operator {
+	case ast.BuiltinAdd:
+		result.Add(a, b)
+	case ast.BuiltinSubtract:
+		result.Sub(a, b)
+	case ast.BuiltinMultiply:
+		result.Mul(a, b)
+	case ast.BuiltinDivide:
+		result.Quo(a, b)
+	case ast.BuiltinRemainder:
+		result.Rem(a, b)
+	case ast.BuiltinShiftLeft:
+		result.Lsh(a, shiftCount(b))
+	case ast.BuiltinShiftRight:
+		result.Rsh(a, shiftCount(b))
+	case ast.BuiltinBitAnd:
+		result.And(a, b)
+		checked = false
+	case ast.BuiltinBitOr:
+		result.Or(a, b)
+		checked = false
+	case ast.BuiltinBitXor:
+		result.Xor(a, b)
+		checked = false
+	default:
+		return nil, false
+	}
+
+	value, exact := convertConstant(result, n.Type)
+	if checked && !exact {
+		f.errs = append(f.errs, errorAt(n, "Constant overflow: %v %s %v can't be represented as %s",
+			left, n.Operator.Literal, right, n.Type.Print()))
+		return nil, false
+	}
+	return value, true
+}
+
+func (f *folder) foldComparison(n *ast.ComparisonExpr) (ast.Value, bool) {
+	for i, cmp := range n.Comparisons {
+		if _, ok := constantFormat(n.Compared[i]); !ok || cmp.Call != nil {
+			return nil, false
+		}
+		left, ok := f.foldAs(n.Operands[i], n.Compared[i])
+		if !ok {
+			return nil, false
+		}
+		right, ok := f.foldAs(n.Operands[i+1], n.Compared[i])
+		if !ok {
+			return nil, false
+		}
+		if !compareConstants(cmp.Operator, left, right) {
+			return false, true
+		}
+	}
+	return true, true
+}
+
+func compareConstants(op *ast.OperatorDefn, left ast.Value, right ast.Value) bool {
+	var cmp int
+	switch l := left.(type) {
+	case bool:
+		return op == ast.BuiltinEqual && l == right.(bool)
+	case float32, float64:
+		a, b := constantFloat(left), constantFloat(right)
+		if a != a || b != b {
+			return false // NaN is unordered
+		} else if a < b {
+			cmp = -1
+		} else if a > b {
+			cmp = +1
+		}
+	default:
+		cmp = constantInteger(left).Cmp(constantInteger(right))
+	}
+
+	switch op {
+	case ast.BuiltinEqual:
+		return cmp == 0
+	case ast.BuiltinLess:
+		return cmp < 0
+	case ast.BuiltinLessOrEqual:
+		return cmp <= 0
+	case ast.BuiltinGreater:
+		return cmp > 0
+	case ast.BuiltinGreaterOrEqual:
+		return cmp >= 0
+	default:
+		return false
+	}
+}
+
+// shiftCount limits the count of a shift, because shifting by more than the
+// width of an integer has the same result as shifting by the width.
+func shiftCount(count *big.Int) uint {
+	if !count.IsUint64() || count.Uint64() > 128 {
+		return 128
+	}
+	return uint(count.Uint64())
+}
+
+type numberFormat struct {
+	float  bool
+	signed bool
+	bits   uint
+}
+
+// constantFormat returns how a constant of the given type is represented; or
+// false if constants of the type can't be folded.
+func constantFormat(typ ast.Type) (numberFormat, bool) {
+	switch typ {
+	case ast.BuiltinBool:
+		return numberFormat{}, true
+	case ast.InferredFloat, ast.BuiltinFloat, ast.BuiltinFloat64:
+		return numberFormat{float: true, bits: 64}, true
+	case ast.BuiltinFloat32:
+		return numberFormat{float: true, bits: 32}, true
+	case ast.InferredNumber, ast.InferredSigned, ast.BuiltinInt, ast.BuiltinInt64:
+		return numberFormat{signed: true, bits: 64}, true
+	case ast.BuiltinInt32:
+		return numberFormat{signed: true, bits: 32}, true
+	case ast.BuiltinInt16:
+		return numberFormat{signed: true, bits: 16}, true
+	case ast.BuiltinInt8:
+		return numberFormat{signed: true, bits: 8}, true
+	case ast.InferredUnsigned, ast.BuiltinUint, ast.BuiltinUint64:
+		return numberFormat{bits: 64}, true
+	case ast.BuiltinUint32, ast.BuiltinChar:
+		return numberFormat{bits: 32}, true
+	case ast.BuiltinUint16:
+		return numberFormat{bits: 16}, true
+	case ast.BuiltinUint8:
+		return numberFormat{bits: 8}, true
+	default:
+		return numberFormat{}, false
+	}
+}
+
+// convertConstant converts a value (or a *big.Int) to the representation of a
+// type, like a cast at runtime would; the conversion is exact if the value is
+// not truncated and does not wrap-around.
+func convertConstant(value ast.Value, typ ast.Type) (result ast.Value, exact bool) {
+	format, ok := constantFormat(typ)
+	utils.Assert(ok, "Tried to convert a constant to a type without a constant representation")
+
+	if b, ok := value.(bool); ok {
+		return b, format == numberFormat{}
+	}
+
+	if format.float {
+		f := constantFloat(value)
+		if format.bits == 32 {
+			exact = math.IsNaN(f) || math.IsInf(f, 0) || math.Abs(f) <= math.MaxFloat32
+			return float32(f), exact
+		}
+		return f, true
+	}
+
+	i := new(big.Int)
+	exact = true
+	switch v := value.(type) {
+	case float32, float64:
+		f := constantFloat(v)
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			exact = false // converts to zero
+		} else {
+			exact = f == math.Trunc(f)
+			big.NewFloat(math.Trunc(f)).Int(i)
+		}
+	default:
+		i = constantInteger(value)
+	}
+
+	// wrap the value around at the width of the type
+	wrapped := new(big.Int).And(i, new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), format.bits), big.NewInt(1)))
+	if format.signed && wrapped.Bit(int(format.bits-1)) == 1 {
+		wrapped.Sub(wrapped, new(big.Int).Lsh(big.NewInt(1), format.bits))
+	}
+	exact = exact && wrapped.Cmp(i) == 0
+
+	if format.signed {
+		v := wrapped.Int64()
+		switch format.bits {
+		case 8:
+			return int8(v), exact
+		case 16:
+			return int16(v), exact
+		case 32:
+			return int32(v), exact
+		default:
+			return v, exact
+		}
+	}
+
+	v := wrapped.Uint64()
+	switch format.bits {
+	case 8:
+		return uint8(v), exact
+	case 16:
+		return uint16(v), exact
+	case 32:
+		return uint32(v), exact
+	default:
+		return v, exact
+	}
+}
+
+func constantInteger(value ast.Value) *big.Int {
+	switch v := value.(type) {
+	case *big.Int:
+		return v
+	case int8:
+		return big.NewInt(int64(v))
+	case int16:
+		return big.NewInt(int64(v))
+	case int32:
+		return big.NewInt(int64(v))
+	case int64:
+		return big.NewInt(v)
+	case uint8:
+		return new(big.Int).SetUint64(uint64(v))
+	case uint16:
+		return new(big.Int).SetUint64(uint64(v))
+	case uint32:
+		return new(big.Int).SetUint64(uint64(v))
+	case uint64:
+		return new(big.Int).SetUint64(v)
+	default:
+		utils.Errorf("Unhandled constant type '%s' in an integer operation", utils.Typeof(value))
+		utils.InvalidCodePath()
+		return nil
+	}
+}
+
+func constantFloat(value ast.Value) float64 {
+	switch v := value.(type) {
+	case float32:
+		return float64(v)
+	case float64:
+		return v
+	default:
+		f, _ := new(big.Float).SetInt(constantInteger(value)).Float64()
+		return f
+	}
+}
@@ -0,0 +1,183 @@
+package semantics
+
+import (
+	"testing"
+
+	"github.com/kestred/philomath/code/ast"
+	"github.com/kestred/philomath/code/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func foldAny(t *testing.T, input string) (ast.Node, []error) {
+	p := parser.Make("example", false, []byte(input))
+	node := p.ParseEvaluable()
+	assert.Empty(t, p.Errors, "Unexpected parser errors")
+	section := FlattenTree(node, nil)
+	ResolveNames(&section)
+	InferTypes(&section)
+	return node, FoldConstants(&section)
+}
+
+func foldValue(t *testing.T, input string) ast.Value {
+	node, errs := foldAny(t, input)
+	assert.Empty(t, errs)
+	value, ok := ast.ConstantOf(node.(*ast.EvalStmt).Expr)
+	assert.True(t, ok, "Expected expression to be constant")
+	return value
+}
+
+func TestFoldConstants(t *testing.T) {
+	// arithmetic
+	assert.Equal(t, int64(2*3+27/9-15), foldValue(t, `2 * 3 + 27 / 9 - 15;`))
+	assert.Equal(t, uint64(5), foldValue(t, `02 * 03 + 04 / 05 - 01;`))
+	assert.Equal(t, float64(9.5), foldValue(t, `(2 + 3) + 4.5;`))
+	assert.Equal(t, int64(-3), foldValue(t, `-3;`))
+	assert.Equal(t, int64(1), foldValue(t, `7 % 3;`))
+	assert.Equal(t, int64(40), foldValue(t, `(5 << 3) | (1 & 2);`))
+
+	// casts
+	assert.Equal(t, uint8(44), foldValue(t, `cast(u8) 300;`))
+	assert.Equal(t, int8(-56), foldValue(t, `cast(i8) 200;`))
+	assert.Equal(t, int64(2), foldValue(t, `cast(i64) 2.75;`))
+	assert.Equal(t, float32(3), foldValue(t, `cast(f32) 3;`))
+	assert.Equal(t, uint32('a'), foldValue(t, `cast(char) 97;`))
+	assert.Equal(t, uint8(255), foldValue(t, `cast?(u8) 255;`))
+	assert.Equal(t, uint8(244), foldValue(t, `cast(u8) 200 + cast(u8) 44;`))
+
+	// typed literals
+	assert.Equal(t, uint8(255), foldValue(t, `255u8;`))
+	assert.Equal(t, int8(-128), foldValue(t, `-128i8;`))
+	assert.Equal(t, float32(1.5), foldValue(t, `1.5f32;`))
+
+	// comparisons
+	assert.Equal(t, true, foldValue(t, `1 < 2 <= 2;`))
+	assert.Equal(t, false, foldValue(t, `1 < 2 < 2;`))
+	assert.Equal(t, true, foldValue(t, `2.5 == 2.5;`))
+}
+
+func TestFoldConstantDecls(t *testing.T) {
+	node, errs := foldAny(t, `{
+		unix_write :: 1;
+		page :: 4 * 1024;
+		unix_write + page;
+
+		mutable := 3;
+		mutable + page;
+	}`)
+	assert.Empty(t, errs)
+
+	block := node.(*ast.Block)
+	value, ok := ast.ConstantOf(block.Nodes[2].(*ast.EvalStmt).Expr)
+	assert.True(t, ok)
+	assert.Equal(t, int64(4097), value)
+
+	// expressions using mutable declarations aren't constant
+	infix := block.Nodes[4].(*ast.EvalStmt).Expr.(*ast.InfixExpr)
+	_, ok = ast.ConstantOf(infix)
+	assert.False(t, ok)
+	value, ok = ast.ConstantOf(infix.Right)
+	assert.True(t, ok)
+	assert.Equal(t, int64(4096), value)
+}
+
+func TestReportConstantErrors(t *testing.T) {
+	_, errs := foldAny(t, `cast(i8) 100 + cast(i8) 100;`)
+	if assert.Equal(t, 1, len(errs)) {
+		assert.Equal(t, "example:1:14: Constant overflow: 100 + 100 can't be represented as i8", errs[0].Error())
+	}
+
+	_, errs = foldAny(t, `{ a :: 01; b :: 02; a - b; }`)
+	if assert.Equal(t, 1, len(errs)) {
+		assert.Equal(t, "example:1:23: Constant overflow: 1 - 2 can't be represented as <unsigned>", errs[0].Error())
+	}
+
+	_, errs = foldAny(t, `10 / (5 - 5);`)
+	if assert.Equal(t, 1, len(errs)) {
+		assert.Equal(t, "example:1:4: Division by zero in a constant expression", errs[0].Error())
+	}
+
+	_, errs = foldAny(t, `cast?(u8) 256;`)
+	if assert.Equal(t, 1, len(errs)) {
+		assert.Equal(t, "example:1:1: The constant 256 is out of range for a cast to u8", errs[0].Error())
+	}
+
+	// implicit casts of constants must be exact
+	_, errs = foldAny(t, `{ X :: 18446744073709551615; f :: () -> int { return X; }; }`)
+	if assert.Equal(t, 1, len(errs)) {
+		assert.Equal(t, "example:1:54: Constant overflow: 18446744073709551615 can't be represented as int", errs[0].Error())
+	}
+
+	_, errs = foldAny(t, `{ f :: () -> i8 { X :: 100; return X + X; }; }`)
+	if assert.Equal(t, 1, len(errs)) {
+		assert.Equal(t, "example:1:38: Constant overflow: 200 can't be represented as i8", errs[0].Error())
+	}
+
+	_, errs = foldAny(t, `{ a: u8 = 255; b: u8 = 256; }`)
+	if assert.Equal(t, 1, len(errs)) {
+		assert.Equal(t, "example:1:24: Constant overflow: 256 can't be represented as u8", errs[0].Error())
+	}
+	assert.Equal(t, int64(-9223372036854775808), foldValue(t, `-9223372036854775808;`))
+}
+
+func TestChooseIfDirective(t *testing.T) {
+	node, errs := checkAny(t, `{
+		debug :: 1;
+		#if 0 < debug <= POINTER_SIZE {
+			level := 2;
+		} #else {
+			level := undeclared;
+		}
+		level + 1;
+	}`)
+	assert.Empty(t, errs)
+
+	// the declarations of the chosen block are visible after the directive
+	block := node.(*ast.Block)
+	cond := block.Nodes[1].(*ast.IfDirective)
+	assert.Equal(t, cond.Then, cond.Chosen)
+	infix := block.Nodes[2].(*ast.EvalStmt).Expr.(*ast.InfixExpr)
+	assert.Equal(t, cond.Then.Nodes[0], infix.Left.(*ast.Identifier).Decl)
+
+	// the names of the other block aren't resolved
+	other := cond.Else.Nodes[0].(*ast.MutableDecl)
+	assert.Nil(t, other.Expr.(*ast.Identifier).Decl)
+
+	// without an "#else", nothing is chosen when the condition is false
+	node, errs = checkAny(t, `#if POINTER_SIZE == 3 { a := undeclared; }`)
+	assert.Empty(t, errs)
+	assert.Empty(t, node.(*ast.IfDirective).Chosen.Nodes)
+}
+
+func TestReportIfDirectiveErrors(t *testing.T) {
+	_, errs := checkAny(t, `{ a := 1; #if a == 1 { b := 2; } }`)
+	if assert.Equal(t, 1, len(errs)) {
+		assert.Equal(t, `example:1:11: The condition of "#if" must be a constant known at compile-time`, errs[0].Error())
+	}
+
+	_, errs = checkAny(t, `#if POINTER_SIZE { b := 2; }`)
+	if assert.Equal(t, 1, len(errs)) {
+		assert.Equal(t, `example:1:1: The condition of "#if" must be a bool, but has type <number>`, errs[0].Error())
+	}
+
+	_, errs = checkAny(t, `#if 10 / (5 - 5) > 0 { b := 2; }`)
+	if assert.Equal(t, 1, len(errs)) {
+		assert.Equal(t, "example:1:8: Division by zero in a constant expression", errs[0].Error())
+	}
+}
+
+func TestCheckAssertions(t *testing.T) {
+	_, errs := foldAny(t, `{
+		page :: 4 * 1024;
+		#assert page % 8 == 0, "misaligned page";
+		#assert page < 4096, "the page is too large";
+		#assert page == 0;
+	}`)
+	if assert.Equal(t, 2, len(errs)) {
+		assert.Equal(t, "example:4:3: Static assertion failed: the page is too large", errs[0].Error())
+		assert.Equal(t, "example:5:3: Static assertion failed", errs[1].Error())
+	}
+
+	// assertions in a block which isn't chosen aren't checked
+	_, errs = foldAny(t, `#if POINTER_SIZE == 3 { #assert 1 == 2, "unreachable"; }`)
+	assert.Empty(t, errs)
+}
@@ -0,0 +1,26 @@
+package semantics
+
+import (
+	"fmt"
+
+	"github.com/kestred/philomath/code/ast"
+	"github.com/kestred/philomath/code/token"
+)
+
+type SemanticError struct {
+	Pos   token.Position
+	Msg   string
+	Notes []*SemanticError // related positions (eg. the definition of a polymorphic procedure)
+}
+
+func (e *SemanticError) Error() string {
+	msg := e.Pos.String() + ": " + e.Msg
+	for _, note := range e.Notes {
+		msg += "\n" + note.Pos.String() + ": note: " + note.Msg
+	}
+	return msg
+}
+
+func errorAt(node ast.Node, msg string, args ...interface{}) error {
+	return &SemanticError{Pos: ast.PositionOf(node), Msg: fmt.Sprintf(msg, args...)}
+}
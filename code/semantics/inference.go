@@ -1,16 +1,16 @@
 package semantics
 
 import (
-	"regexp"
+	"fmt"
+	"math"
 	"strconv"
 	"strings"
 
 	"github.com/kestred/philomath/code/ast"
+	"github.com/kestred/philomath/code/scanner"
 	"github.com/kestred/philomath/code/utils"
 )
 
-// TODO: Break-out operator overload resolution
-
 func InferTypes(cs *Section) {
 	utils.Assert(!cs.DidSteps(Step_InferTypes), "Tried to run type inference twice on the same code section")
 	utils.Assert(cs.DidSteps(Step_ResolveNames), "Tried to run type inference before name resolution")
@@ -32,79 +32,283 @@ func inferTypesRecursive(node ast.Node) ast.Type {
 		}
 	case *ast.AsmBlock:
 		break // nothing to do
+	case *ast.IfDirective:
+		if n.Chosen != nil {
+			inferTypesRecursive(n.Chosen)
+		}
+	case *ast.AssertDirective:
+		inferTypesRecursive(n.Cond)
+		if n.Message != nil {
+			inferTypesRecursive(n.Message)
+		}
 	case *ast.ImmutableDecl:
 		if defn, ok := n.Defn.(*ast.ConstantDefn); ok {
 			inferTypesRecursive(defn.Expr)
 		}
 	case *ast.MutableDecl:
+		if n.Expr == nil {
+			break // the type is explicit
+		}
 		typ := inferTypesRecursive(n.Expr)
 		if n.Type == ast.InferredType {
 			n.Type = typ
 		}
 	case *ast.ReturnStmt:
-		inferTypesRecursive(n.Value)
+		if n.Value != nil {
+			inferTypesRecursive(n.Value)
+		}
+	case *ast.DestructureStmt:
+		typ := inferTypesRecursive(n.Expr)
+		tuple, ok := typ.(*ast.TupleType)
+		for i, decl := range n.Decls {
+			if ok && i < len(tuple.Elements) {
+				decl.Type = tuple.Elements[i]
+			} else {
+				decl.Type = ast.UnresolvedType // the error is reported during type-checking
+			}
+		}
 	case *ast.EvalStmt:
 		inferTypesRecursive(n.Expr)
+	case *ast.DeferStmt:
+		inferTypesRecursive(n.Stmt)
+	case *ast.WhileStmt:
+		inferTypesRecursive(n.Cond)
+		inferTypesRecursive(n.Do)
+	case *ast.DoneStmt:
+		break // nothing to do
 	case *ast.AssignStmt:
-		if len(n.Left) != len(n.Right) {
-			utils.Errorf("Found unbalanced assignment during type inference")
-			utils.NotImplemented(`Printing "file:line: message"-style error messages after parsing`)
+		// an unbalanced assignment is reported during type-checking, unless its
+		// value has multiple return values (eg. "a, b = f();")
+		for _, expr := range n.Left {
+			inferTypesRecursive(expr)
 		}
-		for i := range n.Left {
-			inferTypesRecursive(n.Left[i])
-			inferTypesRecursive(n.Right[i])
+		for _, expr := range n.Right {
+			inferTypesRecursive(expr)
+		}
+		for _, op := range n.Operations {
+			operands := []ast.Expr{op.Left, op.Right}
+			op.Type, op.Call = resolveOperator(op, op.Operator, op.Overloads, operands)
 		}
 	case *ast.PostfixExpr:
-		subtype := inferTypesRecursive(n.Subexpr)
-		n.Type = inferPostfixType(n.Operator, subtype)
+		inferTypesRecursive(n.Subexpr)
+		operands := []ast.Expr{n.Subexpr}
+		n.Type, n.Call = resolveOperator(n, n.Operator, n.Overloads, operands)
 		return n.Type
 	case *ast.InfixExpr:
-		left := inferTypesRecursive(n.Left)
-		right := inferTypesRecursive(n.Right)
-		n.Type = inferInfixType(n.Operator, left, right)
+		inferTypesRecursive(n.Left)
+		inferTypesRecursive(n.Right)
+		operands := []ast.Expr{n.Left, n.Right}
+		n.Type, n.Call = resolveOperator(n, n.Operator, n.Overloads, operands)
+		if n.Call != nil || isError(n.Type) {
+			return n.Type
+		} else if rng, ok := n.Right.(*ast.ExprRange); ok {
+			rng.Compared = castNumbers(n.Left.GetType(), rng.Type.(*ast.RangeType).Element)
+		} else if n.Operator == ast.BuiltinElementOf || n.Operator == ast.BuiltinNotElementOf {
+			n.Compared = comparedType(ast.BuiltinEqual, n.Left.GetType(), elementType(n.Right.GetType()))
+		}
+		return n.Type
+	case *ast.ExprRange:
+		typ := castNumbers(inferTypesRecursive(n.Min), inferTypesRecursive(n.Max))
+		if isError(typ) {
+			n.Type = typ
+		} else {
+			n.Type = ast.RangeTyp(typ)
+		}
+		return n.Type
+	case *ast.ComparisonExpr:
+		for _, operand := range n.Operands {
+			inferTypesRecursive(operand)
+		}
+
+		n.Type = ast.BuiltinBool
+		n.Compared = make([]ast.Type, len(n.Comparisons))
+		for i, cmp := range n.Comparisons {
+			operands := []ast.Expr{cmp.Left, cmp.Right}
+			cmp.Type, cmp.Call = resolveOperator(cmp, cmp.Operator, cmp.Overloads, operands)
+			if cmp.Call == nil {
+				n.Compared[i] = comparedType(cmp.Operator, cmp.Left.GetType(), cmp.Right.GetType())
+			}
+			if n.Type == ast.BuiltinBool && (isError(cmp.Type) || cmp.Type == ast.AmbiguousType) {
+				n.Type = cmp.Type
+			}
+		}
 		return n.Type
 	case *ast.PrefixExpr:
-		subtype := inferTypesRecursive(n.Subexpr)
-		n.Type = inferPrefixType(n.Operator, subtype)
+		inferTypesRecursive(n.Subexpr)
+		operands := []ast.Expr{n.Subexpr}
+		n.Type, n.Call = resolveOperator(n, n.Operator, n.Overloads, operands)
+		return n.Type
+	case *ast.CastExpr:
+		typ := inferTypesRecursive(n.Subexpr)
+		if isError(typ) {
+			n.Type = typ
+		} else if canCastExplicitly(typ, n.Target) {
+			n.Type = n.Target
+		} else {
+			n.Type = ast.UncastableType
+		}
+		return n.Type
+	case *ast.TupleExpr:
+		types := make([]ast.Type, len(n.Elements))
+		for i, element := range n.Elements {
+			types[i] = inferTypesRecursive(element)
+		}
+		n.Type = ast.TupleTyp(types)
 		return n.Type
 	case *ast.GroupExpr:
 		n.Type = inferTypesRecursive(n.Subexpr)
 		return n.Type
+	case *ast.RunExpr:
+		if n.Block != nil {
+			inferTypesRecursive(n.Block)
+			n.Type = blockType(n.Block)
+		} else {
+			n.Type = inferTypesRecursive(n.Subexpr)
+		}
+		return n.Type
 	case *ast.ProcedureExpr:
-		n.Type = ast.PlaceholderType // TODO: ProcedureType(s)
+		params := make([]ast.Type, len(n.Params))
+		for i, param := range n.Params {
+			params[i] = param.Type
+		}
+		ret := n.Return
+		if ret == ast.InferredType {
+			ret = nil // the procedure doesn't declare a return value
+		}
+
+		// the type is set before the block, so that the procedure can call itself
+		typ := ast.ProcTyp(params, ret)
+		typ.Variadic = len(n.Params) > 0 && n.Params[len(n.Params)-1].Variadic
+		n.Type = typ
+		if ast.IsPolymorphic(n) {
+			return n.Type // only the instances of the procedure are inferred
+		}
+		for _, param := range n.Params {
+			inferTypesRecursive(param) // for default values
+		}
 		inferTypesRecursive(n.Block)
 		return n.Type
 	case *ast.CallExpr:
-		n.Type = n.Procedure.GetType()
 		for _, arg := range n.Arguments {
 			inferTypesRecursive(arg)
 		}
+
+		// the arguments of a call to a polymorphic procedure choose its instance
+		typ := inferTypesRecursive(n.Procedure)
+		if name, ok := n.Procedure.(*ast.Identifier); ok {
+			if proc := overloadProcedure(name.Decl); proc != nil && ast.IsPolymorphic(proc) {
+				if n.Instance = instantiate(n, proc); n.Instance == nil {
+					n.Type = ast.UnresolvedType // the error is reported during type-checking
+					return n.Type
+				}
+				typ = n.Instance.Type
+			}
+		}
+
+		// a call has the return type of the procedure
+		if procType, ok := typ.(*ast.ProcedureType); ok {
+			n.Type = procType.Return
+			if n.Type == nil {
+				n.Type = ast.PlaceholderType // TODO: infer the return type of procedures
+			}
+		} else if isError(typ) {
+			n.Type = typ
+		} else {
+			n.Type = ast.UnresolvedType // the error is reported during type-checking
+		}
+
+		proc := n.Instance
+		if name, ok := n.Procedure.(*ast.Identifier); ok && proc == nil {
+			proc = overloadProcedure(name.Decl)
+		}
+		if proc != nil {
+			if bound, errs := bindArguments(n, proc); len(errs) == 0 {
+				n.Bound = bound // the errors are reported during type-checking
+			}
+		} else if procType, ok := typ.(*ast.ProcedureType); ok {
+			n.Bound = bindValueArguments(n, procType)
+		}
+		return n.Type
+	case *ast.IndexExpr:
+		left := inferTypesRecursive(n.Left)
+		index := inferTypesRecursive(n.Index)
+		if array, ok := left.(*ast.ArrayType); ok && maybeInteger(index) {
+			n.Type = array.Element
+		} else if isText(left) && maybeInteger(index) {
+			n.Type = ast.BuiltinUint8 // text is indexed by byte
+		} else if isError(left) || isError(index) {
+			n.Type = ast.UnresolvedType // the error is reported for the operand instead
+		} else {
+			n.Type = ast.UncastableType // the error is reported during type-checking
+		}
+		return n.Type
+	case *ast.MemberExpr:
+		left := inferTypesRecursive(n.Left)
+		if _, ok := left.(*ast.ArrayType); ok && n.Member.Literal == "count" {
+			n.Type = ast.BuiltinInt
+		} else if isText(left) && n.Member.Literal == "count" {
+			n.Type = ast.BuiltinInt
+		} else if isText(left) && n.Member.Literal == "data" {
+			n.Type = ast.PtrTyp(ast.BuiltinUint8)
+		} else if defn := ast.StructOf(left); defn != nil && ast.FieldIndex(defn, n.Member.Literal) >= 0 {
+			n.Type = defn.Fields[ast.FieldIndex(defn, n.Member.Literal)].Type
+		} else if isError(left) {
+			n.Type = ast.UnresolvedType // the error is reported for the operand instead
+		} else {
+			n.Type = ast.UncastableType // the error is reported during type-checking
+		}
+		return n.Type
 	case *ast.Identifier:
 		utils.Assert(n.Decl != nil, "An unresolved identifier survived until type inferrence")
 		switch d := n.Decl.(type) {
 		case *ast.ImmutableDecl:
-			n.Type = d.Defn.(*ast.ConstantDefn).Expr.GetType()
+			expr := d.Defn.(*ast.ConstantDefn).Expr
+			if expr.GetType() == ast.UninferredType {
+				inferTypesRecursive(expr) // eg. in the condition of an "#if"
+			}
+			n.Type = expr.GetType()
 		case *ast.MutableDecl:
 			n.Type = d.Type
 		}
 		return n.Type
 	case *ast.NumberLiteral:
-		n.Type, n.Value = parseNumber(n.Literal)
+		n.Type, n.Value, _ = parseNumber(n) // errors are reported by typechecking
 		return n.Type
 	case *ast.TextLiteral:
+		value, err := scanner.Unquote(n.Literal)
+		utils.Assert(err == nil, "An invalid text literal survived until type inference")
 		n.Type = ast.InferredText
-		n.Value = parseString(n.Literal)
+		n.Value = value
+		return n.Type
+	case *ast.CharLiteral:
+		value, err := scanner.UnquoteChar(n.Literal)
+		utils.Assert(err == nil, "An invalid char literal survived until type inference")
+		n.Type = ast.BuiltinChar
+		n.Value = uint32(value)
+		return n.Type
 	default:
 		utils.InvalidCodePath()
 	}
 	return ast.BuiltinEmpty
 }
 
-func inferPrefixType(op *ast.OperatorDefn, typ ast.Type) ast.Type {
-	if isError(typ) {
-		return typ
+// blockType returns the type of the value of a block, which is the value of
+// its last statement (if that statement is an expression).
+func blockType(block *ast.Block) ast.Type {
+	if len(block.Nodes) > 0 {
+		switch last := block.Nodes[len(block.Nodes)-1].(type) {
+		case *ast.EvalStmt:
+			return last.Expr.GetType()
+		case *ast.ReturnStmt:
+			if last.Value != nil {
+				return last.Value.GetType()
+			}
+		}
 	}
+	return ast.BuiltinEmpty
+}
 
+func inferPrefixType(op *ast.OperatorDefn, typ ast.Type) ast.Type {
 	switch op {
 	case ast.BuiltinPositive, ast.BuiltinNegative:
 		switch typ {
@@ -135,96 +339,173 @@ func inferPrefixType(op *ast.OperatorDefn, typ ast.Type) ast.Type {
 		case ast.BuiltinUint64:
 			return ast.BuiltinInt64
 		default:
-			utils.NotImplemented("Operator overloading for prefix +/- (unary negation)")
-			return nil
+			return ast.UncastableType // requires an overload (eg. "neg_")
 		}
+	case ast.BuiltinBitNot:
+		if !maybeInteger(typ) {
+			return ast.UncastableType // requires an overload (eg. "bitnot_")
+		}
+		return typ
 	default:
-		utils.Errorf("Unhandled prefix operator '%s' in type inference", op.Literal)
-		utils.InvalidCodePath()
-		return nil
+		return nil // not a builtin operator
 	}
 }
 
 func inferPostfixType(op *ast.OperatorDefn, typ ast.Type) ast.Type {
-	if isError(typ) {
-		return typ
-	}
-
 	switch op {
 	default:
-		utils.Errorf("Unhandled postfix operator '%s' in type inference", op.Literal)
-		utils.InvalidCodePath()
-		return nil
+		return nil // not a builtin operator
 	}
 }
 
 func inferInfixType(op *ast.OperatorDefn, left ast.Type, right ast.Type) ast.Type {
-	if isError(left) {
-		return left
-	} else if isError(right) {
-		return right
-	}
-
 	switch op {
-	case ast.BuiltinAdd, ast.BuiltinSubtract, ast.BuiltinMultiply, ast.BuiltinDivide:
-		// TODO: Implement operator overload resolution
+	case ast.BuiltinAdd:
+		if isText(left) && isText(right) {
+			return castTexts(left, right) // concatenation
+		}
 		return castNumbers(left, right)
+	case ast.BuiltinSubtract, ast.BuiltinMultiply, ast.BuiltinDivide:
+		return castNumbers(left, right)
+	case ast.BuiltinRemainder, ast.BuiltinBitAnd, ast.BuiltinBitOr, ast.BuiltinBitXor:
+		return castIntegers(left, right)
+	case ast.BuiltinShiftLeft, ast.BuiltinShiftRight:
+		// the shift count may be any integer; the result has the type of the value being shifted
+		if !maybeInteger(left) || !maybeInteger(right) {
+			return ast.UncastableType
+		}
+		return left
+	case ast.BuiltinEqual, ast.BuiltinLess, ast.BuiltinLessOrEqual, ast.BuiltinGreater, ast.BuiltinGreaterOrEqual:
+		if typ := comparedType(op, left, right); isError(typ) {
+			return typ
+		}
+		return ast.BuiltinBool
+	case ast.BuiltinElementOf, ast.BuiltinNotElementOf:
+		elem := elementType(right)
+		if elem == nil {
+			return ast.UncastableType // requires an overload (eg. "_in_")
+		} else if !sameType(left, elem) && isError(castNumbers(left, elem)) {
+			return ast.UncastableType
+		}
+		return ast.BuiltinBool
 	default:
-		utils.Errorf("Unhandled infix operator '%s' in type inference", op.Literal)
-		utils.InvalidCodePath()
-		return nil
+		return nil // not a builtin operator
 	}
 }
 
-// TODO: Stop being lazy (using regexp) and replace escape sequences properly
-var escNewline = regexp.MustCompile(`\\n`)
-var escReturn = regexp.MustCompile(`\\r`)
-var escTab = regexp.MustCompile(`\\t`)
-
-func parseString(lit string) []byte {
-	utils.Assert(len(lit) >= 2, "Expected string literal to still be quoted in type inference")
-	result := []byte(lit[1 : len(lit)-1])
-	result = escNewline.ReplaceAll(result, []byte("\n"))
-	result = escReturn.ReplaceAll(result, []byte("\r"))
-	result = escTab.ReplaceAll(result, []byte("\t"))
-	return result
+// elementType returns the type of the values contained by a range, array, or
+// text; or nil if the type isn't a builtin collection.
+func elementType(typ ast.Type) ast.Type {
+	switch t := typ.(type) {
+	case *ast.RangeType:
+		return t.Element
+	case *ast.ArrayType:
+		return t.Element
+	}
+
+	if isText(typ) {
+		return ast.BuiltinChar
+	}
+	return nil
 }
 
-// TODO: Should literals continue to be parsed here, or elsewhere?
-func parseNumber(num string) (ast.Type, interface{}) {
-	if len(num) > 2 && num[0:2] == "0x" {
-		val, err := strconv.ParseUint(num, 16, 0)
-		if err == strconv.ErrRange {
-			utils.Errorf("Hexadecimal literal can't be represented by a uint64")
-			utils.NotImplemented(`Printing "file:line: message"-style error messages after parsing`)
-		}
-		utils.AssertNil(err, "Failed parsing hexadecimal literal")
-		return ast.InferredUnsigned, val
-	} else if strings.Contains(num, ".") || strings.Contains(num, "e") {
-		val, err := strconv.ParseFloat(num, 0)
-		if err == strconv.ErrRange {
-			utils.Errorf("Floating point literal can't be represented by a float64")
-			utils.NotImplemented(`Printing "file:line: message"-style error messages after parsing`)
-		}
-		utils.AssertNil(err, "Failed parsing float literal")
-		return ast.InferredFloat, val
-	} else if num[0] == '0' {
-		val, err := strconv.ParseUint(num, 8, 0)
-		if err == strconv.ErrRange {
-			utils.Errorf("Octal literal can't be represented by a uint64")
-			utils.NotImplemented(`Printing "file:line: message"-style error messages after parsing`)
-		}
-		utils.AssertNil(err, "Failed parsing octal literal")
-		return ast.InferredUnsigned, val
-	} else {
-		val, err := strconv.ParseUint(num, 10, 0)
-		if err == strconv.ErrRange {
-			utils.Errorf("Decimal literal can't be represented by a uint64")
-			utils.NotImplemented(`Printing "file:line: message"-style error messages after parsing`)
+// comparedType returns the type that both operands of a builtin comparison
+// are cast to before they are compared.
+func comparedType(op *ast.OperatorDefn, left ast.Type, right ast.Type) ast.Type {
+	if op == ast.BuiltinEqual && left == ast.BuiltinBool && right == ast.BuiltinBool {
+		return ast.BuiltinBool
+	} else if left == ast.BuiltinChar && right == ast.BuiltinChar {
+		return ast.BuiltinChar
+	} else if isText(left) && isText(right) {
+		return castTexts(left, right) // compared byte-by-byte
+	}
+	return castNumbers(left, right)
+}
+
+// parseNumber returns the type and value of a number literal; a literal with
+// a type suffix (eg. "255u8") has that type, and must be in range for it.  The
+// value of an integer is a uint64, and the value of a float is a float64.
+func parseNumber(n *ast.NumberLiteral) (ast.Type, interface{}, error) {
+	num := strings.Replace(n.Literal, "_", "", -1)
+	isHex := strings.HasPrefix(num, "0x")
+
+	// the suffix of a hexadecimal number can't start with "f"
+	suffixStart := strings.IndexAny(num, "iuf")
+	if isHex {
+		suffixStart = strings.IndexAny(num, "iu")
+	}
+
+	var suffix ast.Type
+	if i := suffixStart; i > 0 {
+		utils.Assert(scanner.IsTypeSuffix(num[i:]), "An invalid number suffix survived until type inference")
+		suffix = ast.BuiltinTypes[num[i:]]
+		num = num[:i]
+	}
+
+	var typ ast.Type
+	var val interface{}
+	var err error
+	switch {
+	case isHex:
+		typ = ast.InferredUnsigned
+		val, err = strconv.ParseUint(num[2:], 16, 64)
+	case strings.HasPrefix(num, "0b"):
+		typ = ast.InferredUnsigned
+		val, err = strconv.ParseUint(num[2:], 2, 64)
+	case strings.ContainsAny(num, ".e"):
+		typ = ast.InferredFloat
+		val, err = strconv.ParseFloat(num, 64)
+	case num[0] == '0':
+		typ = ast.InferredUnsigned
+		val, err = strconv.ParseUint(num, 8, 64)
+	default:
+		typ = ast.InferredNumber
+		val, err = strconv.ParseUint(num, 10, 64)
+
+		// a number which is too large to be signed is unsigned (eg. "18446744073709551615")
+		if v, ok := val.(uint64); ok && v > math.MaxInt64 && !(isNegated(n) && v == 1<<63) {
+			typ = ast.InferredUnsigned
+		}
+	}
+	if numErr, ok := err.(*strconv.NumError); ok && numErr.Err == strconv.ErrRange {
+		if typ == ast.InferredFloat {
+			return ast.UncastableType, nil, fmt.Errorf("The number %s is too large to be represented by a float64", n.Literal)
 		}
-		utils.AssertNil(err, "Failed parsing decimal literal")
-		return ast.InferredNumber, val
+		return ast.UncastableType, nil, fmt.Errorf("The number %s is too large to be represented by a uint64", n.Literal)
+	}
+	utils.AssertNil(err, "Failed parsing number literal")
+	if suffix == nil {
+		return typ, val, nil
+	}
+
+	format, _ := constantFormat(suffix)
+	if f, ok := val.(float64); ok {
+		if !format.float {
+			return ast.UncastableType, nil, fmt.Errorf("The number %s has a fraction or exponent, so it can't be %s", n.Literal, suffix.Print())
+		} else if format.bits == 32 && f > math.MaxFloat32 {
+			return ast.UncastableType, nil, fmt.Errorf("The number %s is out of range for %s", n.Literal, suffix.Print())
+		}
+		return suffix, f, nil
+	} else if format.float {
+		return suffix, float64(val.(uint64)), nil
+	}
+
+	max := uint64(1)<<format.bits - 1
+	if format.signed {
+		max = uint64(1) << (format.bits - 1)
+		if !isNegated(n) {
+			max -= 1 // eg. "-128i8" is in range, but "128i8" isn't
+		}
+	}
+	if val.(uint64) > max {
+		return ast.UncastableType, nil, fmt.Errorf("The number %s is out of range for %s", n.Literal, suffix.Print())
 	}
+	return suffix, val, nil
+}
+
+func isNegated(n ast.Expr) bool {
+	prefix, ok := n.GetParent().(*ast.PrefixExpr)
+	return ok && prefix.Operator == ast.BuiltinNegative
 }
 
 func castNumbers(left ast.Type, right ast.Type) ast.Type {
@@ -273,6 +554,15 @@ func castNumbers(left ast.Type, right ast.Type) ast.Type {
 	return promoteByOrder(left, right)
 }
 
+// castIntegers is like castNumbers, but the operands must both be integers
+// (eg. the operands of "%" or "&").
+func castIntegers(left ast.Type, right ast.Type) ast.Type {
+	if !maybeInteger(left) || !maybeInteger(right) {
+		return ast.UncastableType
+	}
+	return castNumbers(left, right)
+}
+
 func promoteByOrder(left ast.Type, right ast.Type) ast.Type {
 	if promotionOrder(left) >= promotionOrder(right) {
 		return left
@@ -302,6 +592,15 @@ func promotionOrder(typ ast.Type) int {
 	}
 }
 
+// castTexts returns the type of text that both operands are cast to; text
+// literals are only "<text>" if both operands are literals.
+func castTexts(left ast.Type, right ast.Type) ast.Type {
+	if left == ast.InferredText && right == ast.InferredText {
+		return ast.InferredText
+	}
+	return ast.BuiltinText
+}
+
 func isError(typ ast.Type) bool {
 	switch typ {
 	case
@@ -314,11 +613,20 @@ func isError(typ ast.Type) bool {
 	}
 }
 
+func isText(typ ast.Type) bool {
+	return typ == ast.BuiltinText || typ == ast.InferredText
+}
+
 func maybeNumber(typ ast.Type) bool {
 	return typ == ast.InferredNumber || typ == ast.InferredType ||
 		isFloat(typ) || isSigned(typ) || isUnsigned(typ)
 }
 
+func maybeInteger(typ ast.Type) bool {
+	return typ == ast.InferredNumber || typ == ast.InferredType ||
+		isSigned(typ) || isUnsigned(typ)
+}
+
 func isFloat(typ ast.Type) bool {
 	switch typ {
 	case
@@ -111,6 +111,7 @@ func inferLiteral(t *testing.T, input string) ast.Literal {
 	node := p.ParseEvaluable()
 	assert.Empty(t, p.Errors, "Unexpected parser errors")
 	section := FlattenTree(node, nil)
+	ResolveNames(&section)
 	InferTypes(&section)
 	return node.(*ast.EvalStmt).Expr.(ast.Literal)
 }
@@ -120,9 +121,14 @@ func TestInferLiterals(t *testing.T) {
 	assert.Equal(t, ast.InferredNumber, inferLiteral(t, `22`).GetType())
 	assert.Equal(t, uint64(0755), inferLiteral(t, `0755`).GetValue())
 	assert.Equal(t, ast.InferredUnsigned, inferLiteral(t, `0755`).GetType())
-	// TODO: Implement hexidecimal scanning
-	// assert.Equal(t, uint64(0xff), inferLiteral(`0xff`).GetValue())
-	// assert.Equal(t, ast.InferredUnsigned, inferLiteral(t, `0xff`).GetType())
+	assert.Equal(t, uint64(0xff), inferLiteral(t, `0xff`).GetValue())
+	assert.Equal(t, ast.InferredUnsigned, inferLiteral(t, `0xff`).GetType())
+	assert.Equal(t, uint64(10), inferLiteral(t, `0b1010`).GetValue())
+	assert.Equal(t, ast.InferredUnsigned, inferLiteral(t, `0b1010`).GetType())
+	assert.Equal(t, uint64(1000000), inferLiteral(t, `1_000_000`).GetValue())
+	assert.Equal(t, ast.InferredNumber, inferLiteral(t, `1_000_000`).GetType())
+	assert.Equal(t, ast.InferredNumber, inferLiteral(t, `9223372036854775807`).GetType())
+	assert.Equal(t, ast.InferredUnsigned, inferLiteral(t, `18446744073709551615`).GetType())
 	assert.Equal(t, float64(.32), inferLiteral(t, `.32`).GetValue())
 	assert.Equal(t, ast.InferredFloat, inferLiteral(t, `.32`).GetType())
 	assert.Equal(t, float64(3.2), inferLiteral(t, `3.2`).GetValue())
@@ -135,6 +141,21 @@ func TestInferLiterals(t *testing.T) {
 	assert.Equal(t, ast.InferredFloat, inferLiteral(t, `3e+2`).GetType())
 	assert.Equal(t, float64(3e-2), inferLiteral(t, `3e-2`).GetValue())
 	assert.Equal(t, ast.InferredFloat, inferLiteral(t, `3e-2`).GetType())
+	assert.Equal(t, float64(3.25e10), inferLiteral(t, `3.25e1_0`).GetValue())
+
+	assert.Equal(t, uint64(255), inferLiteral(t, `255u8`).GetValue())
+	assert.Equal(t, ast.BuiltinUint8, inferLiteral(t, `255u8`).GetType())
+	assert.Equal(t, uint64(0xff), inferLiteral(t, `0xFFi16`).GetValue())
+	assert.Equal(t, ast.BuiltinInt16, inferLiteral(t, `0xFFi16`).GetType())
+	assert.Equal(t, float64(1), inferLiteral(t, `1f32`).GetValue())
+	assert.Equal(t, ast.BuiltinFloat32, inferLiteral(t, `1f32`).GetType())
+	assert.Equal(t, float64(2.5), inferLiteral(t, `2.5f64`).GetValue())
+	assert.Equal(t, ast.BuiltinFloat64, inferLiteral(t, `2.5f64`).GetType())
+
+	assert.Equal(t, []byte("a\tb\x00\xFFé"), inferLiteral(t, `"a\tb\0\xFF\u{E9}"`).GetValue())
+	assert.Equal(t, ast.InferredText, inferLiteral(t, `"a\tb"`).GetType())
+	assert.Equal(t, uint32('é'), inferLiteral(t, `'\u{E9}'`).GetValue())
+	assert.Equal(t, ast.BuiltinChar, inferLiteral(t, `'a'`).GetType())
 }
 
 func inferExpression(t *testing.T, input string) ast.Expr {
@@ -142,6 +163,7 @@ func inferExpression(t *testing.T, input string) ast.Expr {
 	node := p.ParseEvaluable()
 	assert.Empty(t, p.Errors, "Unexpected parser errors")
 	section := FlattenTree(node, nil)
+	ResolveNames(&section)
 	InferTypes(&section)
 	return node.(*ast.EvalStmt).Expr
 }
@@ -234,3 +256,102 @@ func TestInferArithmetic(t *testing.T) {
 	assert.Equal(t, ast.UncastableType, inferExpression(t, `(-7 + 07) * 7;`).GetType())
 	assert.Equal(t, ast.UncastableType, inferExpression(t, `(-7 + 07) / 7;`).GetType())
 }
+
+func TestInferComparisons(t *testing.T) {
+	assert.Equal(t, ast.BuiltinBool, inferExpression(t, `7 < 8;`).GetType())
+	assert.Equal(t, ast.BuiltinBool, inferExpression(t, `7 == 7.0;`).GetType())
+	assert.Equal(t, ast.BuiltinBool, inferExpression(t, `-7 < 7 <= 8.0;`).GetType())
+	assert.Equal(t, ast.BuiltinBool, inferExpression(t, `7 > 6 >= 5;`).GetType())
+	assert.Equal(t, ast.UncastableType, inferExpression(t, `-7 < 07;`).GetType())
+	assert.Equal(t, ast.UncastableType, inferExpression(t, `1 < -7 < 07;`).GetType())
+	assert.Equal(t, ast.UncastableType, inferExpression(t, `"seven" == 7;`).GetType())
+	assert.Equal(t, ast.BuiltinBool, inferExpression(t, `'a' < 'b';`).GetType())
+	assert.Equal(t, ast.UncastableType, inferExpression(t, `'a' < 98;`).GetType())
+
+	cmp := inferExpression(t, `1 < 2.0 <= 03;`).(*ast.ComparisonExpr)
+	assert.Equal(t, []ast.Type{ast.InferredFloat, ast.InferredFloat}, cmp.Compared)
+	assert.Equal(t, ast.BuiltinBool, cmp.Comparisons[0].Type)
+	assert.Equal(t, ast.BuiltinBool, cmp.Comparisons[1].Type)
+}
+
+func TestInferMembership(t *testing.T) {
+	assert.Equal(t, ast.BuiltinBool, inferExpression(t, `7 in 0..10;`).GetType())
+	assert.Equal(t, ast.BuiltinBool, inferExpression(t, `7 not in 0..10;`).GetType())
+	assert.Equal(t, ast.BuiltinBool, inferExpression(t, `7.5 in 0..10;`).GetType())
+	assert.Equal(t, ast.UncastableType, inferExpression(t, `-7 in 0..010;`).GetType())
+	assert.Equal(t, ast.UncastableType, inferExpression(t, `"seven" in 0..10;`).GetType())
+	assert.Equal(t, ast.UncastableType, inferExpression(t, `7 in "seven";`).GetType())
+
+	rng := inferExpression(t, `7 in 0..10.0;`).(*ast.InfixExpr).Right.(*ast.ExprRange)
+	assert.Equal(t, ast.RangeTyp(ast.InferredFloat), rng.Type)
+	assert.Equal(t, ast.InferredFloat, rng.Compared)
+
+	node := inferAny(t, `{ vowel :: (c: char) -> bool { return c in "aeiou"; } }`)
+	defn := node.(*ast.Block).Nodes[0].(*ast.ImmutableDecl).Defn.(*ast.ConstantDefn)
+	ret := defn.Expr.(*ast.ProcedureExpr).Block.Nodes[0].(*ast.ReturnStmt)
+	assert.Equal(t, ast.BuiltinBool, ret.Value.GetType())
+}
+
+func TestInferText(t *testing.T) {
+	assert.Equal(t, ast.InferredText, inferExpression(t, `"ab" + "cd";`).GetType())
+	assert.Equal(t, ast.BuiltinBool, inferExpression(t, `"ab" < "cd" <= "cd";`).GetType())
+	assert.Equal(t, ast.BuiltinUint8, inferExpression(t, `"ab"[1];`).GetType())
+	assert.Equal(t, ast.BuiltinInt, inferExpression(t, `"ab".count;`).GetType())
+	assert.Equal(t, ast.PtrTyp(ast.BuiltinUint8), inferExpression(t, `"ab".data;`).GetType())
+	assert.Equal(t, ast.UncastableType, inferExpression(t, `"ab" + 1;`).GetType())
+	assert.Equal(t, ast.UncastableType, inferExpression(t, `"ab"[1.0];`).GetType())
+	assert.Equal(t, ast.UncastableType, inferExpression(t, `"ab".length;`).GetType())
+
+	node := inferAny(t, `{ s: text = "ab"; s + "cd"; s == "cd"; }`)
+	block := node.(*ast.Block)
+	assert.Equal(t, ast.BuiltinText, block.Nodes[1].(*ast.EvalStmt).Expr.GetType())
+	cmp := block.Nodes[2].(*ast.EvalStmt).Expr.(*ast.ComparisonExpr)
+	assert.Equal(t, []ast.Type{ast.BuiltinText}, cmp.Compared)
+}
+
+func TestInferBitwise(t *testing.T) {
+	assert.Equal(t, ast.InferredNumber, inferExpression(t, `7 % 3;`).GetType())
+	assert.Equal(t, ast.InferredNumber, inferExpression(t, `6 & 3 | 8 xor 1;`).GetType())
+	assert.Equal(t, ast.InferredUnsigned, inferExpression(t, `0360 & 074;`).GetType())
+	assert.Equal(t, ast.InferredNumber, inferExpression(t, `!7;`).GetType())
+	assert.Equal(t, ast.UncastableType, inferExpression(t, `7.0 % 3;`).GetType())
+	assert.Equal(t, ast.UncastableType, inferExpression(t, `!1.5;`).GetType())
+
+	// the result of a shift has the type of the value being shifted
+	assert.Equal(t, ast.InferredUnsigned, inferExpression(t, `01 << 3;`).GetType())
+	assert.Equal(t, ast.InferredSigned, inferExpression(t, `-8 >> 01;`).GetType())
+	assert.Equal(t, ast.UncastableType, inferExpression(t, `8 >> 1.0;`).GetType())
+}
+
+func TestInferCasts(t *testing.T) {
+	assert.Equal(t, ast.BuiltinUint8, inferExpression(t, `cast(u8) 300;`).GetType())
+	assert.Equal(t, ast.BuiltinFloat32, inferExpression(t, `cast?(f32) 1;`).GetType())
+	assert.Equal(t, ast.BuiltinChar, inferExpression(t, `cast(char) 97;`).GetType())
+	assert.Equal(t, ast.BuiltinInt, inferExpression(t, `cast(int) cast(char) 97;`).GetType())
+	assert.Equal(t, ast.UncastableType, inferExpression(t, `cast(char) 97.5;`).GetType())
+	assert.Equal(t, ast.UncastableType, inferExpression(t, `cast(i8) "text";`).GetType())
+}
+
+func TestCheckNumberLiterals(t *testing.T) {
+	_, errs := checkAny(t, `{
+		a := 127i8;
+		b := -128i8;
+		c := 0xFFFF_FFFF_FFFF_FFFF;
+	}`)
+	assert.Empty(t, errs)
+
+	_, errs = checkAny(t, `{
+		a := 128i8;
+		b := 256u8;
+		c := 1.5i32;
+		d := 1e39f32;
+		e := 0x1_0000_0000_0000_0000;
+	}`)
+	if assert.Equal(t, 5, len(errs)) {
+		assert.Equal(t, "example:2:8: The number 128i8 is out of range for i8", errs[0].Error())
+		assert.Equal(t, "example:3:8: The number 256u8 is out of range for u8", errs[1].Error())
+		assert.Equal(t, "example:4:8: The number 1.5i32 has a fraction or exponent, so it can't be i32", errs[2].Error())
+		assert.Equal(t, "example:5:8: The number 1e39f32 is out of range for f32", errs[3].Error())
+		assert.Equal(t, "example:6:8: The number 0x1_0000_0000_0000_0000 is too large to be represented by a uint64", errs[4].Error())
+	}
+}
@@ -0,0 +1,209 @@
+package semantics
+
+import (
+	"strings"
+
+	"github.com/kestred/philomath/code/ast"
+	"github.com/kestred/philomath/code/utils"
+)
+
+// resolveOperator determines the meaning of an operator applied to the given
+// operands and returns the type of the operator expression.
+//
+// A builtin operator is always preferred when it is defined for the operand
+// types (eg. "+" on two numbers).  Otherwise the best matching user-defined
+// overload (eg. "_add_ :: (a: Vec, b: Vec) -> Vec") is chosen, and a call to
+// that overload is returned which should be generated in place of the operator.
+func resolveOperator(expr ast.Expr, op *ast.OperatorDefn, overloads []ast.Decl, operands []ast.Expr) (ast.Type, *ast.CallExpr) {
+	types := operandTypes(operands)
+	for _, typ := range types {
+		if isError(typ) {
+			return typ, nil
+		}
+	}
+
+	builtin := inferBuiltinOperator(op, types)
+	if builtin != nil && !isError(builtin) {
+		return builtin, nil
+	}
+
+	best := bestOverloads(overloads, types)
+	if len(best) > 1 {
+		return ast.AmbiguousType, nil
+	} else if len(best) == 1 {
+		proc := overloadProcedure(best[0])
+		name := ast.Ident(op.Overload)
+		name.Decl = best[0]
+		name.Type = proc.Type
+
+		call := ast.CallExp(name, operands)
+		call.Type = proc.Return
+		call.SetParent(expr)
+		name.SetParent(call)
+		return call.Type, call
+	} else if builtin != nil {
+		return builtin, nil
+	}
+
+	// an operator without a builtin or a matching overload is reported when
+	// the types are checked
+	return ast.UncastableType, nil
+}
+
+// inferBuiltinOperator returns the result type of a builtin operator, or nil
+// if the operator has no builtin definition at all.  An error type is returned
+// if the operator is builtin, but is not defined for the operand types.
+func inferBuiltinOperator(op *ast.OperatorDefn, operands []ast.Type) ast.Type {
+	switch op.Type {
+	case ast.UnaryPrefix:
+		return inferPrefixType(op, operands[0])
+	case ast.UnaryPostfix:
+		return inferPostfixType(op, operands[0])
+	case ast.BinaryInfix:
+		return inferInfixType(op, operands[0], operands[1])
+	default:
+		utils.InvalidCodePath()
+		return nil
+	}
+}
+
+// bestOverloads returns the overloads which match the operands most closely;
+// more than one result means that the choice of overload is ambiguous.
+func bestOverloads(overloads []ast.Decl, operands []ast.Type) []ast.Decl {
+	var best []ast.Decl
+	var bestScore int
+	for _, decl := range overloads {
+		score := matchOverload(decl, operands)
+		if score == 0 || score < bestScore {
+			continue
+		} else if score > bestScore {
+			best = best[:0]
+			bestScore = score
+		}
+		best = append(best, decl)
+	}
+	return best
+}
+
+// matchOverload scores how closely the parameters of an overload match the
+// operand types, where an exact match is worth more than an implicit cast;
+// zero is returned if the overload can't be called with the operands.
+func matchOverload(decl ast.Decl, operands []ast.Type) int {
+	proc := overloadProcedure(decl)
+	if proc == nil || len(proc.Params) != len(operands) {
+		return 0
+	}
+
+	score := 0
+	for i, param := range proc.Params {
+		if sameType(param.Type, operands[i]) {
+			score += 2
+		} else if canCastImplicitly(operands[i], param.Type) {
+			score += 1
+		} else {
+			return 0
+		}
+	}
+	return score
+}
+
+func overloadProcedure(decl ast.Decl) *ast.ProcedureExpr {
+	if imm, ok := decl.(*ast.ImmutableDecl); ok {
+		if defn, ok := imm.Defn.(*ast.ConstantDefn); ok {
+			proc, _ := defn.Expr.(*ast.ProcedureExpr)
+			return proc
+		}
+	}
+	return nil
+}
+
+func operandTypes(operands []ast.Expr) []ast.Type {
+	types := make([]ast.Type, len(operands))
+	for i, operand := range operands {
+		types[i] = operand.GetType()
+	}
+	return types
+}
+
+func printTypes(types []ast.Type) string {
+	names := make([]string, len(types))
+	for i, typ := range types {
+		names[i] = typ.Print()
+	}
+	return "(" + strings.Join(names, ", ") + ")"
+}
+
+func sameType(a ast.Type, b ast.Type) bool {
+	switch x := a.(type) {
+	case *ast.NamedType:
+		y, ok := b.(*ast.NamedType)
+		if !ok {
+			return false
+		} else if x.Name.Decl != nil || y.Name.Decl != nil {
+			return x.Name.Decl == y.Name.Decl
+		} else {
+			return x.Name.Literal == y.Name.Literal
+		}
+	case *ast.PointerType:
+		y, ok := b.(*ast.PointerType)
+		return ok && sameType(x.PointerTo, y.PointerTo)
+	case *ast.ArrayType:
+		y, ok := b.(*ast.ArrayType)
+		return ok && sameType(x.Element, y.Element)
+	case *ast.ProcedureType:
+		y, ok := b.(*ast.ProcedureType)
+		if !ok || len(x.Params) != len(y.Params) {
+			return false
+		} else if x.Return == nil || y.Return == nil {
+			if x.Return != y.Return {
+				return false
+			}
+		} else if !sameType(x.Return, y.Return) {
+			return false
+		}
+		for i := range x.Params {
+			if !sameType(x.Params[i], y.Params[i]) {
+				return false
+			}
+		}
+		return true
+	case *ast.TupleType:
+		y, ok := b.(*ast.TupleType)
+		if !ok || len(x.Elements) != len(y.Elements) {
+			return false
+		}
+		for i := range x.Elements {
+			if !sameType(x.Elements[i], y.Elements[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return a == b
+	}
+}
+
+// canCastExplicitly reports whether a value can be converted by a cast
+// expression; any number can be cast to any other number, and a char can be
+// cast to or from an integer.
+func canCastExplicitly(from ast.Type, to ast.Type) bool {
+	if sameType(from, to) {
+		return true
+	} else if from == ast.BuiltinChar {
+		return maybeInteger(to) && to != ast.InferredType
+	} else if to == ast.BuiltinChar {
+		return maybeInteger(from)
+	} else {
+		return maybeNumber(from) && maybeNumber(to) && to != ast.InferredType
+	}
+}
+
+func canCastImplicitly(from ast.Type, to ast.Type) bool {
+	if from == ast.InferredText {
+		return to == ast.BuiltinText
+	} else if maybeNumber(from) && maybeNumber(to) {
+		return castNumbers(from, to) == to
+	} else {
+		return false
+	}
+}
@@ -0,0 +1,157 @@
+package semantics
+
+import (
+	"testing"
+
+	"github.com/kestred/philomath/code/ast"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveOverloads(t *testing.T) {
+	node, errs := checkAny(t, `{
+		Vec :: struct { x: float; y: float; }
+
+		_add_ :: (a: Vec, b: Vec) -> Vec { return a; }
+		_sub_ :: (a: text, b: text) -> text { return a; }
+		neg_ :: (v: Vec) -> Vec { return v; }
+
+		sum :: (a: Vec, b: Vec) {
+			a + b;        // user overload for a user type
+			-a;           // user overload for a prefix operator
+			"ab" - "cd";  // user overload for a builtin type
+			1 + 2.0;      // builtin
+		}
+	}`)
+	assert.Empty(t, errs)
+
+	block := node.(*ast.Block)
+	vecAdd := block.Nodes[1].(*ast.ImmutableDecl)
+	textSub := block.Nodes[2].(*ast.ImmutableDecl)
+	vecNeg := block.Nodes[3].(*ast.ImmutableDecl)
+	sum := block.Nodes[4].(*ast.ImmutableDecl).Defn.(*ast.ConstantDefn).Expr.(*ast.ProcedureExpr)
+
+	stmt0 := sum.Block.Nodes[0].(*ast.EvalStmt).Expr.(*ast.InfixExpr)
+	assert.Equal(t, 1, len(stmt0.Overloads))
+	if assert.NotNil(t, stmt0.Call) {
+		assert.Equal(t, vecAdd, stmt0.Call.Procedure.(*ast.Identifier).Decl)
+		assert.Equal(t, []ast.Expr{stmt0.Left, stmt0.Right}, stmt0.Call.Arguments)
+	}
+	if typ, ok := stmt0.Type.(*ast.NamedType); assert.True(t, ok) {
+		assert.Equal(t, "Vec", typ.Name.Literal)
+	}
+
+	stmt1 := sum.Block.Nodes[1].(*ast.EvalStmt).Expr.(*ast.PrefixExpr)
+	if assert.NotNil(t, stmt1.Call) {
+		assert.Equal(t, vecNeg, stmt1.Call.Procedure.(*ast.Identifier).Decl)
+	}
+
+	stmt2 := sum.Block.Nodes[2].(*ast.EvalStmt).Expr.(*ast.InfixExpr)
+	assert.Equal(t, ast.BuiltinText, stmt2.Type)
+	if assert.NotNil(t, stmt2.Call) {
+		assert.Equal(t, textSub, stmt2.Call.Procedure.(*ast.Identifier).Decl)
+	}
+
+	stmt3 := sum.Block.Nodes[3].(*ast.EvalStmt).Expr.(*ast.InfixExpr)
+	assert.Equal(t, ast.InferredFloat, stmt3.Type)
+	assert.Nil(t, stmt3.Call)
+}
+
+func TestReportOverloadErrors(t *testing.T) {
+	// ambiguous overloads
+	node, errs := checkAny(t, `{
+		Vec :: struct { x: float; }
+		_mul_ :: (a: Vec, b: float) -> Vec { return a; }
+		_mul_ :: (a: Vec, b: f64) -> Vec { return a; }
+		scale :: (v: Vec) { v * 2.0; }
+	}`)
+
+	block := node.(*ast.Block)
+	scale := block.Nodes[3].(*ast.ImmutableDecl).Defn.(*ast.ConstantDefn).Expr.(*ast.ProcedureExpr)
+	expr := scale.Block.Nodes[0].(*ast.EvalStmt).Expr
+	assert.Equal(t, ast.AmbiguousType, expr.GetType())
+	if assert.Equal(t, 1, len(errs)) {
+		assert.Equal(t, "example:5:25: Ambiguous use of operator '*' with operands (Vec, <float>); "+
+			"it could refer to the overload at any of: example:3:3, example:4:3", errs[0].Error())
+	}
+
+	// exact matches are preferred over implicit casts
+	node, errs = checkAny(t, `{
+		Vec :: struct { x: float; }
+		_mul_ :: (a: Vec, b: float) -> Vec { return a; }
+		_mul_ :: (a: Vec, b: f64) -> Vec { return a; }
+		scale :: (v: Vec, s: f64) { v * s; }
+	}`)
+	assert.Empty(t, errs)
+
+	block = node.(*ast.Block)
+	scale = block.Nodes[3].(*ast.ImmutableDecl).Defn.(*ast.ConstantDefn).Expr.(*ast.ProcedureExpr)
+	infix := scale.Block.Nodes[0].(*ast.EvalStmt).Expr.(*ast.InfixExpr)
+	if assert.NotNil(t, infix.Call) {
+		assert.Equal(t, block.Nodes[2], infix.Call.Procedure.(*ast.Identifier).Decl)
+	}
+
+	// missing overloads
+	_, errs = checkAny(t, `{
+		Vec :: struct { x: float; }
+		double :: (v: Vec) { v + v; }
+	}`)
+	if assert.Equal(t, 1, len(errs)) {
+		assert.Equal(t, "example:3:26: The operator '+' is not defined for operands (Vec, Vec); "+
+			`no builtin or overload (eg. "_add_") matches`, errs[0].Error())
+	}
+	// builtin integer operators
+	_, errs = checkAny(t, `{ 7.5 & 1; }`)
+	if assert.Equal(t, 1, len(errs)) {
+		assert.Equal(t, "example:1:7: The operator '&' is not defined for operands (<float>, <number>); "+
+			`no builtin or overload (eg. "_bitand_") matches`, errs[0].Error())
+	}
+
+	// numbers which can't be cast to each other
+	_, errs = checkAny(t, `{
+		a: i64 = 1;
+		b: u64 = 2;
+		a + b;
+		a < b;
+		x: int = 5;
+		x + 0;
+	}`)
+	if assert.Equal(t, 3, len(errs)) {
+		assert.Equal(t, "example:4:5: The operator '+' is not defined for operands (i64, u64); "+
+			`use an explicit cast (eg. "cast(i64) b")`, errs[0].Error())
+		assert.Equal(t, "example:5:5: The operator '<' is not defined for operands (i64, u64); "+
+			`use an explicit cast (eg. "cast(i64) b")`, errs[1].Error())
+		assert.Equal(t, "example:7:5: The operator '+' is not defined for operands (int, <unsigned>); "+
+			`use an explicit cast (eg. "cast(int) b")`, errs[2].Error())
+	}
+
+	// nonsensical casts
+	_, errs = checkAny(t, `{ cast(int) "seven"; }`)
+	if assert.Equal(t, 1, len(errs)) {
+		assert.Equal(t, "example:1:3: A value of type <text> can't be cast to int", errs[0].Error())
+	}
+
+	// compound assignment with a user-defined operator
+	node, errs = checkAny(t, `{
+		Vec :: struct { x: float; }
+		_dot_ :: (a: Vec, b: Vec) -> Vec { return a; }
+		combine :: (v: Vec, w: Vec) { v _dot_= w; v _dot_ w; }
+	}`)
+	assert.Empty(t, errs)
+
+	block = node.(*ast.Block)
+	combine := block.Nodes[2].(*ast.ImmutableDecl).Defn.(*ast.ConstantDefn).Expr.(*ast.ProcedureExpr)
+	assign := combine.Block.Nodes[0].(*ast.AssignStmt)
+	if assert.Equal(t, 1, len(assign.Operations)) && assert.NotNil(t, assign.Operations[0].Call) {
+		assert.Equal(t, block.Nodes[1], assign.Operations[0].Call.Procedure.(*ast.Identifier).Decl)
+	}
+
+	// missing user-defined operators
+	_, errs = checkAny(t, `{
+		Vec :: struct { x: float; }
+		combine :: (v: Vec, w: Vec) { v _dot_= w; }
+	}`)
+	if assert.Equal(t, 1, len(errs)) {
+		assert.Equal(t, "example:3:35: The operator '_dot_' is not defined for operands (Vec, Vec); "+
+			`no overload named "_dot_" accepts them`, errs[0].Error())
+	}
+}
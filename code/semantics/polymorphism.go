@@ -0,0 +1,246 @@
+package semantics
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kestred/philomath/code/ast"
+)
+
+// An instance is a copy of a polymorphic procedure for one set of types; it
+// is resolved and inferred in its own section when it is first called, and
+// the rest of its steps are performed along with the section of that call.
+type instance struct {
+	section Section
+	site    *ast.CallExpr      // the call which created the instance
+	generic *ast.ProcedureExpr // the polymorphic procedure
+}
+
+// Like positions, instances are tracked outside of the nodes.
+var instances = make(map[*ast.ProcedureExpr]*instance)
+
+// instantiate returns the instance of a polymorphic procedure for the types
+// of the arguments of a call, or nil if the types can't be bound.
+func instantiate(call *ast.CallExpr, generic *ast.ProcedureExpr) *ast.ProcedureExpr {
+	types, errs := bindTypes(call, generic)
+	if types == nil || len(errs) > 0 {
+		return nil // the errors are reported during type-checking
+	}
+
+	names := ast.TypeParameters(generic)
+	typeArgs := make([]ast.Type, len(names))
+	for i, name := range names {
+		typeArgs[i] = types[name]
+	}
+
+	// instances are cached, so each set of types is only checked once
+	for _, proc := range generic.Instances {
+		if sameTypes(proc.TypeArgs, typeArgs) {
+			return proc
+		}
+	}
+
+	proc := ast.Substitute(generic, types).(*ast.ProcedureExpr)
+	proc.TypeArgs = typeArgs
+	generic.Instances = append(generic.Instances, proc)
+
+	// the instance is in the same scope as the polymorphic procedure
+	inst := &instance{section: FlattenTree(proc, nil), site: call, generic: generic}
+	proc.SetParent(generic.Parent)
+	instances[proc] = inst
+	ResolveNames(&inst.section)
+	InferTypes(&inst.section)
+	return proc
+}
+
+// checkInstance type-checks the instance created by a call.
+func checkInstance(call *ast.CallExpr) []error {
+	if inst, ok := instances[call.Instance]; ok && inst.site == call {
+		return instanceErrors(inst, CheckTypes(&inst.section))
+	}
+	return nil
+}
+
+// foldInstance folds the constants of the instance created by a call.
+func foldInstance(call *ast.CallExpr) []error {
+	if inst, ok := instances[call.Instance]; ok && inst.site == call {
+		return instanceErrors(inst, FoldConstants(&inst.section))
+	}
+	return nil
+}
+
+// instanceErrors reports the errors in an instance at the call which created
+// it, with the position of each error in the polymorphic procedure as a note.
+func instanceErrors(inst *instance, errs []error) []error {
+	call := inst.site
+	name := call.Procedure.(*ast.Identifier).Literal
+	params := ast.TypeParameters(inst.generic)
+	bindings := make([]string, len(params))
+	for i, typ := range call.Instance.TypeArgs {
+		bindings[i] = params[i] + " = " + typ.Print()
+	}
+
+	wrapped := make([]error, len(errs))
+	for i, err := range errs {
+		inner, ok := err.(*SemanticError)
+		if !ok {
+			wrapped[i] = err
+			continue
+		}
+
+		note := &SemanticError{Pos: inner.Pos, Msg: fmt.Sprintf(`in the definition of "%s"`, name)}
+		wrapped[i] = &SemanticError{
+			Pos:   ast.PositionOf(call),
+			Msg:   fmt.Sprintf(`In "%s" with %s: %s`, name, strings.Join(bindings, ", "), inner.Msg),
+			Notes: append([]*SemanticError{note}, inner.Notes...),
+		}
+	}
+	return wrapped
+}
+
+// bindTypes chooses a type for each type parameter of a polymorphic procedure
+// from the types of the arguments of a call.
+func bindTypes(call *ast.CallExpr, generic *ast.ProcedureExpr) (map[string]ast.Type, []error) {
+	bound, errs := bindArguments(call, generic)
+	if len(errs) > 0 {
+		return nil, nil // the errors are reported by checkCall
+	}
+
+	b := typeBinding{names: ast.TypeParameters(generic), types: make(map[string]ast.Type)}
+	for i, param := range generic.Params {
+		if bound[i] == param.Expr {
+			continue // the default value is only inferred in the instance
+		}
+		if variadic, ok := bound[i].(*ast.VariadicExpr); ok {
+			element := param.Type.(*ast.ArrayType).Element
+			for _, arg := range variadic.Elements {
+				if typ := arg.GetType(); !b.unify(element, typ) {
+					expected := ast.Substitute(element, b.concreteTypes()).(ast.Type)
+					errs = append(errs, errorAt(arg, "A value of type %s can't be used as %s", typ.Print(), expected.Print()))
+				}
+			}
+			continue
+		}
+		if typ := bound[i].GetType(); !b.unify(param.Type, typ) {
+			expected := ast.Substitute(param.Type, b.concreteTypes()).(ast.Type)
+			errs = append(errs, errorAt(bound[i], "A value of type %s can't be used as %s", typ.Print(), expected.Print()))
+		}
+	}
+
+	for _, name := range b.names {
+		if _, ok := b.types[name]; !ok {
+			errs = append(errs, errorAt(call, `Can't infer the type parameter "$%s" from the arguments`, name))
+		}
+	}
+	return b.concreteTypes(), errs
+}
+
+type typeBinding struct {
+	names []string
+	types map[string]ast.Type
+}
+
+func (b *typeBinding) concreteTypes() map[string]ast.Type {
+	types := make(map[string]ast.Type, len(b.types))
+	for name, typ := range b.types {
+		types[name] = concreteType(typ)
+	}
+	return types
+}
+
+// unify matches the type of a parameter with the type of an argument, binding
+// any type parameters in the type of the parameter.
+func (b *typeBinding) unify(param ast.Type, arg ast.Type) bool {
+	if isError(arg) {
+		return true // the error is reported for the argument instead
+	}
+
+	switch p := param.(type) {
+	case *ast.PolymorphicType:
+		return b.bind(p.Name.Literal, arg)
+	case *ast.NamedType:
+		for _, name := range b.names {
+			if name == p.Name.Literal {
+				return b.bind(name, arg)
+			}
+		}
+		return true
+	case *ast.ArrayType:
+		a, ok := arg.(*ast.ArrayType)
+		return ok && b.unify(p.Element, a.Element)
+	case *ast.PointerType:
+		a, ok := arg.(*ast.PointerType)
+		return ok && b.unify(p.PointerTo, a.PointerTo)
+	case *ast.TupleType:
+		a, ok := arg.(*ast.TupleType)
+		return ok && b.unifyAll(p.Elements, a.Elements)
+	case *ast.ProcedureType:
+		a, ok := arg.(*ast.ProcedureType)
+		if !ok || (p.Return == nil) != (a.Return == nil) {
+			return false
+		} else if p.Return != nil && !b.unify(p.Return, a.Return) {
+			return false
+		}
+		return b.unifyAll(p.Params, a.Params)
+	default:
+		return true // the parameter doesn't have any type parameters
+	}
+}
+
+func (b *typeBinding) unifyAll(params []ast.Type, args []ast.Type) bool {
+	if len(params) != len(args) {
+		return false
+	}
+	for i := range params {
+		if !b.unify(params[i], args[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// bind binds a type parameter to a type; a type parameter which is already
+// bound may be widened (eg. from "<number>" to "f64"), but not changed.
+func (b *typeBinding) bind(name string, typ ast.Type) bool {
+	bound, ok := b.types[name]
+	switch {
+	case !ok:
+		b.types[name] = typ
+	case sameType(typ, bound), canCastImplicitly(typ, bound):
+		break
+	case canCastImplicitly(bound, typ):
+		b.types[name] = typ
+	default:
+		return false
+	}
+	return true
+}
+
+// concreteType chooses a type for the value of a literal (eg. "<number>" is
+// bound as an "int").
+func concreteType(typ ast.Type) ast.Type {
+	switch typ {
+	case ast.InferredNumber, ast.InferredSigned:
+		return ast.BuiltinInt
+	case ast.InferredUnsigned:
+		return ast.BuiltinUint
+	case ast.InferredFloat:
+		return ast.BuiltinFloat
+	case ast.InferredText:
+		return ast.BuiltinText
+	default:
+		return typ
+	}
+}
+
+func sameTypes(a []ast.Type, b []ast.Type) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !sameType(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
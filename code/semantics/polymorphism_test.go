@@ -0,0 +1,61 @@
+package semantics
+
+import (
+	"testing"
+
+	"github.com/kestred/philomath/code/ast"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstantiatePolymorphicProcedures(t *testing.T) {
+	node, errs := checkAny(t, `{
+		sum :: (a: $T, b: T) -> T { return a + b; }
+		sum(1, 2);
+		sum(1.5, 2);
+		sum(3, 4);
+	}`)
+	assert.Empty(t, errs)
+
+	block := node.(*ast.Block)
+	generic := block.Nodes[0].(*ast.ImmutableDecl).Defn.(*ast.ConstantDefn).Expr.(*ast.ProcedureExpr)
+	call := func(i int) *ast.CallExpr {
+		return block.Nodes[i].(*ast.EvalStmt).Expr.(*ast.CallExpr)
+	}
+
+	// a literal is bound as its default type, and may be widened by a later argument
+	assert.Equal(t, ast.BuiltinInt, call(1).Type)
+	assert.Equal(t, ast.BuiltinFloat, call(2).Type)
+	assert.Equal(t, []ast.Type{ast.BuiltinInt}, call(1).Instance.TypeArgs)
+	assert.Equal(t, ast.BuiltinFloat, call(2).Instance.Params[1].Type)
+
+	// instances are cached for each set of types
+	assert.Equal(t, 2, len(generic.Instances))
+	assert.True(t, call(1).Instance == call(3).Instance)
+	assert.False(t, call(1).Instance.Block == generic.Block)
+	assert.Equal(t, ast.BuiltinInt, call(1).Instance.Block.Nodes[0].(*ast.ReturnStmt).Value.GetType())
+}
+
+func TestCheckPolymorphicProcedures(t *testing.T) {
+	_, errs := checkAny(t, `{
+		neg :: (v: $T) -> T {
+			return -v;
+		}
+		pair :: (a: $T, b: T) {}
+		zero :: () -> $T {}
+
+		neg(2);
+		neg("two");
+		neg("three");
+		pair(1, "one");
+		zero();
+		f := neg;
+	}`)
+	if assert.Equal(t, 4, len(errs)) {
+		assert.Equal(t, "example:9:3: In \"neg\" with T = text: The operator '-' is not defined for operands (text); "+
+			"no builtin or overload (eg. \"neg_\") matches\n"+
+			"example:3:11: note: in the definition of \"neg\"", errs[0].Error())
+		assert.Equal(t, "example:11:11: A value of type <text> can't be used as int", errs[1].Error())
+		assert.Equal(t, "example:12:3: Can't infer the type parameter \"$T\" from the arguments", errs[2].Error())
+		assert.Equal(t, "example:13:8: The polymorphic procedure \"neg\" can't be used as a value", errs[3].Error())
+	}
+}
@@ -13,7 +13,10 @@ func ResolveNames(cs *Section) {
 
 	current := FindParentScope(cs.Root)
 	var lookup = make(map[ScopedName]ast.Decl)
-	for _, node := range cs.Nodes {
+	var overloads = make(map[ScopedName][]ast.Decl)
+	for i := 0; i < len(cs.Nodes); i++ {
+		node := cs.Nodes[i]
+
 		// Track the current scope by always updating the current scope if we reach
 		// a node and that node's parent provides a scope.
 		//
@@ -24,7 +27,11 @@ func ResolveNames(cs *Section) {
 
 		switch n := node.(type) {
 		case *ast.ImmutableDecl:
-			lookup[ScopedName{current, n.Name.Literal}] = n
+			name := ScopedName{current, n.Name.Literal}
+			lookup[name] = n
+			if ast.IsOverloadName(name.Name) {
+				overloads[name] = append(overloads[name], n)
+			}
 		case *ast.MutableDecl:
 			lookup[ScopedName{current, n.Name.Literal}] = n
 		case *ast.Identifier:
@@ -32,19 +39,61 @@ func ResolveNames(cs *Section) {
 			for {
 				if decl, ok := lookup[ScopedName{search, n.Literal}]; ok {
 					n.Decl = decl
+					captureVariables(n)
 					break
 				} else if search == nil {
+					if decl := findOuterDeclaration(cs.Root, n.Literal); decl != nil {
+						n.Decl = decl
+						captureVariables(n)
+						break
+					}
+					if decl, ok := targetConstants[n.Literal]; ok {
+						n.Decl = decl
+						break
+					}
 					utils.NotImplemented("Name resolution for out-of-order declarations")
 				} else {
 					search = FindParentScope(search)
 				}
 			}
+
+		// the condition of an "#if" has already been resolved, so the chosen block
+		// is added to the section; the nodes of the other block are never visited
+		case *ast.IfDirective:
+			if chosen := chooseBlock(n); chosen != nil {
+				var nodes []ast.Node
+				chosen.SetParent(n)
+				for _, subnode := range chosen.Nodes {
+					// the declarations of the chosen block belong to the enclosing scope
+					nodes = append(nodes, flattenTree(subnode, n.GetParent())...)
+				}
+				rest := append(nodes, cs.Nodes[i+1:]...)
+				cs.Nodes = append(cs.Nodes[:i+1], rest...)
+			}
+
+		// operators may refer to any of the visible overloads for their operator;
+		// choosing between them must wait for type inference
+		case *ast.PostfixExpr:
+			n.Overloads = findOverloads(overloads, current, n.Operator)
+		case *ast.InfixExpr:
+			n.Overloads = findOverloads(overloads, current, n.Operator)
+		case *ast.PrefixExpr:
+			n.Overloads = findOverloads(overloads, current, n.Operator)
 		}
 	}
 
 	cs.StepsCompleted |= Step_ResolveNames
 }
 
+func findOverloads(overloads map[ScopedName][]ast.Decl, scope ast.Scope, op *ast.OperatorDefn) []ast.Decl {
+	var found []ast.Decl
+	for scope != nil {
+		found = append(found, overloads[ScopedName{scope, op.Overload}]...)
+		scope = FindParentScope(scope)
+	}
+	return found
+}
+
 func FindParentScope(node ast.Node) ast.Scope {
 	node = node.GetParent()
 	for node != nil {
@@ -56,3 +105,48 @@ func FindParentScope(node ast.Node) ast.Scope {
 
 	return nil
 }
+
+// findOuterDeclaration finds a declaration in the scopes enclosing a section
+// (eg. for the instance of a polymorphic procedure), which have already been
+// resolved by the section containing them.
+func findOuterDeclaration(root ast.Node, name string) ast.Decl {
+	for scope := FindParentScope(root); scope != nil; scope = FindParentScope(scope) {
+		var decls []ast.Decl
+		switch s := scope.(type) {
+		case *ast.TopScope:
+			decls = s.Decls
+		case *ast.Block:
+			for _, node := range s.Nodes {
+				if destructure, ok := node.(*ast.DestructureStmt); ok {
+					for _, decl := range destructure.Decls {
+						decls = append(decls, decl)
+					}
+				} else if decl, ok := node.(ast.Decl); ok {
+					decls = append(decls, decl)
+				}
+			}
+		case *ast.ProcedureExpr:
+			for _, param := range s.Params {
+				decls = append(decls, param)
+			}
+		}
+
+		for _, decl := range decls {
+			if ident := decl.GetName(); ident != nil && ident.Literal == name {
+				return decl
+			}
+		}
+	}
+	return nil
+}
+
+// findProcedure returns the innermost procedure containing a node, or nil if
+// the node isn't inside of a procedure.
+func findProcedure(node ast.Node) *ast.ProcedureExpr {
+	for node = node.GetParent(); node != nil; node = node.GetParent() {
+		if proc, ok := node.(*ast.ProcedureExpr); ok {
+			return proc
+		}
+	}
+	return nil
+}
@@ -9,6 +9,7 @@ const (
 	Step_ResolveNames Step = 1 << iota
 	Step_InferTypes
 	Step_CheckTypes
+	Step_FoldConstants
 )
 
 type Section struct {
@@ -47,6 +48,15 @@ func flattenTree(node ast.Node, parent ast.Node) []ast.Node {
 		for _, subnode := range n.Nodes {
 			nodes = append(nodes, flattenTree(subnode, n)...)
 		}
+	case *ast.IfDirective:
+		// the condition is resolved before choosing a block (see ResolveNames),
+		// so it is flattened before the directive and neither block is included
+		nodes = append(flattenTree(n.Cond, n), n)
+	case *ast.AssertDirective:
+		nodes = append(nodes, flattenTree(n.Cond, n)...)
+		if n.Message != nil {
+			nodes = append(nodes, flattenTree(n.Message, n)...)
+		}
 	case *ast.AsmBlock:
 		for _, binding := range n.Inputs {
 			nodes = append(nodes, binding.Name)
@@ -69,6 +79,12 @@ func flattenTree(node ast.Node, parent ast.Node) []ast.Node {
 	// definitions
 	case *ast.ConstantDefn:
 		nodes = append(nodes, flattenTree(n.Expr, n)...)
+	case *ast.StructDefn:
+		for _, field := range n.Fields {
+			nodes = append(nodes, flattenTree(field, n)...)
+		}
+	case *ast.StructField:
+		nodes = append(nodes, flattenTree(n.Type, n)...)
 
 	// statements
 	case *ast.EvalStmt:
@@ -80,8 +96,28 @@ func flattenTree(node ast.Node, parent ast.Node) []ast.Node {
 		for _, expr := range n.Right {
 			nodes = append(nodes, flattenTree(expr, n)...)
 		}
+		for _, operation := range n.Operations {
+			// the operations share their operands, so don't flatten them twice
+			operation.SetParent(n)
+			nodes = append(nodes, operation, operation.Operator)
+		}
+	case *ast.DeferStmt:
+		nodes = append(nodes, flattenTree(n.Stmt, n)...)
+	case *ast.WhileStmt:
+		nodes = append(nodes, flattenTree(n.Cond, n)...)
+		nodes = append(nodes, flattenTree(n.Do, n)...)
+	case *ast.DoneStmt:
+		break // nothing to add
 	case *ast.ReturnStmt:
-		nodes = append(nodes, flattenTree(n.Value, n)...)
+		if n.Value != nil {
+			nodes = append(nodes, flattenTree(n.Value, n)...)
+		}
+	case *ast.DestructureStmt:
+		// the value is resolved before the names that it declares
+		nodes = append(nodes, flattenTree(n.Expr, n)...)
+		for _, decl := range n.Decls {
+			nodes = append(nodes, flattenTree(decl, n)...)
+		}
 
 	// expressions
 	case *ast.PostfixExpr:
@@ -91,13 +127,50 @@ func flattenTree(node ast.Node, parent ast.Node) []ast.Node {
 		nodes = append(nodes, flattenTree(n.Left, n)...)
 		nodes = append(nodes, n.Operator)
 		nodes = append(nodes, flattenTree(n.Right, n)...)
+	case *ast.ComparisonExpr:
+		for _, operand := range n.Operands {
+			nodes = append(nodes, flattenTree(operand, n)...)
+		}
+		for _, cmp := range n.Comparisons {
+			// the comparisons share their operands, so don't flatten them twice
+			cmp.SetParent(n)
+			nodes = append(nodes, cmp, cmp.Operator)
+		}
+	case *ast.ExprRange:
+		nodes = append(nodes, flattenTree(n.Min, n)...)
+		nodes = append(nodes, flattenTree(n.Max, n)...)
 	case *ast.PrefixExpr:
 		nodes = append(nodes, n.Operator)
 		nodes = append(nodes, flattenTree(n.Subexpr, n)...)
+	case *ast.CastExpr:
+		nodes = append(nodes, flattenTree(n.Target, n)...)
+		nodes = append(nodes, flattenTree(n.Subexpr, n)...)
 	case *ast.GroupExpr:
 		nodes = append(nodes, flattenTree(n.Subexpr, n)...)
+	case *ast.IndexExpr:
+		nodes = append(nodes, flattenTree(n.Left, n)...)
+		nodes = append(nodes, flattenTree(n.Index, n)...)
+	case *ast.MemberExpr:
+		nodes = append(nodes, flattenTree(n.Left, n)...) // the member is resolved by its type
+	case *ast.TupleExpr:
+		for _, element := range n.Elements {
+			nodes = append(nodes, flattenTree(element, n)...)
+		}
+	case *ast.RunExpr:
+		if n.Block != nil {
+			nodes = append(nodes, flattenTree(n.Block, n)...)
+		} else {
+			nodes = append(nodes, flattenTree(n.Subexpr, n)...)
+		}
 	case *ast.ProcedureExpr:
-		nodes = append(nodes, n.Return)
+		if ast.IsPolymorphic(n) {
+			break // each instance is flattened into its own section (see instantiate)
+		}
+		if _, ok := n.Return.(*ast.BaseType); ok || n.Return == nil {
+			nodes = append(nodes, n.Return) // builtin types are shared, so they don't have a parent
+		} else {
+			nodes = append(nodes, flattenTree(n.Return, n)...)
+		}
 		for _, param := range n.Params {
 			nodes = append(nodes, flattenTree(param, n)...)
 		}
@@ -111,7 +184,8 @@ func flattenTree(node ast.Node, parent ast.Node) []ast.Node {
 	// literals
 	case *ast.Identifier,
 		*ast.NumberLiteral,
-		*ast.TextLiteral:
+		*ast.TextLiteral,
+		*ast.CharLiteral:
 		break // nothing to add
 
 		// types
@@ -119,7 +193,22 @@ func flattenTree(node ast.Node, parent ast.Node) []ast.Node {
 		nodes = append(nodes, n.Name)
 	case *ast.ArrayType:
 		nodes = append(nodes, flattenTree(n.Element, n)...)
-		nodes = append(nodes, flattenTree(n.Length, n)...)
+		if n.Length != nil {
+			nodes = append(nodes, flattenTree(n.Length, n)...)
+		}
+	case *ast.PointerType:
+		nodes = append(nodes, flattenTree(n.PointerTo, n)...)
+	case *ast.ProcedureType:
+		for _, param := range n.Params {
+			nodes = append(nodes, flattenTree(param, n)...)
+		}
+		if n.Return != nil {
+			nodes = append(nodes, flattenTree(n.Return, n)...)
+		}
+	case *ast.TupleType:
+		for _, element := range n.Elements {
+			nodes = append(nodes, flattenTree(element, n)...)
+		}
 	case *ast.BaseType:
 		break // nothing to add
 
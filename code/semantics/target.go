@@ -0,0 +1,46 @@
+package semantics
+
+import (
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/kestred/philomath/code/ast"
+)
+
+// The target constants describe the platform that a program is compiled for
+// (eg. "#if OS == OS_LINUX { ... }"); like builtin types, they are visible
+// from every scope unless a declaration hides them.
+var targetConstants = make(map[string]*ast.ImmutableDecl)
+
+func init() {
+	systems := []string{"linux", "darwin", "windows", "freebsd"}
+	architectures := []string{"amd64", "arm64", "386", "arm"}
+
+	defineTarget("OS", strconv.Itoa(indexOf(systems, runtime.GOOS)+1))
+	for i, name := range systems {
+		defineTarget("OS_"+strings.ToUpper(name), strconv.Itoa(i+1))
+	}
+	defineTarget("ARCH", strconv.Itoa(indexOf(architectures, runtime.GOARCH)+1))
+	for i, name := range architectures {
+		defineTarget("ARCH_"+strings.ToUpper(name), strconv.Itoa(i+1))
+	}
+	defineTarget("POINTER_SIZE", strconv.Itoa(strconv.IntSize/8))
+}
+
+func defineTarget(name string, literal string) {
+	decl := ast.Immutable(name, ast.Constant(ast.NumLit(literal)))
+	inferTypesRecursive(decl)
+	targetConstants[name] = decl
+}
+
+// indexOf returns the index of a name in a list, or -1 for an unknown name
+// (so that an unknown platform is 0 and doesn't match any of the constants).
+func indexOf(names []string, name string) int {
+	for i, n := range names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
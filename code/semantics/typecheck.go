@@ -1,16 +1,450 @@
 package semantics
 
-import "github.com/kestred/philomath/code/utils"
+import (
+	"strings"
 
-// TODO: implement most types of type checking (so far I only check # of arguments in procedure calls)
+	"github.com/kestred/philomath/code/ast"
+	"github.com/kestred/philomath/code/utils"
+)
+
+// TODO: implement most types of type checking (so far I only check uses of operators)
 
 func CheckTypes(cs *Section) []error {
 	utils.Assert(!cs.DidSteps(Step_CheckTypes), "Tried to run type-checking twice on the same code section")
 	utils.Assert(cs.DidSteps(Step_InferTypes), "Tried to run type-checking before type inference")
 	utils.Assert(cs.DidSteps(Step_ResolveNames), "Tried to run type-checking before name resolution")
 
-	// TODO: move error printing out from parser and into its own module; then add source ranges to AST nodes
+	var errs []error
+	for _, node := range cs.Nodes {
+		switch n := node.(type) {
+		case *ast.PostfixExpr:
+			errs = append(errs, checkOperator(n, n.Operator, n.Overloads, []ast.Expr{n.Subexpr})...)
+		case *ast.InfixExpr:
+			errs = append(errs, checkOperator(n, n.Operator, n.Overloads, []ast.Expr{n.Left, n.Right})...)
+			if n.Operator.Precedence == ast.ComparisonPrec && n.Call != nil && n.Type != ast.BuiltinBool {
+				errs = append(errs, errorAt(n, "The overload of '%s' for operands %s must return a bool, but returns %s",
+					n.Operator.Literal, printTypes(operandTypes([]ast.Expr{n.Left, n.Right})), n.Type.Print()))
+			}
+		case *ast.ExprRange:
+			bounds := []ast.Expr{n.Min, n.Max}
+			if n.Type == ast.UncastableType && !isError(n.Min.GetType()) && !isError(n.Max.GetType()) {
+				errs = append(errs, errorAt(n, "The bounds of a range must be numbers of compatible types, but found %s",
+					printTypes(operandTypes(bounds))))
+			}
+		case *ast.PrefixExpr:
+			errs = append(errs, checkOperator(n, n.Operator, n.Overloads, []ast.Expr{n.Subexpr})...)
+		case *ast.IfDirective:
+			if n.Chosen == nil {
+				errs = append(errs, checkCondition(n)...)
+			}
+		case *ast.ReturnStmt:
+			if isDeferred(n) {
+				errs = append(errs, errorAt(n, `A deferred statement can't return (eg. "defer { return; }")`))
+			} else if proc := findProcedure(n); proc != nil {
+				errs = append(errs, checkReturn(n, proc)...)
+			}
+		case *ast.WhileStmt:
+			if typ := n.Cond.GetType(); !isError(typ) && typ != ast.BuiltinBool {
+				errs = append(errs, errorAt(n.Cond, `The condition of "while" must be a bool, but has type %s`, typ.Print()))
+			}
+		case *ast.DoneStmt:
+			errs = append(errs, checkDone(n)...)
+		case *ast.DestructureStmt:
+			errs = append(errs, checkDestructure(n)...)
+		case *ast.AssignStmt:
+			errs = append(errs, checkAssignment(n)...)
+		case *ast.MutableDecl:
+			if proc, ok := n.Parent.(*ast.ProcedureExpr); ok && n.Expr != nil {
+				errs = append(errs, checkDefault(n, proc)...)
+			}
+			if n.Expr != nil && !isError(n.Expr.GetType()) && !sameType(n.Expr.GetType(), n.Type) {
+				// TODO: check the types of other declarations
+				_, isProc := n.Type.(*ast.ProcedureType)
+				_, isProcValue := n.Expr.GetType().(*ast.ProcedureType)
+				if isProc || isProcValue {
+					errs = append(errs, errorAt(n.Expr, "A value of type %s can't be used as %s",
+						n.Expr.GetType().Print(), n.Type.Print()))
+				}
+			}
+		case *ast.CallExpr:
+			if tuple, ok := n.Type.(*ast.TupleType); ok && !canUseValues(n) {
+				errs = append(errs, errorAt(n, `A call with %d return values must be assigned to as many names (eg. "a, b := f();")`,
+					len(tuple.Elements)))
+			}
+			errs = append(errs, checkCall(n)...)
+		case *ast.Identifier:
+			if proc := overloadProcedure(n.Decl); proc != nil && ast.IsPolymorphic(proc) && !isCallee(n) && n != n.Decl.GetName() {
+				errs = append(errs, errorAt(n, `The polymorphic procedure "%s" can't be used as a value`, n.Literal))
+			}
+			if run := findDirective(n); run != nil && isRuntimeVariable(n.Decl, run) {
+				if _, ok := run.Parent.(*ast.AssertDirective); ok {
+					errs = append(errs, errorAt(n, "#assert condition must be a compile-time constant"))
+				} else {
+					errs = append(errs, errorAt(n, "#run cannot reference runtime variable '%s'", n.Literal))
+				}
+			} else if decl := findConstant(n); decl != nil && isRuntimeVariable(n.Decl, nil) {
+				errs = append(errs, errorAt(n, "value of constant '%s' is not known at compile time", decl.Name.Literal))
+			}
+		case *ast.IndexExpr:
+			if n.Type == ast.UncastableType {
+				if _, ok := n.Left.GetType().(*ast.ArrayType); !ok && !isText(n.Left.GetType()) {
+					errs = append(errs, errorAt(n, "A value of type %s can't be indexed", n.Left.GetType().Print()))
+				} else {
+					errs = append(errs, errorAt(n.Index, "An index must be an integer, but has type %s", n.Index.GetType().Print()))
+				}
+			}
+		case *ast.MemberExpr:
+			if n.Type == ast.UncastableType {
+				errs = append(errs, errorAt(n, `A value of type %s has no member "%s"`, n.Left.GetType().Print(), n.Member.Literal))
+			}
+		case *ast.AssertDirective:
+			if typ := n.Cond.GetType(); typ != ast.BuiltinBool && !isError(typ) {
+				errs = append(errs, errorAt(n, `The condition of "#assert" must be a bool, but has type %s`, typ.Print()))
+			}
+		case *ast.NumberLiteral:
+			if _, _, err := parseNumber(n); err != nil {
+				errs = append(errs, errorAt(n, "%s", err.Error()))
+			}
+		case *ast.CastExpr:
+			if n.Type == ast.UncastableType && !isError(n.Subexpr.GetType()) {
+				errs = append(errs, errorAt(n, "A value of type %s can't be cast to %s",
+					n.Subexpr.GetType().Print(), n.Target.Print()))
+			}
+		}
+	}
 
 	cs.StepsCompleted |= Step_CheckTypes
+	return errs
+}
+
+// checkCall checks the arguments of a call; a call to a procedure constant
+// may use named and default arguments, but a call through a procedure value
+// (eg. a parameter "f: (int) -> int") only knows the types of its parameters.
+func checkCall(n *ast.CallExpr) []error {
+	if name, ok := n.Procedure.(*ast.Identifier); ok {
+		if proc := overloadProcedure(name.Decl); proc != nil && ast.IsPolymorphic(proc) {
+			if n.Instance == nil {
+				_, errs := bindTypes(n, proc)
+				if errs == nil {
+					_, errs = bindArguments(n, proc)
+				}
+				return errs
+			}
+			return append(checkArguments(n, n.Instance), checkInstance(n)...)
+		} else if proc != nil {
+			return checkArguments(n, proc)
+		}
+	}
+
+	typ := n.Procedure.GetType()
+	procType, ok := typ.(*ast.ProcedureType)
+	if !ok {
+		if isError(typ) {
+			return nil // the error is reported for the procedure instead
+		}
+		return []error{errorAt(n, "A value of type %s can't be called", typ.Print())}
+	}
+
+	for i, name := range n.Names {
+		if name != nil {
+			return []error{errorAt(n.Arguments[i], "Named arguments can't be used when calling a procedure value")}
+		}
+	}
+
+	args := n.Arguments
+	if procType.Variadic {
+		if n.Bound == nil {
+			return []error{errorAt(n, "Expected at least %d arguments %s, but found %d",
+				len(procType.Params)-1, printTypes(procType.Params[:len(procType.Params)-1]), len(n.Arguments))}
+		}
+		args = n.Bound
+	} else if len(n.Arguments) != len(procType.Params) {
+		return []error{errorAt(n, "Expected %d arguments %s, but found %d",
+			len(procType.Params), printTypes(procType.Params), len(n.Arguments))}
+	}
+	if n.Spread && (!procType.Variadic || len(args) != len(n.Arguments)) {
+		return []error{errorAt(n.Arguments[len(n.Arguments)-1], "Only the argument for a variadic parameter can be spread")}
+	}
+
+	var errs []error
+	for i, arg := range args {
+		typ, param := arg.GetType(), procType.Params[i]
+		if procType.Variadic && i == len(args)-1 {
+			errs = append(errs, checkVariadic(arg, param.(*ast.ArrayType))...)
+		} else if !isError(typ) && !sameType(typ, param) && !canCastImplicitly(typ, param) {
+			errs = append(errs, errorAt(arg, "A value of type %s can't be used as %s", typ.Print(), param.Print()))
+		}
+	}
+	return errs
+}
+
+// checkArguments checks the arguments of a call to a procedure constant.
+func checkArguments(n *ast.CallExpr, proc *ast.ProcedureExpr) []error {
+	bound, errs := bindArguments(n, proc)
+	if variadic := variadicIndex(proc); variadic >= 0 && len(errs) == 0 {
+		errs = checkVariadic(bound[variadic], proc.Params[variadic].Type.(*ast.ArrayType))
+	}
+	return errs
+}
+
+// isDeferred reports whether a statement is part of a deferred statement in
+// the same procedure.
+func isDeferred(n ast.Node) bool {
+	for node := n.GetParent(); node != nil; node = node.GetParent() {
+		switch node.(type) {
+		case *ast.DeferStmt:
+			return true
+		case *ast.ProcedureExpr:
+			return false
+		}
+	}
+	return false
+}
+
+// findDirective returns the "#run" (or the condition of an "#assert") which
+// a node is evaluated by during compilation, if any.
+func findDirective(n ast.Node) *ast.RunExpr {
+	for node := n.GetParent(); node != nil; node = node.GetParent() {
+		if run, ok := node.(*ast.RunExpr); ok {
+			return run
+		}
+	}
 	return nil
 }
+
+// findConstant returns the constant declaration whose value contains a node;
+// the body of a procedure (and a directive) is evaluated separately.
+func findConstant(n ast.Node) *ast.ImmutableDecl {
+	for node := n.GetParent(); node != nil; node = node.GetParent() {
+		switch node := node.(type) {
+		case *ast.ImmutableDecl:
+			return node
+		case *ast.ProcedureExpr, *ast.RunExpr:
+			return nil
+		}
+	}
+	return nil
+}
+
+// isRuntimeVariable reports whether a declaration is a variable which only
+// has a value at runtime, rather than while a directive is evaluated.
+func isRuntimeVariable(decl ast.Decl, run *ast.RunExpr) bool {
+	if _, ok := decl.(*ast.MutableDecl); !ok {
+		return false
+	}
+	for node := decl.GetParent(); node != nil; node = node.GetParent() {
+		if node == run {
+			return false // declared by the directive itself
+		}
+	}
+	return true
+}
+
+// isCallee reports whether an identifier is the procedure of a call.
+func isCallee(n *ast.Identifier) bool {
+	call, ok := n.Parent.(*ast.CallExpr)
+	return ok && call.Procedure == n
+}
+
+func checkReturn(n *ast.ReturnStmt, proc *ast.ProcedureExpr) []error {
+	if tuple, ok := proc.Return.(*ast.TupleType); ok {
+		return checkValues(n, tuple.Elements, n.Value, "return values")
+	} else if tuple, ok := n.Value.(*ast.TupleExpr); ok {
+		return []error{errorAt(n, "Expected 1 return value, but found %d", len(tuple.Elements))}
+	} else if proc.Return == ast.InferredType {
+		return nil // TODO: infer the return type of procedures
+	}
+	return checkValues(n, []ast.Type{proc.Return}, n.Value, "return value")
+}
+
+// checkDone checks that "done" is in a loop of the same procedure, and that
+// it isn't deferred within the loop.
+func checkDone(n *ast.DoneStmt) []error {
+	for node := n.GetParent(); node != nil; node = node.GetParent() {
+		switch node.(type) {
+		case *ast.WhileStmt:
+			return nil
+		case *ast.DeferStmt:
+			return []error{errorAt(n, `A deferred statement can't leave a loop (eg. "defer { done; }")`)}
+		case *ast.ProcedureExpr:
+			return []error{errorAt(n, `"done" can only be used in a loop`)}
+		}
+	}
+	return []error{errorAt(n, `"done" can only be used in a loop`)}
+}
+
+func checkDestructure(n *ast.DestructureStmt) []error {
+	typ := n.Expr.GetType()
+	if isError(typ) {
+		return nil // the error is reported for the value instead
+	}
+
+	found := 1
+	if tuple, ok := typ.(*ast.TupleType); ok {
+		found = len(tuple.Elements)
+	}
+	if found != len(n.Decls) {
+		return []error{errorAt(n, "Expected %d values to declare, but found %d", len(n.Decls), found)}
+	}
+	return nil
+}
+
+// checkAssignment checks the number and types of the values assigned to each
+// name; a name declared with a literal has the type it is given at runtime
+// (eg. "a := 5" is an int).
+func checkAssignment(n *ast.AssignStmt) []error {
+	expected := make([]ast.Type, len(n.Left))
+	for i, expr := range n.Left {
+		expected[i] = concreteType(expr.GetType())
+	}
+	if len(n.Right) == 1 {
+		if _, ok := n.Right[0].GetType().(*ast.TupleType); ok {
+			return checkValues(n, expected, n.Right[0], "values to assign")
+		}
+	}
+
+	found := 0
+	for _, expr := range n.Right {
+		if tuple, ok := expr.GetType().(*ast.TupleType); ok {
+			found += len(tuple.Elements)
+		} else {
+			found += 1
+		}
+	}
+	if found != len(n.Left) {
+		return []error{errorAt(n, "Expected %d values to assign, but found %d", len(n.Left), found)}
+	} else if n.Operator != nil || found != len(n.Right) {
+		return nil // the operations of a compound assignment are checked instead
+	}
+	return checkValueTypes(n, expected, n.Right, operandTypes(n.Right))
+}
+
+// checkValues checks the number and types of the values of an expression,
+// which may have multiple values (eg. "x, ok" or "f()" where "f" returns a tuple).
+func checkValues(stmt ast.Node, expected []ast.Type, value ast.Expr, what string) []error {
+	var values []ast.Expr
+	var found []ast.Type
+	if tuple, ok := value.(*ast.TupleExpr); ok {
+		values = tuple.Elements
+		found = operandTypes(tuple.Elements)
+	} else if value != nil {
+		if tuple, ok := value.GetType().(*ast.TupleType); ok {
+			found = tuple.Elements
+		} else {
+			values = []ast.Expr{value}
+			found = []ast.Type{value.GetType()}
+		}
+	}
+
+	for _, typ := range append(found, expected...) {
+		if isError(typ) {
+			return nil // the error is reported for the value instead
+		}
+	}
+	if len(found) != len(expected) {
+		return []error{errorAt(stmt, "Expected %d %s %s, but found %d", len(expected), what, printTypes(expected), len(found))}
+	}
+	return checkValueTypes(stmt, expected, values, found)
+}
+
+// checkValueTypes checks that each value can be used as the expected type;
+// the values of a call (which has multiple return values) are reported once.
+func checkValueTypes(stmt ast.Node, expected []ast.Type, values []ast.Expr, found []ast.Type) []error {
+	var errs []error
+	for i, typ := range found {
+		if isError(typ) || isError(expected[i]) || sameType(typ, expected[i]) || canCastImplicitly(typ, expected[i]) {
+			continue
+		} else if values == nil {
+			return []error{errorAt(stmt, "Values of types %s can't be used as %s", printTypes(found), printTypes(expected))}
+		}
+		errs = append(errs, errorAt(values[i], "A value of type %s can't be used as %s", typ.Print(), expected[i].Print()))
+	}
+	return errs
+}
+
+// canUseValues reports whether the parent of an expression with multiple
+// values accepts all of them.
+func canUseValues(expr ast.Expr) bool {
+	switch expr.GetParent().(type) {
+	case *ast.DestructureStmt, *ast.AssignStmt, *ast.ReturnStmt, *ast.EvalStmt:
+		return true // the number of values is checked by the statement
+	default:
+		return false
+	}
+}
+
+// checkCondition explains why a block couldn't be chosen for an "#if".
+func checkCondition(n *ast.IfDirective) []error {
+	typ := n.Cond.GetType()
+	if isError(typ) {
+		return nil // the error is reported for the condition instead
+	} else if typ != ast.BuiltinBool {
+		return []error{errorAt(n, `The condition of "#if" must be a bool, but has type %s`, typ.Print())}
+	}
+
+	// report why the condition couldn't be folded, if it is known
+	f := &folder{visited: make(map[ast.Expr]bool)}
+	if _, ok := f.fold(n.Cond); !ok && len(f.errs) > 0 {
+		return f.errs
+	}
+	return []error{errorAt(n, `The condition of "#if" must be a constant known at compile-time`)}
+}
+
+func checkOperator(expr ast.Expr, op *ast.OperatorDefn, overloads []ast.Decl, operands []ast.Expr) []error {
+	types := operandTypes(operands)
+	for _, typ := range types {
+		if isError(typ) {
+			return nil // the error is reported for the operand instead
+		}
+	}
+
+	switch expr.GetType() {
+	case ast.AmbiguousType:
+		best := bestOverloads(overloads, types)
+		places := make([]string, len(best))
+		for i, decl := range best {
+			places[i] = ast.PositionOf(decl).String()
+		}
+		return []error{errorAt(expr,
+			"Ambiguous use of operator '%s' with operands %s; it could refer to the overload at any of: %s",
+			op.Literal, printTypes(types), strings.Join(places, ", "))}
+	case ast.UncastableType:
+		if inferBuiltinOperator(op, types) == nil {
+			return []error{errorAt(expr,
+				"The operator '%s' is not defined for operands %s; no overload named \"%s\" accepts them",
+				op.Literal, printTypes(types), op.Overload)}
+		}
+		for _, typ := range types {
+			if !maybeNumber(typ) || (isIntegerOperator(op) && !maybeInteger(typ)) {
+				return []error{errorAt(expr,
+					"The operator '%s' is not defined for operands %s; no builtin or overload (eg. \"%s\") matches",
+					op.Literal, printTypes(types), op.Overload)}
+			}
+		}
+
+		// the operands are numbers, but neither can be cast to the other
+		return []error{errorAt(expr,
+			"The operator '%s' is not defined for operands %s; use an explicit cast (eg. \"cast(%s) b\")",
+			op.Literal, printTypes(types), types[0].Print())}
+	}
+
+	return nil
+}
+
+// isIntegerOperator reports whether a builtin operator is only defined for
+// integers (eg. "%", "&", or "<<").
+func isIntegerOperator(op *ast.OperatorDefn) bool {
+	switch op {
+	case
+		ast.BuiltinRemainder,
+		ast.BuiltinBitAnd,
+		ast.BuiltinBitOr,
+		ast.BuiltinBitXor,
+		ast.BuiltinShiftLeft,
+		ast.BuiltinShiftRight,
+		ast.BuiltinBitNot:
+		return true
+	default:
+		return false
+	}
+}
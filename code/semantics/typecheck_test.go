@@ -0,0 +1,211 @@
+package semantics
+
+import (
+	"testing"
+
+	"github.com/kestred/philomath/code/ast"
+	"github.com/kestred/philomath/code/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func checkAny(t *testing.T, input string) (ast.Node, []error) {
+	p := parser.Make("example", false, []byte(input))
+	node := p.ParseEvaluable()
+	assert.Empty(t, p.Errors, "Unexpected parser errors")
+	section := FlattenTree(node, nil)
+	ResolveNames(&section)
+	InferTypes(&section)
+	return node, CheckTypes(&section)
+}
+
+func TestCheckMultipleReturns(t *testing.T) {
+	node, errs := checkAny(t, `{
+		find :: () -> (int, bool) { return 3, 1 < 2; };
+		x, ok := find();
+		x, ok = find();
+	}`)
+	assert.Empty(t, errs)
+	decl := node.(*ast.Block).Nodes[1].(*ast.DestructureStmt)
+	assert.Equal(t, ast.BuiltinInt, decl.Decls[0].Type)
+	assert.Equal(t, ast.BuiltinBool, decl.Decls[1].Type)
+
+	_, errs = checkAny(t, `{
+		find :: () -> (int, bool) { return 3; };
+		pair :: () -> (int, bool) { return 1 < 2, 3; };
+		one :: () -> int { return 1, 2; };
+	}`)
+	if assert.Equal(t, 4, len(errs)) {
+		assert.Equal(t, "example:2:31: Expected 2 return values (int, bool), but found 1", errs[0].Error())
+		assert.Equal(t, "example:3:40: A value of type bool can't be used as int", errs[1].Error())
+		assert.Equal(t, "example:3:45: A value of type <number> can't be used as bool", errs[2].Error())
+		assert.Equal(t, "example:4:22: Expected 1 return value, but found 2", errs[3].Error())
+	}
+
+	_, errs = checkAny(t, `{
+		name :: () -> int { return "abc"; };
+		none :: () -> int { return; };
+		wide :: () -> i16 { a: i8 = 1; return a; };
+	}`)
+	if assert.Equal(t, 2, len(errs)) {
+		assert.Equal(t, "example:2:30: A value of type <text> can't be used as int", errs[0].Error())
+		assert.Equal(t, "example:3:23: Expected 1 return value (int), but found 0", errs[1].Error())
+	}
+
+	_, errs = checkAny(t, `{
+		find :: () -> (int, bool) { return 3, 1 < 2; };
+		a, b, c := find();
+		a, b = find(), 2;
+		c := find();
+	}`)
+	if assert.Equal(t, 3, len(errs)) {
+		assert.Equal(t, "example:3:3: Expected 3 values to declare, but found 2", errs[0].Error())
+		assert.Equal(t, "example:4:3: Expected 2 values to assign, but found 3", errs[1].Error())
+		assert.Equal(t, `example:5:8: A call with 2 return values must be assigned to as many names (eg. "a, b := f();")`, errs[2].Error())
+	}
+}
+
+func TestCheckAssignments(t *testing.T) {
+	_, errs := checkAny(t, `{
+		pair :: () -> (int, int) { return 1, 2; };
+		both :: () -> (bool, bool) { return 1 < 2, 2 < 1; };
+		a := 5;
+		b := 5;
+		a, b = pair();
+		a, b = b, a;
+		p, q := both();
+		p, q = q, p;
+	}`)
+	assert.Empty(t, errs)
+
+	_, errs = checkAny(t, `{
+		pair :: () -> (int, int) { return 1, 2; };
+		one :: () -> int { return 1; };
+		a: i8;
+		b: int;
+		a, b = pair();
+		a = one();
+		a, b = b, a;
+	}`)
+	expected := []string{
+		"example:6:3: Values of types (int, int) can't be used as (i8, int)",
+		"example:7:7: A value of type int can't be used as i8",
+		"example:8:10: A value of type int can't be used as i8",
+	}
+	if assert.Equal(t, len(expected), len(errs)) {
+		for i, msg := range expected {
+			assert.Equal(t, msg, errs[i].Error())
+		}
+	}
+
+	// constants must be representable by the values they are assigned to
+	_, errs = foldAny(t, `{
+		pair :: () -> (int, u8) { return 1, 300; };
+		a: u8;
+		b: int;
+		a, b = 256, 1;
+	}`)
+	if assert.Equal(t, 2, len(errs)) {
+		assert.Equal(t, "example:2:39: Constant overflow: 300 can't be represented as u8", errs[0].Error())
+		assert.Equal(t, "example:5:10: Constant overflow: 256 can't be represented as u8", errs[1].Error())
+	}
+}
+
+func TestCheckProcedureValues(t *testing.T) {
+	node, errs := checkAny(t, `{
+		double :: (n: int) -> int { return n * 2; };
+		f: (int) -> int = double;
+		f(3);
+	}`)
+	assert.Empty(t, errs)
+	call := node.(*ast.Block).Nodes[2].(*ast.EvalStmt).Expr.(*ast.CallExpr)
+	assert.Equal(t, ast.BuiltinInt, call.Type)
+
+	_, errs = checkAny(t, `{
+		length :: (s: text) -> int { return 1; };
+		f: (int) -> int = length;
+		f(2, 3);
+		f(n = 2);
+		f("two");
+		n := 2;
+		n(3);
+	}`)
+	if assert.Equal(t, 5, len(errs)) {
+		assert.Equal(t, "example:3:21: A value of type (text) -> int can't be used as (int) -> int", errs[0].Error())
+		assert.Equal(t, "example:4:3: Expected 1 arguments (int), but found 2", errs[1].Error())
+		assert.Equal(t, "example:5:9: Named arguments can't be used when calling a procedure value", errs[2].Error())
+		assert.Equal(t, "example:6:5: A value of type <text> can't be used as int", errs[3].Error())
+		assert.Equal(t, "example:8:3: A value of type <number> can't be called", errs[4].Error())
+	}
+
+	// a procedure can be stored in a struct
+	node, errs = checkAny(t, `{
+		S :: struct { op: (int) -> int; count: int; };
+		apply :: (s: S) -> int { return s.op(s.count); };
+		other :: (s: S) -> int { return s.size; };
+	}`)
+	if assert.Equal(t, 1, len(errs)) {
+		assert.Equal(t, `example:4:35: A value of type S has no member "size"`, errs[0].Error())
+	}
+	proc := node.(*ast.Block).Nodes[1].(*ast.ImmutableDecl).Defn.(*ast.ConstantDefn).Expr.(*ast.ProcedureExpr)
+	call = proc.Block.Nodes[0].(*ast.ReturnStmt).Value.(*ast.CallExpr)
+	assert.Equal(t, ast.BuiltinInt, call.Type)
+}
+
+func TestCheckDefer(t *testing.T) {
+	_, errs := checkAny(t, `{
+		f :: () -> int {
+			defer { return 2; }
+			return 1;
+		};
+	}`)
+	if assert.Equal(t, 1, len(errs)) {
+		assert.Equal(t, `example:3:12: A deferred statement can't return (eg. "defer { return; }")`, errs[0].Error())
+	}
+}
+
+func TestCheckLoops(t *testing.T) {
+	_, errs := checkAny(t, `{
+		done;
+		while 1 { done; }
+		while 1 < 2 {
+			defer { done; }
+			defer { while 1 < 2 { done; } }
+		}
+	}`)
+	if assert.Equal(t, 3, len(errs)) {
+		assert.Equal(t, `example:2:3: "done" can only be used in a loop`, errs[0].Error())
+		assert.Equal(t, `example:3:9: The condition of "while" must be a bool, but has type <number>`, errs[1].Error())
+		assert.Equal(t, `example:5:12: A deferred statement can't leave a loop (eg. "defer { done; }")`, errs[2].Error())
+	}
+}
+
+func TestCheckDirectives(t *testing.T) {
+	_, errs := checkAny(t, `{
+		x := 5;
+		K :: #run x + 1;
+		L :: #run { y := 2; y * 3; };
+	}`)
+	if assert.Equal(t, 1, len(errs)) {
+		assert.Equal(t, "example:3:13: #run cannot reference runtime variable 'x'", errs[0].Error())
+	}
+
+	_, errs = checkAny(t, `{
+		x := 3;
+		#assert x == 3, "runtime";
+	}`)
+	if assert.Equal(t, 1, len(errs)) {
+		assert.Equal(t, "example:3:11: #assert condition must be a compile-time constant", errs[0].Error())
+	}
+}
+
+func TestCheckConstantDecls(t *testing.T) {
+	_, errs := checkAny(t, `{
+		x := 3;
+		K :: x + 1;
+		L :: K + 1;
+		f :: () -> int { return x; };
+	}`)
+	if assert.Equal(t, 1, len(errs)) {
+		assert.Equal(t, "example:3:8: value of constant 'K' is not known at compile time", errs[0].Error())
+	}
+}
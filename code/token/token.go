@@ -58,10 +58,12 @@ const (
 	// Identifier
 	IDENT
 	DIRECTIVE
+	POLYMORPH // $T
 
 	// Literals
 	NUMBER
-	TEXT
+	TEXT // "text", `raw text`, or """multi-line text"""
+	CHAR
 
 	// Operators
 	operators_begin
@@ -76,6 +78,8 @@ const (
 	COMMA     // ,
 	EQUALS    // =
 	ARROW     // ->
+	RANGE     // ..
+	QUESTION  // ?
 
 	// Delimiters
 	LEFT_PAREN    // (
@@ -91,9 +95,12 @@ const (
 	IF     // if
 	ELSE   // else
 	FOR    // for
+	WHILE  // while
 	IN     // in
+	CAST   // cast
 	DONE   // break
 	RETURN // return
+	DEFER  // defer
 
 	STRUCT // struct
 	MODULE // module
@@ -107,9 +114,11 @@ var tokens = [...]string{
 
 	IDENT:     "Identifier",
 	DIRECTIVE: "Directive",
+	POLYMORPH: "Type parameter",
 
 	NUMBER: "Number",
 	TEXT:   "Text",
+	CHAR:   "Char",
 
 	OPERATOR: "Operator",
 	PERIOD:   ".",
@@ -120,6 +129,8 @@ var tokens = [...]string{
 	COMMA:     ",",
 	EQUALS:    "=",
 	ARROW:     "->",
+	RANGE:     "..",
+	QUESTION:  "?",
 
 	LEFT_PAREN:    "(",
 	LEFT_BRACKET:  "[",
@@ -131,9 +142,12 @@ var tokens = [...]string{
 	IF:     "if",
 	ELSE:   "else",
 	FOR:    "for",
+	WHILE:  "while",
 	IN:     "in",
+	CAST:   "cast",
 	DONE:   "done",
 	RETURN: "return",
+	DEFER:  "defer",
 
 	STRUCT: "struct",
 	MODULE: "module",
@@ -81,6 +81,7 @@ func TestTokenString(t *testing.T) {
 
 	assert.Equal(t, "if", IF.String())
 	assert.Equal(t, "for", FOR.String())
+	assert.Equal(t, "while", WHILE.String())
 	assert.Equal(t, "in", IN.String())
 	assert.Equal(t, "done", DONE.String())
 	assert.Equal(t, "return", RETURN.String())
@@ -110,6 +111,8 @@ func TestIsOperator(t *testing.T) {
 	assert.Equal(t, false, COMMA.IsOperator())
 	assert.Equal(t, false, EQUALS.IsOperator())
 	assert.Equal(t, false, ARROW.IsOperator())
+	assert.Equal(t, false, RANGE.IsOperator())
+	assert.Equal(t, false, QUESTION.IsOperator())
 
 	assert.Equal(t, false, LEFT_PAREN.IsOperator())
 	assert.Equal(t, false, LEFT_BRACKET.IsOperator())
@@ -121,6 +124,7 @@ func TestIsOperator(t *testing.T) {
 	assert.Equal(t, false, IF.IsOperator())
 	assert.Equal(t, false, FOR.IsOperator())
 	assert.Equal(t, false, IN.IsOperator())
+	assert.Equal(t, false, CAST.IsOperator())
 	assert.Equal(t, false, DONE.IsOperator())
 	assert.Equal(t, false, RETURN.IsOperator())
 
@@ -147,6 +151,8 @@ func TestIsKeyword(t *testing.T) {
 	assert.Equal(t, false, COMMA.IsKeyword())
 	assert.Equal(t, false, EQUALS.IsKeyword())
 	assert.Equal(t, false, ARROW.IsKeyword())
+	assert.Equal(t, false, RANGE.IsKeyword())
+	assert.Equal(t, false, QUESTION.IsKeyword())
 
 	assert.Equal(t, false, LEFT_PAREN.IsKeyword())
 	assert.Equal(t, false, LEFT_BRACKET.IsKeyword())
@@ -158,6 +164,7 @@ func TestIsKeyword(t *testing.T) {
 	assert.Equal(t, true, IF.IsKeyword())
 	assert.Equal(t, true, FOR.IsKeyword())
 	assert.Equal(t, true, IN.IsKeyword())
+	assert.Equal(t, true, CAST.IsKeyword())
 	assert.Equal(t, true, DONE.IsKeyword())
 	assert.Equal(t, true, RETURN.IsKeyword())
 
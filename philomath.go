@@ -15,6 +15,7 @@ import (
 )
 
 var ArgTrace = flag.Bool("trace", false, "")
+var ArgUnchecked = flag.Bool("unchecked", false, "")
 
 func init() {
 	log.SetFlags(0)
@@ -32,6 +33,9 @@ Usage:
 
 Commands:
   run     interpret a .phi source file
+
+Options:
+  -unchecked  allow integer overflow and lossy conversions to wrap-around
 `[1:])
 }
 
@@ -58,6 +62,14 @@ func main() {
 }
 
 func doRun(args []string) {
+	// options may be given after the command too (eg. "phi run -unchecked main.phi")
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	flags.Usage = usage
+	flags.BoolVar(ArgTrace, "trace", *ArgTrace, "")
+	flags.BoolVar(ArgUnchecked, "unchecked", *ArgUnchecked, "")
+	flags.Parse(args)
+	args = flags.Args()
+
 	if len(args) == 0 {
 		log.Fatalln(`error: no input files`)
 	}
@@ -88,7 +100,7 @@ func doRun(args []string) {
 	}
 
 	for _, decl := range tree.Decls {
-		if decl.GetName().Literal == "main" {
+		if name := decl.GetName(); name != nil && name.Literal == "main" {
 			if imm, ok := decl.(*ast.ImmutableDecl); ok {
 				if con, ok := imm.Defn.(*ast.ConstantDefn); ok {
 					if _, ok := con.Expr.(*ast.ProcedureExpr); ok {
@@ -108,6 +120,13 @@ func doRun(args []string) {
 	semantics.InferTypes(&section)
 	// TODO: maybe add an errors list to Section?
 	errs := semantics.CheckTypes(&section)
+	if len(errs) == 0 {
+		// directives are only run once the code they run is known to be valid
+		errs = interpreter.RunDirectives(tree, section.Nodes, !*ArgUnchecked)
+	}
+	if len(errs) == 0 {
+		errs = semantics.FoldConstants(&section)
+	}
 	if len(errs) > 0 {
 		for _, err := range errs {
 			fmt.Printf("%v\n", err)
@@ -115,11 +134,15 @@ func doRun(args []string) {
 		log.Fatalf("found %v semantic error(s)\n", len(errs))
 	}
 	program := bytecode.NewProgram()
+	program.Checked = !*ArgUnchecked
 	program.Extend(tree)
 
 	if _, ok := program.Text["main"]; !ok {
 		log.Fatalf(`unable to find a procedure named "main"`)
 	}
 
-	interpreter.Run(program)
+	if _, err := interpreter.Run(program); err != nil {
+		fmt.Printf("%v\n", err)
+		log.Fatalf("aborted due to a runtime error\n")
+	}
 }